@@ -1,6 +1,62 @@
 package redcap
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
 type Arm struct {
 	ArmNum int    `json:"arm_num"`
 	Name   string `json:"name"`
 }
+
+// UnmarshalJSON decodes an arm, whose number REDCap sends as a number or
+// a string.
+func (a *Arm) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ArmNum jsonText `json:"arm_num"`
+		Name   jsonText `json:"name"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(string(raw.ArmNum))
+	if err != nil {
+		return fmt.Errorf("invalid arm_num %q", raw.ArmNum)
+	}
+	*a = Arm{ArmNum: n, Name: string(raw.Name)}
+	return nil
+}
+
+// ImportArms adds arms or renames them by number and returns the number
+// imported. With override, all existing arms and their events are
+// deleted first.
+func (c *Client) ImportArms(ctx context.Context, arms []Arm, override bool) (int, error) {
+	data, err := json.Marshal(arms)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling arms: %w", err)
+	}
+	return c.importJSON(ctx, "arm", data, map[string]string{
+		"action":   "import",
+		"override": overrideParam(override),
+	})
+}
+
+// DeleteArms deletes arms by number, with their events and the data
+// collected in them, and returns the number deleted.
+func (c *Client) DeleteArms(ctx context.Context, armNums []int) (int, error) {
+	names := make([]string, len(armNums))
+	for i, n := range armNums {
+		names[i] = strconv.Itoa(n)
+	}
+	return c.deleteList(ctx, "arm", "arms", names)
+}
+
+func overrideParam(override bool) string {
+	if override {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,293 @@
+package redcap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AuditCheck names one rule of a user rights audit.
+type AuditCheck string
+
+const (
+	// AuditExpired flags users whose expiration date has passed but who
+	// are still on the project with their rights.
+	AuditExpired AuditCheck = "expired"
+	// AuditAPIExportIdentifiable flags users who can export through the
+	// API and have full export rights on identifier fields.
+	AuditAPIExportIdentifiable AuditCheck = "api_export_identifiable"
+	// AuditNoDAG flags users outside every data access group on a
+	// project that has groups, who therefore see all records.
+	AuditNoDAG AuditCheck = "no_dag"
+	// AuditDesignInProduction flags users with design rights on a
+	// project in production.
+	AuditDesignInProduction AuditCheck = "design_in_production"
+	// AuditRoleDrift flags roles whose rights differ from the policy,
+	// roles the policy does not declare, and declared roles missing from
+	// the project.
+	AuditRoleDrift AuditCheck = "role_drift"
+)
+
+// AuditPolicy declares the expected user roles of a project.
+type AuditPolicy struct {
+	// Roles maps role labels to their declared rights, by API name with
+	// values as accepted by Rights.Set. Flags, lock_records and
+	// data_export left out must be 0; forms and forms_export are only
+	// compared when declared. Without roles, drift is not checked.
+	Roles map[string]map[string]string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// Exempt lists the usernames excused from each check.
+	Exempt map[AuditCheck][]string `json:"exempt,omitempty" yaml:"exempt,omitempty"`
+}
+
+// rights returns the declared rights of each role.
+func (p *AuditPolicy) rights() (map[string]Rights, error) {
+	roles := make(map[string]Rights, len(p.Roles))
+	for label, declared := range p.Roles {
+		var r Rights
+		for name, v := range declared {
+			if err := r.Set(name, v); err != nil {
+				return nil, fmt.Errorf("policy role %q: %w", label, err)
+			}
+		}
+		roles[label] = r
+	}
+	return roles, nil
+}
+
+func (p *AuditPolicy) exempt(check AuditCheck, username string) bool {
+	for _, u := range p.Exempt[check] {
+		if strings.EqualFold(u, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditFinding is one violation found by AuditUsers.
+type AuditFinding struct {
+	Check AuditCheck `json:"check"`
+	// Username is empty for findings about a role alone.
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+// AuditReport is the result of AuditUsers.
+type AuditReport struct {
+	Time       time.Time      `json:"time"`
+	Production bool           `json:"production"`
+	DAGs       int            `json:"dags"`
+	Users      int            `json:"users"`
+	Roles      int            `json:"roles"`
+	Findings   []AuditFinding `json:"findings"`
+}
+
+// AuditUsers reviews the project's users and roles for expired access,
+// API export of identifiers, users outside data access groups, design
+// rights in production and, when policy declares roles, role drift.
+// policy may be nil. Findings are sorted by check, then username.
+func (c *Client) AuditUsers(ctx context.Context, policy *AuditPolicy) (*AuditReport, error) {
+	if policy == nil {
+		policy = &AuditPolicy{}
+	}
+	declared, err := policy.rights()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := c.ExportProject(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting project info: %w", err)
+	}
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting metadata: %w", err)
+	}
+	users, err := c.ExportUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting users: %w", err)
+	}
+	roles, err := c.ExportUserRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting user roles: %w", err)
+	}
+	mapping, err := c.ExportUserRoleMapping(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting user role mapping: %w", err)
+	}
+	dags, err := c.ExportDAGs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting DAGs: %w", err)
+	}
+
+	report := &AuditReport{
+		Time:       time.Now(),
+		Production: fmt.Sprint(info["in_production"]) == "1",
+		DAGs:       len(dags),
+		Users:      len(users),
+		Roles:      len(roles),
+		Findings:   []AuditFinding{},
+	}
+	add := func(f AuditFinding) {
+		if f.Username == "" || !policy.exempt(f.Check, f.Username) {
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	labels := make(map[string]string, len(roles))
+	for _, r := range roles {
+		labels[r.UniqueRoleName] = r.RoleLabel
+	}
+	userRole := make(map[string]string, len(mapping))
+	for _, m := range mapping {
+		userRole[m.Username] = labels[m.UniqueRoleName]
+	}
+	identifiable := identifierForms(fields)
+	today := report.Time.Format("2006-01-02")
+
+	for _, u := range users {
+		role := userRole[u.Username]
+		if u.Expiration != "" && u.Expiration <= today {
+			detail := "expired " + u.Expiration
+			if u.LastLogin != "" {
+				detail += ", last login " + u.LastLogin
+			}
+			add(AuditFinding{Check: AuditExpired, Username: u.Username, Role: role, Detail: detail})
+		}
+		if u.APIExport {
+			if forms := u.identifiableExport(identifiable); len(forms) > 0 {
+				add(AuditFinding{Check: AuditAPIExportIdentifiable, Username: u.Username, Role: role,
+					Detail: "API export with full data set on " + strings.Join(forms, ", ")})
+			}
+		}
+		if len(dags) > 0 && u.DataAccessGroup == "" {
+			add(AuditFinding{Check: AuditNoDAG, Username: u.Username, Role: role, Detail: "not in a data access group"})
+		}
+		if report.Production && u.Design {
+			add(AuditFinding{Check: AuditDesignInProduction, Username: u.Username, Role: role, Detail: "project design rights"})
+		}
+	}
+
+	if len(declared) > 0 {
+		seen := make(map[string]bool, len(roles))
+		for _, r := range roles {
+			seen[r.RoleLabel] = true
+			want, ok := declared[r.RoleLabel]
+			if !ok {
+				add(AuditFinding{Check: AuditRoleDrift, Role: r.RoleLabel, Detail: "role not declared in policy"})
+				continue
+			}
+			if diff := rightsDiff(r.Rights, want); len(diff) > 0 {
+				add(AuditFinding{Check: AuditRoleDrift, Role: r.RoleLabel, Detail: strings.Join(diff, "; ")})
+			}
+		}
+		for label := range declared {
+			if !seen[label] {
+				add(AuditFinding{Check: AuditRoleDrift, Role: label, Detail: "declared role missing from project"})
+			}
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Check != b.Check {
+			return a.Check < b.Check
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.Role < b.Role
+	})
+	return report, nil
+}
+
+// identifierForms returns the instruments holding fields marked as
+// identifiers.
+func identifierForms(fields []Field) map[string]bool {
+	forms := make(map[string]bool)
+	for _, f := range fields {
+		if strings.EqualFold(f.Identifier, "y") {
+			forms[f.Form_name] = true
+		}
+	}
+	return forms
+}
+
+// identifiableExport returns the identifier instruments the rights allow
+// exporting in full, using per-instrument export rights when present.
+func (r *Rights) identifiableExport(identifiable map[string]bool) []string {
+	var forms []string
+	for form := range identifiable {
+		right := r.DataExport
+		if r.FormsExport != nil {
+			right = r.FormsExport[form]
+		}
+		if right == DataExportFull {
+			forms = append(forms, form)
+		}
+	}
+	sort.Strings(forms)
+	return forms
+}
+
+// rightsDiff describes how got differs from want, one right per entry,
+// such as "design: 1, policy 0".
+func rightsDiff(got, want Rights) []string {
+	var diff []string
+	wantFlags := want.flags()
+	names := make([]string, 0, len(wantFlags))
+	for name := range wantFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	gotFlags := got.flags()
+	for _, name := range names {
+		if *gotFlags[name] != *wantFlags[name] {
+			diff = append(diff, fmt.Sprintf("%s: %d, policy %d", name, flagValue(*gotFlags[name]), flagValue(*wantFlags[name])))
+		}
+	}
+	if got.LockRecords != want.LockRecords {
+		diff = append(diff, fmt.Sprintf("lock_records: %d, policy %d", got.LockRecords, want.LockRecords))
+	}
+	if got.DataExport != want.DataExport {
+		diff = append(diff, fmt.Sprintf("data_export: %d, policy %d", got.DataExport, want.DataExport))
+	}
+	diff = append(diff, formsDiff("forms", got.Forms, want.Forms)...)
+	diff = append(diff, formsDiff("forms_export", got.FormsExport, want.FormsExport)...)
+	return diff
+}
+
+// formsDiff compares per-instrument rights, skipping undeclared maps.
+// Instruments missing from got count as 0.
+func formsDiff[R ~int](name string, got, want map[string]R) []string {
+	if want == nil {
+		return nil
+	}
+	forms := make([]string, 0, len(want))
+	for form := range want {
+		forms = append(forms, form)
+	}
+	for form := range got {
+		if _, ok := want[form]; !ok {
+			forms = append(forms, form)
+		}
+	}
+	sort.Strings(forms)
+
+	var diff []string
+	for _, form := range forms {
+		if got[form] != want[form] {
+			diff = append(diff, fmt.Sprintf("%s %s: %d, policy %d", name, form, got[form], want[form]))
+		}
+	}
+	return diff
+}
+
+func flagValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
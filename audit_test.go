@@ -0,0 +1,189 @@
+package redcap
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// auditProject is the JSON a project serves to AuditUsers, by content.
+type auditProject struct {
+	production bool
+	users      string
+	roles      string
+	mapping    string
+	dags       string
+}
+
+func (p auditProject) handler(w http.ResponseWriter, r *http.Request) {
+	or := func(s, def string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	}
+	switch r.FormValue("content") {
+	case "project":
+		if p.production {
+			w.Write([]byte(`[{"project_id":1,"in_production":1}]`))
+		} else {
+			w.Write([]byte(`[{"project_id":1,"in_production":0}]`))
+		}
+	case "metadata":
+		w.Write([]byte(`[{"field_name":"record_id","form_name":"demo","field_type":"text"},` +
+			`{"field_name":"name","form_name":"demo","field_type":"text","identifier":"y"},` +
+			`{"field_name":"score","form_name":"visit","field_type":"text"}]`))
+	case "user":
+		w.Write([]byte(or(p.users, "[]")))
+	case "userRole":
+		w.Write([]byte(or(p.roles, "[]")))
+	case "userRoleMapping":
+		w.Write([]byte(or(p.mapping, "[]")))
+	case "dag":
+		w.Write([]byte(or(p.dags, "[]")))
+	}
+}
+
+func TestAuditUsers(t *testing.T) {
+	past := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	future := time.Now().AddDate(0, 1, 0).Format("2006-01-02")
+
+	tests := []struct {
+		name    string
+		project auditProject
+		policy  *AuditPolicy
+		want    []AuditFinding
+	}{
+		{
+			name: "expired",
+			project: auditProject{
+				users: `[{"username":"ann","expiration":"` + past + `","last_login":"2024-01-02 10:00"},` +
+					`{"username":"bo","expiration":"` + future + `"},{"username":"cy","expiration":""}]`,
+				roles:   `[{"unique_role_name":"U-1","role_label":"Coordinator"}]`,
+				mapping: `[{"username":"ann","unique_role_name":"U-1"}]`,
+			},
+			want: []AuditFinding{
+				{Check: AuditExpired, Username: "ann", Role: "Coordinator", Detail: "expired " + past + ", last login 2024-01-02 10:00"},
+			},
+		},
+		{
+			name: "API export with identifiers",
+			project: auditProject{
+				users: `[{"username":"ann","api_export":1,"data_export":1},` +
+					`{"username":"bo","api_export":1,"data_export":3},` +
+					`{"username":"cy","api_export":0,"data_export":1},` +
+					`{"username":"di","api_export":1,"data_export":3,"forms_export":{"demo":1,"visit":1}},` +
+					`{"username":"ed","api_export":1,"data_export":1,"forms_export":{"demo":2,"visit":1}}]`,
+			},
+			want: []AuditFinding{
+				{Check: AuditAPIExportIdentifiable, Username: "ann", Detail: "API export with full data set on demo"},
+				{Check: AuditAPIExportIdentifiable, Username: "di", Detail: "API export with full data set on demo"},
+			},
+		},
+		{
+			name: "no DAG",
+			project: auditProject{
+				users: `[{"username":"ann","data_access_group":"site_a"},{"username":"bo","data_access_group":""}]`,
+				dags:  `[{"data_access_group_name":"Site A","unique_group_name":"site_a"}]`,
+			},
+			want: []AuditFinding{
+				{Check: AuditNoDAG, Username: "bo", Detail: "not in a data access group"},
+			},
+		},
+		{
+			name:    "no DAGs on the project",
+			project: auditProject{users: `[{"username":"bo"}]`},
+			want:    []AuditFinding{},
+		},
+		{
+			name: "design rights in production",
+			project: auditProject{
+				production: true,
+				users:      `[{"username":"ann","design":1},{"username":"bo","design":0},{"username":"cy","design":1}]`,
+			},
+			policy: &AuditPolicy{Exempt: map[AuditCheck][]string{AuditDesignInProduction: {"CY"}}},
+			want: []AuditFinding{
+				{Check: AuditDesignInProduction, Username: "ann", Detail: "project design rights"},
+			},
+		},
+		{
+			name:    "design rights in development",
+			project: auditProject{users: `[{"username":"ann","design":1}]`},
+			want:    []AuditFinding{},
+		},
+		{
+			name: "role drift",
+			project: auditProject{
+				roles: `[{"unique_role_name":"U-1","role_label":"Coordinator","design":1,"data_export":3},` +
+					`{"unique_role_name":"U-2","role_label":"Monitor","reports":1},` +
+					`{"unique_role_name":"U-3","role_label":"Guest"}]`,
+			},
+			policy: &AuditPolicy{Roles: map[string]map[string]string{
+				"Coordinator": {"data_export": "2"},
+				"Monitor":     {"reports": "1"},
+				"Analyst":     {"reports": "1"},
+			}},
+			want: []AuditFinding{
+				{Check: AuditRoleDrift, Role: "Analyst", Detail: "declared role missing from project"},
+				{Check: AuditRoleDrift, Role: "Coordinator", Detail: "design: 1, policy 0; data_export: 3, policy 2"},
+				{Check: AuditRoleDrift, Role: "Guest", Detail: "role not declared in policy"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, tt.project.handler)
+			report, err := c.AuditUsers(context.Background(), tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Production != tt.project.production {
+				t.Errorf("production = %v", report.Production)
+			}
+			if !reflect.DeepEqual(report.Findings, tt.want) {
+				t.Errorf("findings:\n got %+v\nwant %+v", report.Findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditUsersBadPolicy(t *testing.T) {
+	c := newTestClient(t, auditProject{}.handler)
+	policy := &AuditPolicy{Roles: map[string]map[string]string{"Coordinator": {"design": "maybe"}}}
+	if _, err := c.AuditUsers(context.Background(), policy); err == nil {
+		t.Error("AuditUsers accepted an invalid policy")
+	}
+}
+
+func TestRightsDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want Rights
+		diff      []string
+	}{
+		{"same", Rights{Design: true, DataExport: DataExportDeidentified}, Rights{Design: true, DataExport: DataExportDeidentified}, nil},
+		{"flags", Rights{Design: true}, Rights{Reports: true}, []string{"design: 1, policy 0", "reports: 0, policy 1"}},
+		{"lock records", Rights{LockRecords: 2}, Rights{}, []string{"lock_records: 2, policy 0"}},
+		{"data export", Rights{DataExport: DataExportFull}, Rights{DataExport: DataExportRemoveIdentifiers}, []string{"data_export: 1, policy 3"}},
+		{"undeclared forms", Rights{Forms: map[string]FormRight{"demo": FormViewEdit}}, Rights{}, nil},
+		{
+			"forms",
+			Rights{Forms: map[string]FormRight{"demo": FormViewEdit, "extra": FormReadOnly}},
+			Rights{Forms: map[string]FormRight{"demo": FormReadOnly, "visit": FormViewEdit}},
+			[]string{"forms demo: 1, policy 2", "forms extra: 2, policy 0", "forms visit: 0, policy 1"},
+		},
+		{
+			"forms export",
+			Rights{FormsExport: map[string]DataExportRight{"demo": DataExportFull}},
+			Rights{FormsExport: map[string]DataExportRight{"demo": DataExportNone}},
+			[]string{"forms_export demo: 1, policy 0"},
+		},
+	}
+	for _, tt := range tests {
+		if got := rightsDiff(tt.got, tt.want); !reflect.DeepEqual(got, tt.diff) {
+			t.Errorf("%s: rightsDiff = %q, want %q", tt.name, got, tt.diff)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package redcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerFailures    = 5
+	DefaultBreakerOpenTimeout = 30 * time.Second
+	DefaultBreakerWindow      = time.Minute
+	DefaultBreakerMinRequests = 10
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// ErrCircuitOpen matches any CircuitOpenError with errors.Is.
+var ErrCircuitOpen = errors.New("redcap: circuit breaker open")
+
+// CircuitOpenError is returned without contacting the server while the
+// circuit breaker is open.
+type CircuitOpenError struct {
+	// RetryAt is when the breaker will next allow a probe.
+	RetryAt time.Time
+	// LastErr is the failure that tripped or re-opened the breaker.
+	LastErr error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("redcap: circuit breaker open until %s: %v", e.RetryAt.Format(time.RFC3339), e.LastErr)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.LastErr
+}
+
+// BreakerConfig configures the circuit breaker. Zero values fall back to
+// the defaults, except FailureRate, which is off unless set. A negative
+// ConsecutiveFailures disables that trip condition.
+type BreakerConfig struct {
+	// ConsecutiveFailures trips the breaker after this many retryable
+	// failures in a row.
+	ConsecutiveFailures int
+	// FailureRate trips the breaker when the share of retryable failures
+	// within Window reaches it, once MinRequests have been seen.
+	FailureRate float64
+	Window      time.Duration
+	MinRequests int
+	// OpenTimeout is how long the breaker stays open before probing.
+	OpenTimeout time.Duration
+	// OnStateChange is called after every transition.
+	OnStateChange func(from, to BreakerState)
+}
+
+// WithCircuitBreaker makes the client fail fast while the server looks
+// unhealthy. Each retryable failure (5xx, 429, network) counts against
+// the server; once tripped, requests return a *CircuitOpenError until
+// OpenTimeout passes. A single probe, the same request Ping sends, then
+// decides whether to close the breaker or keep it open.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(c *Client) error {
+		c.breaker = newBreaker(cfg, c.ping)
+		return nil
+	}
+}
+
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+type breaker struct {
+	cfg   BreakerConfig
+	probe func(ctx context.Context) error
+
+	mu          sync.Mutex
+	state       BreakerState
+	consecutive int
+	outcomes    []outcome
+	openUntil   time.Time
+	lastErr     error
+	probing     bool
+}
+
+func newBreaker(cfg BreakerConfig, probe func(ctx context.Context) error) *breaker {
+	if cfg.ConsecutiveFailures == 0 {
+		cfg.ConsecutiveFailures = DefaultBreakerFailures
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultBreakerWindow
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = DefaultBreakerMinRequests
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+	return &breaker{cfg: cfg, probe: probe}
+}
+
+// allow reports whether a request may proceed, probing the server first
+// if the open timeout has elapsed.
+func (b *breaker) allow(ctx context.Context) error {
+	b.mu.Lock()
+	switch b.state {
+	case BreakerClosed:
+		b.mu.Unlock()
+		return nil
+	case BreakerOpen:
+		if time.Now().Before(b.openUntil) {
+			err := b.openErr()
+			b.mu.Unlock()
+			return err
+		}
+	}
+	// Half-open: only one caller probes, everyone else keeps failing fast.
+	if b.probing {
+		err := b.openErr()
+		b.mu.Unlock()
+		return err
+	}
+	b.probing = true
+	from := b.setState(BreakerHalfOpen)
+	b.mu.Unlock()
+	b.notify(from, BreakerHalfOpen)
+
+	err := b.probe(ctx)
+
+	b.mu.Lock()
+	b.probing = false
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		// Our caller gave up; that says nothing about the server.
+		b.mu.Unlock()
+		return err
+	}
+	if err != nil && IsTransient(err) {
+		b.lastErr = err
+		b.openUntil = time.Now().Add(b.cfg.OpenTimeout)
+		from = b.setState(BreakerOpen)
+		openErr := b.openErr()
+		b.mu.Unlock()
+		b.notify(from, BreakerOpen)
+		return openErr
+	}
+	b.consecutive = 0
+	b.outcomes = nil
+	from = b.setState(BreakerClosed)
+	b.mu.Unlock()
+	b.notify(from, BreakerClosed)
+	return nil
+}
+
+// record feeds the result of one attempt into the breaker.
+func (b *breaker) record(err error) {
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return
+	}
+	failed := err != nil && IsTransient(err)
+	now := time.Now()
+
+	b.mu.Lock()
+	if b.state != BreakerClosed {
+		b.mu.Unlock()
+		return
+	}
+
+	cutoff := now.Add(-b.cfg.Window)
+	kept := b.outcomes[:0]
+	for _, o := range b.outcomes {
+		if o.at.After(cutoff) {
+			kept = append(kept, o)
+		}
+	}
+	b.outcomes = append(kept, outcome{at: now, failed: failed})
+
+	if !failed {
+		b.consecutive = 0
+		b.mu.Unlock()
+		return
+	}
+	b.consecutive++
+	b.lastErr = err
+
+	if !b.shouldTrip() {
+		b.mu.Unlock()
+		return
+	}
+	b.openUntil = now.Add(b.cfg.OpenTimeout)
+	from := b.setState(BreakerOpen)
+	b.mu.Unlock()
+	b.notify(from, BreakerOpen)
+}
+
+func (b *breaker) shouldTrip() bool {
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		return true
+	}
+	if b.cfg.FailureRate <= 0 || len(b.outcomes) < b.cfg.MinRequests {
+		return false
+	}
+	var failures int
+	for _, o := range b.outcomes {
+		if o.failed {
+			failures++
+		}
+	}
+	return float64(failures)/float64(len(b.outcomes)) >= b.cfg.FailureRate
+}
+
+// setState must be called with mu held. It returns the previous state.
+func (b *breaker) setState(s BreakerState) BreakerState {
+	from := b.state
+	b.state = s
+	return from
+}
+
+func (b *breaker) notify(from, to BreakerState) {
+	if from != to && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
+
+func (b *breaker) openErr() error {
+	return &CircuitOpenError{RetryAt: b.openUntil, LastErr: b.lastErr}
+}
+
+func (b *breaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// BreakerState returns the state of the client's circuit breaker, or
+// BreakerClosed if none is configured.
+func (c *Client) BreakerState() BreakerState {
+	if c.breaker == nil {
+		return BreakerClosed
+	}
+	return c.breaker.current()
+}
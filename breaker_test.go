@@ -0,0 +1,124 @@
+package redcap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errUnavailable = &Error{Code: ErrCodeServerError, StatusCode: 503}
+
+func TestBreakerTripsOnConsecutiveFailures(t *testing.T) {
+	b := newBreaker(BreakerConfig{ConsecutiveFailures: 3, OpenTimeout: time.Hour}, nil)
+	b.record(errUnavailable)
+	b.record(errUnavailable)
+	b.record(nil)
+	b.record(errUnavailable)
+	b.record(errUnavailable)
+	if s := b.current(); s != BreakerClosed {
+		t.Fatalf("state = %v after a success broke the run, want closed", s)
+	}
+	// A rejection shows the server answering, so it ends the run too
+	b.record(&Error{Code: ErrCodeInvalidRequest, StatusCode: 400})
+	b.record(errUnavailable)
+	b.record(errUnavailable)
+	if s := b.current(); s != BreakerClosed {
+		t.Fatalf("state = %v after a rejection broke the run, want closed", s)
+	}
+	b.record(errUnavailable)
+	if s := b.current(); s != BreakerOpen {
+		t.Fatalf("state = %v, want open", s)
+	}
+
+	err := b.allow(context.Background())
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, errUnavailable) {
+		t.Errorf("allow while open = %v, want a CircuitOpenError wrapping the last failure", err)
+	}
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	b := newBreaker(BreakerConfig{ConsecutiveFailures: -1, FailureRate: 0.5, MinRequests: 4}, nil)
+	for _, err := range []error{nil, errUnavailable, nil} {
+		b.record(err)
+	}
+	if s := b.current(); s != BreakerClosed {
+		t.Fatalf("state = %v before MinRequests, want closed", s)
+	}
+	b.record(errUnavailable)
+	if s := b.current(); s != BreakerOpen {
+		t.Fatalf("state = %v at a 50%% failure rate, want open", s)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		probeErr error
+		wantErr  error
+		want     BreakerState
+	}{
+		{"probe succeeds", nil, nil, BreakerClosed},
+		{"probe fails", errUnavailable, ErrCircuitOpen, BreakerOpen},
+		{"probe rejected", &Error{Code: ErrCodeUnauthorized, StatusCode: 401}, nil, BreakerClosed},
+		{"caller gives up", context.Canceled, context.Canceled, BreakerHalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []string
+			b := newBreaker(BreakerConfig{
+				ConsecutiveFailures: 1,
+				OpenTimeout:         time.Millisecond,
+				OnStateChange: func(from, to BreakerState) {
+					changes = append(changes, from.String()+">"+to.String())
+				},
+			}, func(ctx context.Context) error { return tt.probeErr })
+			b.record(errUnavailable)
+			time.Sleep(2 * time.Millisecond)
+
+			err := b.allow(context.Background())
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("allow = %v, want %v", err, tt.wantErr)
+			}
+			if s := b.current(); s != tt.want {
+				t.Errorf("state = %v, want %v (transitions %v)", s, tt.want, changes)
+			}
+			if changes[0] != "closed>open" || changes[1] != "open>half-open" {
+				t.Errorf("transitions = %v", changes)
+			}
+		})
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	release := make(chan struct{})
+	var probes int
+	b := newBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Millisecond}, func(ctx context.Context) error {
+		probes++
+		<-release
+		return nil
+	})
+	b.record(errUnavailable)
+	time.Sleep(2 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := b.allow(context.Background()); err != nil {
+			t.Errorf("probing caller: %v", err)
+		}
+	}()
+	for b.current() != BreakerHalfOpen {
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.allow(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second caller during the probe = %v, want fail fast", err)
+	}
+	close(release)
+	wg.Wait()
+	if probes != 1 || b.current() != BreakerClosed {
+		t.Errorf("probes = %d, state = %v", probes, b.current())
+	}
+}
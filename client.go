@@ -1,6 +1,7 @@
 package redcap
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,8 +9,11 @@ import (
 	"io"
 	"math"
 	"math/rand"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -53,11 +57,16 @@ func WithRateLimiter(r RateLimiter) Option {
 type Client struct {
 	baseURL     string
 	token       string
+	tokenSource TokenSource
 	httpClient  *http.Client
 	rateLimiter RateLimiter
+	retryPolicy RetryPolicy
+	breaker     *breaker
 	maxRetries  int
-	retryDelay  time.Duration
-	logLevel    string
+	// maxResponseSize caps response bodies; zero or less means no cap.
+	maxResponseSize int64
+	retryDelay      time.Duration
+	logLevel        string
 }
 
 func NewClient(baseURL, token string, opts ...Option) (*Client, error) {
@@ -66,13 +75,15 @@ func NewClient(baseURL, token string, opts ...Option) (*Client, error) {
 	}
 
 	c := &Client{
-		baseURL:     baseURL,
-		token:       token,
-		httpClient:  hc,
-		rateLimiter: NewRateLimiterWithDefaultOpts(),
-		maxRetries:  DefaultMaxRetries,
-		retryDelay:  DefaultRetryDelay,
-		logLevel:    "info",
+		baseURL:         baseURL,
+		token:           token,
+		httpClient:      hc,
+		rateLimiter:     NewRateLimiterWithDefaultOpts(),
+		retryPolicy:     DefaultRetryPolicy{},
+		maxResponseSize: DefaultMaxResponseSize,
+		maxRetries:      DefaultMaxRetries,
+		retryDelay:      DefaultRetryDelay,
+		logLevel:        "info",
 	}
 
 	for _, opt := range opts {
@@ -84,15 +95,47 @@ func NewClient(baseURL, token string, opts ...Option) (*Client, error) {
 	return c, nil
 }
 
+// BaseURL returns the API endpoint the client talks to.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
 // Request makes a REDCap API request with retry logic and rate limiting.
 // The content parameter specifies the API endpoint (e.g., "record", "metadata").
 // Additional params are merged with the standard parameters (token, content).
 func (c *Client) Request(ctx context.Context, content string, params map[string]string) ([]byte, error) {
+	resp, err := c.request(ctx, content, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+// response is the body and headers of a successful API call.
+type response struct {
+	body   []byte
+	header http.Header
+}
+
+// upload is a file sent with a request as multipart form data.
+type upload struct {
+	filename string
+	data     []byte
+}
+
+// request is Request with access to the response headers and an optional
+// file upload.
+func (c *Client) request(ctx context.Context, content string, params map[string]string, up *upload) (*response, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= c.maxRetries; attempt++ {
 		if attempt > 0 {
 			delay := c.calculateBackoff(attempt)
+			// The server knows better than our backoff curve
+			var redcapErr *Error
+			if errors.As(lastErr, &redcapErr) && redcapErr.RetryAfter > delay {
+				delay = redcapErr.RetryAfter
+			}
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
@@ -100,6 +143,12 @@ func (c *Client) Request(ctx context.Context, content string, params map[string]
 			}
 		}
 
+		if c.breaker != nil {
+			if err := c.breaker.allow(ctx); err != nil {
+				return nil, err
+			}
+		}
+
 		// Wait for rate limiter
 		if err := c.rateLimiter.Wait(ctx); err != nil {
 			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
@@ -108,36 +157,66 @@ func (c *Client) Request(ctx context.Context, content string, params map[string]
 			continue
 		}
 
-		body, err := c.doRequest(ctx, content, params)
+		resp, sent, err := c.doRequest(ctx, content, params, up)
+		if c.breaker != nil {
+			c.breaker.record(err)
+		}
 		if err == nil {
-			return body, nil
+			if al, ok := c.rateLimiter.(AdaptiveRateLimiter); ok {
+				al.OnSuccess()
+			}
+			return resp, nil
 		}
 
 		lastErr = err
 
-		// Check if we should retry
 		var redcapErr *Error
-		if errors.As(err, &redcapErr) {
-			if !redcapErr.IsRetryable() {
-				return nil, err
-			}
-			// Rate limited - maybe increase delay
-			if redcapErr.Code == ErrCodeRateLimit {
-				c.rateLimiter.SetRate(c.rateLimiter.GetRate() * 0.8)
-			}
-		} else if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		if errors.As(err, &redcapErr) && redcapErr.Code == ErrCodeRateLimit {
+			c.throttle(redcapErr.RetryAfter)
+		}
+
+		// Check if we should retry
+		if attempt == c.maxRetries {
+			break
+		}
+		if !c.retryPolicy.ShouldRetry(ctx, newRetryRequest(content, params, attempt+1, err, sent)) {
 			return nil, err
 		}
-		// Network errors are retryable
 	}
 
 	return nil, lastErr
 }
 
-// doRequest performs a single HTTP request to the REDCap API.
-func (c *Client) doRequest(ctx context.Context, content string, params map[string]string) ([]byte, error) {
+// newRetryRequest describes a failed attempt for the retry policy.
+func newRetryRequest(content string, params map[string]string, attempt int, err error, sent bool) *RetryRequest {
+	if content == "" {
+		content = params["content"]
+	}
+	action := params["action"]
+	if action == "" {
+		action = "export"
+	}
+	return &RetryRequest{
+		Content:  content,
+		Action:   action,
+		Params:   params,
+		Attempt:  attempt,
+		Err:      err,
+		BodySent: sent,
+	}
+}
+
+// doRequest performs a single HTTP request to the REDCap API. It also
+// reports whether the request was fully written to the server. With an
+// upload the form is sent as multipart/form-data.
+func (c *Client) doRequest(ctx context.Context, content string, params map[string]string, up *upload) (*response, bool, error) {
+	token, err := c.resolveToken(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
 	form := url.Values{}
-	form.Add("token", c.token)
+	form.Add("token", token)
 	form.Add("returnFormat", "json")
 	if content != "" {
 		form.Add("content", content)
@@ -148,28 +227,60 @@ func (c *Client) doRequest(ctx context.Context, content string, params map[strin
 		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL, strings.NewReader(form.Encode()))
+	var sent bool
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			sent = info.Err == nil
+		},
+	}
+	ctx = httptrace.WithClientTrace(ctx, trace)
+
+	reqBody, contentType, err := encodeForm(form, up)
+	if err != nil {
+		return nil, false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL, reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, false, fmt.Errorf("creating request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Accept", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, sent, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(resp, c.responseLimit(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("reading response body: %w", err)
+		var respErr *ResponseError
+		if errors.As(err, &respErr) {
+			return nil, true, respErr
+		}
+		return nil, true, fmt.Errorf("reading response body: %w", err)
+	}
+
+	// An HTML page where JSON was expected is a login, maintenance or
+	// proxy page, not REDCap
+	var htmlErr error
+	if expectsJSON(content, params) {
+		htmlErr = checkHTML(resp, body)
 	}
 
 	// Check for REDCap API errors
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.parseError(resp.StatusCode, body)
+		apiErr := c.parseError(resp.StatusCode, body)
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if htmlErr != nil {
+			apiErr.Message = htmlErr.Error()
+			apiErr.Err = htmlErr
+		}
+		return nil, true, apiErr
+	}
+	if htmlErr != nil {
+		return nil, true, htmlErr
 	}
 
 	// Check for error in response body (REDCap sometimes returns errors as JSON with 200)
@@ -177,14 +288,45 @@ func (c *Client) doRequest(ctx context.Context, content string, params map[strin
 		Error string `json:"error"`
 	}
 	if json.Unmarshal(body, &apiErr); apiErr.Error != "" {
-		return nil, &Error{
+		e := &Error{
 			Code:       ErrCodeInvalidRequest,
 			Message:    apiErr.Error,
 			StatusCode: resp.StatusCode,
 		}
+		e.classify()
+		return nil, true, e
 	}
 
-	return body, nil
+	return &response{body: body, header: resp.Header}, true, nil
+}
+
+// encodeForm encodes the request form, as multipart/form-data when a file
+// is attached and URL-encoded otherwise.
+func encodeForm(form url.Values, up *upload) (io.Reader, string, error) {
+	if up == nil {
+		return strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, vs := range form {
+		for _, v := range vs {
+			if err := mw.WriteField(k, v); err != nil {
+				return nil, "", fmt.Errorf("encoding form: %w", err)
+			}
+		}
+	}
+	fw, err := mw.CreateFormFile("file", up.filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("encoding form: %w", err)
+	}
+	if _, err := fw.Write(up.data); err != nil {
+		return nil, "", fmt.Errorf("encoding form: %w", err)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", fmt.Errorf("encoding form: %w", err)
+	}
+	return &buf, mw.FormDataContentType(), nil
 }
 
 // parseError converts an HTTP response into a redcap.Error.
@@ -218,11 +360,58 @@ func (c *Client) parseError(statusCode int, body []byte) *Error {
 		code = ErrCodeServerError
 	}
 
-	return &Error{
+	e := &Error{
 		Code:       code,
 		Message:    message,
 		StatusCode: statusCode,
 	}
+	if code != ErrCodeRateLimit && code != ErrCodeServerError {
+		e.classify()
+	}
+	return e
+}
+
+// throttle slows the rate limiter down after a 429. Adaptive limiters
+// handle their own decrease and recovery; for any other limiter the rate
+// is cut once, but never below DefaultMinRPS.
+func (c *Client) throttle(retryAfter time.Duration) {
+	if al, ok := c.rateLimiter.(AdaptiveRateLimiter); ok {
+		al.OnThrottle(retryAfter)
+		return
+	}
+	c.rateLimiter.SetRate(max(c.rateLimiter.GetRate()*DefaultDecreaseFactor, DefaultMinRPS))
+}
+
+// RateLimiterState reports the state of the client's rate limiter. The
+// second return value is false if the limiter is not adaptive.
+func (c *Client) RateLimiterState() (LimiterState, bool) {
+	al, ok := c.rateLimiter.(AdaptiveRateLimiter)
+	if !ok {
+		return LimiterState{Rate: c.rateLimiter.GetRate()}, false
+	}
+	return al.State(), true
+}
+
+// parseRetryAfter interprets a Retry-After header, which is either a
+// number of seconds or an HTTP-date. It returns zero if the header is
+// missing, malformed or in the past.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
 }
 
 // calculateBackoff returns the delay for exponential backoff with jitter.
@@ -0,0 +1,83 @@
+package redcap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testToken = "ABCDEF0123456789ABCDEF0123456789"
+
+// newTestClient returns a client for a test server running h, with fast
+// retries and a rate limit that does not slow tests down.
+func newTestClient(t *testing.T, h http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	opts = append([]Option{
+		WithRetryDelay(time.Millisecond),
+		WithRateLimiter(NewRateLimiter(1000, 1000)),
+	}, opts...)
+	c, err := NewClient(srv.URL, testToken, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{" 10 ", 10 * time.Second},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRequestHonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"slow down"}`))
+			return
+		}
+		w.Write([]byte(`"14.0.1"`))
+	})
+
+	start := time.Now()
+	if _, err := c.Request(context.Background(), "version", nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %v, want the 1s Retry-After", elapsed)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+	state, ok := c.RateLimiterState()
+	if !ok {
+		t.Fatal("default limiter is not adaptive")
+	}
+	if state.Throttles != 1 || state.Rate != 500 {
+		t.Errorf("limiter after a 429 = %+v, want 1 throttle at 500 rps", state)
+	}
+}
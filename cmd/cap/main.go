@@ -1,12 +1,20 @@
 /*
-This will a cli tool for exports and imports in various file formats
+Command cap is a CLI tool for REDCap exports and imports in various file
+formats. Run `cap help` for the list of commands.
 */
 package main
 
 import (
-	"fmt"
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/cjodo/go-cap/internal/cli"
 )
 
 func main() {
-	fmt.Println("CLI not yet implemented")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := cli.Run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
 }
@@ -0,0 +1,206 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// DAG represents a Data Access Group.
+type DAG struct {
+	// UniqueGroupName is REDCap's generated name, such as "site_a". Leave
+	// it empty to create a group on import.
+	UniqueGroupName string `json:"unique_group_name"`
+	GroupName       string `json:"data_access_group_name"`
+	// ID is the group's numeric ID; it is not imported.
+	ID int `json:"data_access_group_id,omitempty"`
+}
+
+// UnmarshalJSON decodes a group from REDCap's DAG export, which names the
+// group data_access_group_name, or group_name on older versions.
+func (d *DAG) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		UniqueGroupName jsonText `json:"unique_group_name"`
+		Name            jsonText `json:"data_access_group_name"`
+		OldName         jsonText `json:"group_name"`
+		ID              jsonText `json:"data_access_group_id"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*d = DAG{
+		UniqueGroupName: string(raw.UniqueGroupName),
+		GroupName:       string(raw.Name),
+	}
+	if d.GroupName == "" {
+		d.GroupName = string(raw.OldName)
+	}
+	d.ID, _ = strconv.Atoi(string(raw.ID))
+	return nil
+}
+
+// MarshalJSON encodes the group in REDCap's DAG import shape.
+func (d DAG) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"data_access_group_name": d.GroupName,
+		"unique_group_name":      d.UniqueGroupName,
+	})
+}
+
+// UserDAGMapping assigns a user to a data access group.
+type UserDAGMapping struct {
+	Username string `json:"username"`
+	// DataAccessGroup is the group's unique name, or empty for no group.
+	DataAccessGroup string `json:"redcap_data_access_group"`
+}
+
+// ExportDAGs returns the list of Data Access Groups.
+func (c *Client) ExportDAGs(ctx context.Context) ([]DAG, error) {
+	body, err := c.Request(ctx, "dag", map[string]string{
+		"format": "json",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var dags []DAG
+	if err := json.Unmarshal(body, &dags); err != nil {
+		return nil, fmt.Errorf("unmarshaling DAGs: %w", err)
+	}
+
+	return dags, nil
+}
+
+// ImportDAGs creates or renames groups and returns the number imported.
+// Groups without a UniqueGroupName are created, and REDCap derives their
+// unique names from GroupName.
+func (c *Client) ImportDAGs(ctx context.Context, dags []DAG) (int, error) {
+	data, err := json.Marshal(dags)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling DAGs: %w", err)
+	}
+	return c.importJSON(ctx, "dag", data, map[string]string{"action": "import"})
+}
+
+// DeleteDAGs deletes groups by unique name and returns the number
+// deleted. Records and users in a deleted group are left unassigned.
+func (c *Client) DeleteDAGs(ctx context.Context, uniqueGroupNames []string) (int, error) {
+	return c.deleteList(ctx, "dag", "dags", uniqueGroupNames)
+}
+
+// ExportUserDAGMapping returns each user's data access group.
+func (c *Client) ExportUserDAGMapping(ctx context.Context) ([]UserDAGMapping, error) {
+	body, err := c.Request(ctx, "userDagMapping", map[string]string{
+		"format": "json",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []UserDAGMapping
+	if err := json.Unmarshal(body, &mappings); err != nil {
+		return nil, fmt.Errorf("unmarshaling user DAG mapping: %w", err)
+	}
+
+	return mappings, nil
+}
+
+// ImportUserDAGMapping assigns users to groups and returns the number of
+// users assigned. An empty DataAccessGroup takes a user out of their
+// group.
+func (c *Client) ImportUserDAGMapping(ctx context.Context, mappings []UserDAGMapping) (int, error) {
+	data, err := json.Marshal(mappings)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling user DAG mapping: %w", err)
+	}
+	return c.importJSON(ctx, "userDagMapping", data, map[string]string{"action": "import"})
+}
+
+// AssignUserToDAG assigns one user to a group by unique name, or takes
+// them out of their group when dag is empty.
+func (c *Client) AssignUserToDAG(ctx context.Context, username, dag string) error {
+	_, err := c.ImportUserDAGMapping(ctx, []UserDAGMapping{{Username: username, DataAccessGroup: dag}})
+	return err
+}
+
+// SwitchDAG moves the API user into another of the groups they are
+// assigned to, so that later requests with the same token see that
+// group's records.
+func (c *Client) SwitchDAG(ctx context.Context, dag string) error {
+	body, err := c.Request(ctx, "dag", map[string]string{
+		"action": "switch",
+		"dag":    dag,
+	})
+	if err != nil {
+		return err
+	}
+	if string(body) != "1" {
+		return errors.New("switching DAG: unexpected response " + strconv.Quote(string(body)))
+	}
+	return nil
+}
+
+// AssignRecordsToDAG moves records into a group by importing their
+// redcap_data_access_group column, or takes them out of their group when
+// dag is empty. On longitudinal projects each record is assigned through
+// its first event.
+func (c *Client) AssignRecordsToDAG(ctx context.Context, dag string, records []string) (*ImportResult, error) {
+	if len(records) == 0 {
+		return &ImportResult{}, nil
+	}
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting metadata: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("project has no fields")
+	}
+	idField := fields[0].Field_name
+
+	body, err := c.Request(ctx, "", map[string]string{
+		"content": "record",
+		"format":  "json",
+		"type":    "flat",
+		"fields":  idField,
+		"records": commaJoin(records),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("unmarshaling records: %w", err)
+	}
+
+	// One row per record carries the assignment
+	seen := make(map[string]bool, len(records))
+	var assign []map[string]any
+	for _, row := range rows {
+		id := fmt.Sprint(row[idField])
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		a := map[string]any{
+			idField:                    id,
+			"redcap_data_access_group": dag,
+		}
+		if ev, ok := row["redcap_event_name"]; ok {
+			a["redcap_event_name"] = ev
+		}
+		assign = append(assign, a)
+	}
+	for _, id := range records {
+		if !seen[id] {
+			return nil, fmt.Errorf("record %q does not exist", id)
+		}
+	}
+
+	data, err := json.Marshal(assign)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling records: %w", err)
+	}
+	return c.ImportRecordsRaw(ctx, data, ImportOverwriteBehavior("overwrite"))
+}
@@ -0,0 +1,332 @@
+package redcap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LongitudinalDesign is the arms, events and form-event mapping of a
+// longitudinal project, as exported by ExportLongitudinalDesign or
+// declared in a template.
+type LongitudinalDesign struct {
+	Arms   []Arm   `json:"arms"`
+	Events []Event `json:"events"`
+	// Mappings name events by unique name. The arm number may be left
+	// out; it is taken from the event. Nil leaves the mapping as it is.
+	Mappings []FormEventMapping `json:"mappings"`
+}
+
+// ExportLongitudinalDesign returns the project's arms, events and
+// form-event mapping.
+func (c *Client) ExportLongitudinalDesign(ctx context.Context) (*LongitudinalDesign, error) {
+	arms, err := c.ExportArms(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting arms: %w", err)
+	}
+	events, err := c.ExportEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting events: %w", err)
+	}
+	mappings, err := c.ExportFormEventMapping(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting form-event mapping: %w", err)
+	}
+	return &LongitudinalDesign{Arms: arms, Events: events, Mappings: mappings}, nil
+}
+
+// DesignPlan is the set of changes that turns a project's longitudinal
+// design into the desired one.
+type DesignPlan struct {
+	AddArms      []Arm
+	RenameArms   []Arm
+	DeleteArms   []int
+	AddEvents    []Event
+	UpdateEvents []Event
+	// DeleteEvents leaves out events of deleted arms, which go with
+	// their arm.
+	DeleteEvents []string
+	// Mappings is the complete desired mapping, or nil when it is
+	// unchanged. MappingsAdded and MappingsRemoved describe the change.
+	Mappings        []FormEventMapping
+	MappingsAdded   []FormEventMapping
+	MappingsRemoved []FormEventMapping
+}
+
+// Empty reports whether the plan makes no changes.
+func (p *DesignPlan) Empty() bool {
+	return len(p.AddArms) == 0 && len(p.RenameArms) == 0 && len(p.DeleteArms) == 0 &&
+		len(p.AddEvents) == 0 && len(p.UpdateEvents) == 0 && len(p.DeleteEvents) == 0 &&
+		p.Mappings == nil
+}
+
+// Destructive reports whether the plan deletes arms or events, and with
+// them any data collected in those events.
+func (p *DesignPlan) Destructive() bool {
+	return len(p.DeleteArms) > 0 || len(p.DeleteEvents) > 0
+}
+
+// Changes describes the plan, one change per line, in the order applied.
+func (p *DesignPlan) Changes() []string {
+	var lines []string
+	for _, a := range p.AddArms {
+		lines = append(lines, fmt.Sprintf("add arm %d %q", a.ArmNum, a.Name))
+	}
+	for _, a := range p.RenameArms {
+		lines = append(lines, fmt.Sprintf("rename arm %d to %q", a.ArmNum, a.Name))
+	}
+	for _, e := range p.AddEvents {
+		lines = append(lines, fmt.Sprintf("add event %q to arm %d", e.Name, e.ArmNum))
+	}
+	for _, e := range p.UpdateEvents {
+		lines = append(lines, fmt.Sprintf("update event %s", e.UniqueEventName))
+	}
+	for _, m := range p.MappingsAdded {
+		lines = append(lines, fmt.Sprintf("map %s to %s", m.FormName, m.UniqueEventName))
+	}
+	for _, m := range p.MappingsRemoved {
+		lines = append(lines, fmt.Sprintf("unmap %s from %s", m.FormName, m.UniqueEventName))
+	}
+	for _, name := range p.DeleteEvents {
+		lines = append(lines, "delete event "+name)
+	}
+	for _, n := range p.DeleteArms {
+		lines = append(lines, fmt.Sprintf("delete arm %d", n))
+	}
+	return lines
+}
+
+// DiffLongitudinalDesign plans the changes from current to desired.
+// Arms match by number. Desired events match by unique name when they
+// have one, otherwise by arm and name; their offsets are compared only
+// when set. Mappings of events to be added must use the unique name
+// REDCap will derive, such as "week_2_arm_1".
+func DiffLongitudinalDesign(current, desired *LongitudinalDesign) (*DesignPlan, error) {
+	p := &DesignPlan{}
+
+	arms := make(map[int]Arm, len(current.Arms))
+	for _, a := range current.Arms {
+		arms[a.ArmNum] = a
+	}
+	wantArms := make(map[int]bool, len(desired.Arms))
+	for _, a := range desired.Arms {
+		if wantArms[a.ArmNum] {
+			return nil, fmt.Errorf("arm %d is declared twice", a.ArmNum)
+		}
+		wantArms[a.ArmNum] = true
+		cur, ok := arms[a.ArmNum]
+		switch {
+		case !ok:
+			p.AddArms = append(p.AddArms, a)
+		case cur.Name != a.Name:
+			p.RenameArms = append(p.RenameArms, a)
+		}
+	}
+	for _, a := range current.Arms {
+		if !wantArms[a.ArmNum] {
+			p.DeleteArms = append(p.DeleteArms, a.ArmNum)
+		}
+	}
+
+	byUnique := make(map[string]Event, len(current.Events))
+	byName := make(map[string]Event, len(current.Events))
+	for _, e := range current.Events {
+		byUnique[e.UniqueEventName] = e
+		byName[eventKey(e)] = e
+	}
+	// eventArm gives the arm of each desired event, for mappings
+	eventArm := make(map[string]int)
+	kept := make(map[string]bool, len(current.Events))
+	for _, e := range desired.Events {
+		if !wantArms[e.ArmNum] {
+			return nil, fmt.Errorf("event %q is in undeclared arm %d", e.Name, e.ArmNum)
+		}
+		cur, ok := byUnique[e.UniqueEventName]
+		if e.UniqueEventName == "" {
+			cur, ok = byName[eventKey(e)]
+		}
+		if !ok {
+			if e.UniqueEventName != "" {
+				eventArm[e.UniqueEventName] = e.ArmNum
+			}
+			e.UniqueEventName = ""
+			p.AddEvents = append(p.AddEvents, e)
+			continue
+		}
+		if kept[cur.UniqueEventName] {
+			return nil, fmt.Errorf("event %s is declared twice", cur.UniqueEventName)
+		}
+		kept[cur.UniqueEventName] = true
+		eventArm[cur.UniqueEventName] = e.ArmNum
+		if cur.ArmNum != e.ArmNum {
+			return nil, fmt.Errorf("event %s cannot move from arm %d to arm %d", cur.UniqueEventName, cur.ArmNum, e.ArmNum)
+		}
+		if update, changed := eventUpdate(cur, e); changed {
+			p.UpdateEvents = append(p.UpdateEvents, update)
+		}
+	}
+	for _, e := range current.Events {
+		if !kept[e.UniqueEventName] && wantArms[e.ArmNum] {
+			p.DeleteEvents = append(p.DeleteEvents, e.UniqueEventName)
+		}
+	}
+
+	if desired.Mappings == nil {
+		return p, nil
+	}
+	have := make(map[FormEventMapping]bool, len(current.Mappings))
+	for _, m := range current.Mappings {
+		m.ArmNum = 0
+		if kept[m.UniqueEventName] {
+			have[m] = true
+		}
+	}
+	want := make(map[FormEventMapping]bool, len(desired.Mappings))
+	mappings := make([]FormEventMapping, 0, len(desired.Mappings))
+	for _, m := range desired.Mappings {
+		arm, ok := eventArm[m.UniqueEventName]
+		if !ok && len(p.AddEvents) == 0 {
+			return nil, fmt.Errorf("mapping of %s names undeclared event %s", m.FormName, m.UniqueEventName)
+		}
+		key := FormEventMapping{FormName: m.FormName, UniqueEventName: m.UniqueEventName}
+		if want[key] {
+			continue
+		}
+		want[key] = true
+		if !have[key] {
+			p.MappingsAdded = append(p.MappingsAdded, key)
+		}
+		if m.ArmNum == 0 {
+			m.ArmNum = arm
+		}
+		mappings = append(mappings, m)
+	}
+	for key := range have {
+		if !want[key] {
+			p.MappingsRemoved = append(p.MappingsRemoved, key)
+		}
+	}
+	sortMappings(p.MappingsAdded)
+	sortMappings(p.MappingsRemoved)
+	if len(p.MappingsAdded) > 0 || len(p.MappingsRemoved) > 0 {
+		p.Mappings = mappings
+	}
+	return p, nil
+}
+
+// eventKey identifies an event by arm and name, ignoring case.
+func eventKey(e Event) string {
+	return strconv.Itoa(e.ArmNum) + "\x00" + strings.ToLower(strings.TrimSpace(e.Name))
+}
+
+// eventUpdate returns cur with the name and offsets set in want, and
+// whether that changes it.
+func eventUpdate(cur, want Event) (Event, bool) {
+	changed := false
+	if want.Name != "" && want.Name != cur.Name {
+		cur.Name, changed = want.Name, true
+	}
+	for _, f := range []struct{ cur, want *string }{
+		{&cur.DayOffset, &want.DayOffset},
+		{&cur.OffsetMin, &want.OffsetMin},
+		{&cur.OffsetMax, &want.OffsetMax},
+	} {
+		if *f.want != "" && !sameNumber(*f.cur, *f.want) {
+			*f.cur, changed = *f.want, true
+		}
+	}
+	return cur, changed
+}
+
+// sameNumber compares offsets numerically, so "1" equals "1.0".
+func sameNumber(a, b string) bool {
+	x, errA := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	y, errB := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return x == y
+}
+
+func sortMappings(m []FormEventMapping) {
+	sort.Slice(m, func(i, j int) bool {
+		if m[i].UniqueEventName != m[j].UniqueEventName {
+			return m[i].UniqueEventName < m[j].UniqueEventName
+		}
+		return m[i].FormName < m[j].FormName
+	})
+}
+
+// ApplyDesignPlan makes the plan's changes in dependency order: arms,
+// events, the form-event mapping, then event and arm deletions. Mappings
+// of new events are checked against the unique names REDCap derived.
+func (c *Client) ApplyDesignPlan(ctx context.Context, p *DesignPlan) error {
+	if arms := append(append([]Arm{}, p.AddArms...), p.RenameArms...); len(arms) > 0 {
+		if _, err := c.ImportArms(ctx, arms, false); err != nil {
+			return fmt.Errorf("importing arms: %w", err)
+		}
+	}
+	if events := append(append([]Event{}, p.AddEvents...), p.UpdateEvents...); len(events) > 0 {
+		if _, err := c.ImportEvents(ctx, events, false); err != nil {
+			return fmt.Errorf("importing events: %w", err)
+		}
+	}
+
+	if p.Mappings != nil {
+		if len(p.AddEvents) > 0 {
+			events, err := c.ExportEvents(ctx)
+			if err != nil {
+				return fmt.Errorf("exporting events: %w", err)
+			}
+			arm := make(map[string]int, len(events))
+			for _, e := range events {
+				arm[e.UniqueEventName] = e.ArmNum
+			}
+			for i, m := range p.Mappings {
+				n, ok := arm[m.UniqueEventName]
+				if !ok {
+					return fmt.Errorf("mapping of %s names event %s, which REDCap did not create", m.FormName, m.UniqueEventName)
+				}
+				if m.ArmNum == 0 {
+					p.Mappings[i].ArmNum = n
+				}
+			}
+		}
+		if _, err := c.ImportFormEventMapping(ctx, p.Mappings); err != nil {
+			return fmt.Errorf("importing form-event mapping: %w", err)
+		}
+	}
+
+	if len(p.DeleteEvents) > 0 {
+		if _, err := c.DeleteEvents(ctx, p.DeleteEvents); err != nil {
+			return fmt.Errorf("deleting events: %w", err)
+		}
+	}
+	if len(p.DeleteArms) > 0 {
+		if _, err := c.DeleteArms(ctx, p.DeleteArms); err != nil {
+			return fmt.Errorf("deleting arms: %w", err)
+		}
+	}
+	return nil
+}
+
+// ApplyLongitudinalDesign brings the project's arms, events and
+// form-event mapping to desired with the fewest changes, and returns the
+// plan it applied. It deletes arms and events, and their data, that
+// desired leaves out; check DiffLongitudinalDesign first to avoid that.
+func (c *Client) ApplyLongitudinalDesign(ctx context.Context, desired *LongitudinalDesign) (*DesignPlan, error) {
+	current, err := c.ExportLongitudinalDesign(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := DiffLongitudinalDesign(current, desired)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.ApplyDesignPlan(ctx, p); err != nil {
+		return p, err
+	}
+	return p, nil
+}
@@ -0,0 +1,122 @@
+package redcap
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testDesign() *LongitudinalDesign {
+	return &LongitudinalDesign{
+		Arms: []Arm{{ArmNum: 1, Name: "Drug"}, {ArmNum: 2, Name: "Placebo"}},
+		Events: []Event{
+			{Name: "Baseline", ArmNum: 1, DayOffset: "0", OffsetMin: "0", OffsetMax: "0", UniqueEventName: "baseline_arm_1"},
+			{Name: "Week 1", ArmNum: 1, DayOffset: "7", OffsetMin: "1", OffsetMax: "1", UniqueEventName: "week_1_arm_1"},
+			{Name: "Baseline", ArmNum: 2, DayOffset: "0", UniqueEventName: "baseline_arm_2"},
+		},
+		Mappings: []FormEventMapping{
+			{ArmNum: 1, FormName: "demo", UniqueEventName: "baseline_arm_1"},
+			{ArmNum: 1, FormName: "visit", UniqueEventName: "week_1_arm_1"},
+			{ArmNum: 2, FormName: "demo", UniqueEventName: "baseline_arm_2"},
+		},
+	}
+}
+
+func TestDiffLongitudinalDesignUnchanged(t *testing.T) {
+	// Events matched by name and offsets written differently are the same
+	desired := testDesign()
+	desired.Events[1].UniqueEventName = ""
+	desired.Events[1].Name = " week 1"
+	desired.Events[1].DayOffset = "7.0"
+	desired.Events[2].DayOffset = ""
+	desired.Mappings = nil
+
+	p, err := DiffLongitudinalDesign(testDesign(), desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.UpdateEvents) != 1 || p.UpdateEvents[0].Name != " week 1" {
+		t.Fatalf("updates = %+v, want only the rename of week 1", p.UpdateEvents)
+	}
+	p.UpdateEvents = nil
+	if !p.Empty() {
+		t.Errorf("plan = %v, want empty", p.Changes())
+	}
+}
+
+func TestDiffLongitudinalDesign(t *testing.T) {
+	desired := testDesign()
+	desired.Arms = []Arm{{ArmNum: 1, Name: "Active drug"}, {ArmNum: 3, Name: "Open label"}}
+	desired.Events = []Event{
+		{Name: "Baseline", ArmNum: 1, UniqueEventName: "baseline_arm_1"},
+		{Name: "Week 2", ArmNum: 1, DayOffset: "14"},
+		{Name: "Screening", ArmNum: 3},
+	}
+	desired.Mappings = []FormEventMapping{
+		{FormName: "demo", UniqueEventName: "baseline_arm_1"},
+		{FormName: "visit", UniqueEventName: "baseline_arm_1"},
+		{FormName: "visit", UniqueEventName: "week_2_arm_1"},
+	}
+
+	p, err := DiffLongitudinalDesign(testDesign(), desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`add arm 3 "Open label"`,
+		`rename arm 1 to "Active drug"`,
+		`add event "Week 2" to arm 1`,
+		`add event "Screening" to arm 3`,
+		"map visit to baseline_arm_1",
+		"map visit to week_2_arm_1",
+		"delete event week_1_arm_1",
+		"delete arm 2",
+	}
+	if got := p.Changes(); !slices.Equal(got, want) {
+		t.Errorf("changes =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !p.Destructive() {
+		t.Error("plan deleting an arm is not destructive")
+	}
+	// The mapping of week 1 goes with its event and is not listed
+	if len(p.MappingsRemoved) != 0 {
+		t.Errorf("removed mappings = %v", p.MappingsRemoved)
+	}
+	if len(p.Mappings) != 3 || p.Mappings[0].ArmNum != 1 {
+		t.Errorf("mappings = %+v, want 3 with arm numbers filled in", p.Mappings)
+	}
+}
+
+func TestDiffLongitudinalDesignErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(d *LongitudinalDesign)
+		want   string
+	}{
+		{"duplicate arm", func(d *LongitudinalDesign) {
+			d.Arms = append(d.Arms, Arm{ArmNum: 1, Name: "Again"})
+		}, "arm 1 is declared twice"},
+		{"undeclared arm", func(d *LongitudinalDesign) {
+			d.Events = append(d.Events, Event{Name: "Follow-up", ArmNum: 5})
+		}, "undeclared arm 5"},
+		{"duplicate event", func(d *LongitudinalDesign) {
+			d.Events = append(d.Events, Event{Name: "baseline", ArmNum: 1})
+		}, "baseline_arm_1 is declared twice"},
+		{"moved event", func(d *LongitudinalDesign) {
+			d.Events[1].ArmNum = 2
+		}, "cannot move from arm 1 to arm 2"},
+		{"unknown mapped event", func(d *LongitudinalDesign) {
+			d.Mappings = append(d.Mappings, FormEventMapping{FormName: "demo", UniqueEventName: "week_9_arm_1"})
+		}, "undeclared event week_9_arm_1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := testDesign()
+			tt.modify(desired)
+			_, err := DiffLongitudinalDesign(testDesign(), desired)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
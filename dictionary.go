@@ -0,0 +1,584 @@
+package redcap
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dictionary indexes a project's data dictionary so record values can be
+// checked and typed by field.
+type Dictionary struct {
+	Fields []Field
+	// RecordIDField is the project's record ID field, the first field in
+	// the dictionary.
+	RecordIDField string
+
+	byName map[string]*Field
+	forms  []string
+}
+
+// NewDictionary builds a Dictionary from ExportMetadata output.
+func NewDictionary(fields []Field) *Dictionary {
+	d := &Dictionary{
+		Fields: fields,
+		byName: make(map[string]*Field, len(fields)),
+	}
+	seen := make(map[string]bool)
+	for i := range fields {
+		f := &fields[i]
+		d.byName[f.Field_name] = f
+		if !seen[f.Form_name] {
+			seen[f.Form_name] = true
+			d.forms = append(d.forms, f.Form_name)
+		}
+	}
+	if len(fields) > 0 {
+		d.RecordIDField = fields[0].Field_name
+	}
+	return d
+}
+
+// Forms returns the instrument names in dictionary order.
+func (d *Dictionary) Forms() []string {
+	return d.forms
+}
+
+// Field returns the dictionary field for a name as it appears in record
+// exports. Checkbox columns ("race___1") resolve to their checkbox field.
+func (d *Dictionary) Field(name string) (*Field, bool) {
+	if f, ok := d.byName[name]; ok {
+		return f, true
+	}
+	if base, _, ok := SplitCheckbox(name); ok {
+		if f, ok := d.byName[base]; ok && f.Field_type == "checkbox" {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// FormFields returns the fields of one instrument in dictionary order.
+func (d *Dictionary) FormFields(form string) []*Field {
+	var out []*Field
+	for i := range d.Fields {
+		if d.Fields[i].Form_name == form {
+			out = append(out, &d.Fields[i])
+		}
+	}
+	return out
+}
+
+// ExportNames returns the column names a record export produces for f:
+// one per choice for checkboxes, none for descriptive fields.
+func (f *Field) ExportNames() []string {
+	switch f.Field_type {
+	case "descriptive":
+		return nil
+	case "checkbox":
+		names := make([]string, len(f.Choices))
+		for i, c := range f.Choices {
+			names[i] = CheckboxColumn(f.Field_name, c.Code)
+		}
+		return names
+	}
+	return []string{f.Field_name}
+}
+
+// CheckboxColumn returns the export column for one checkbox choice.
+// REDCap lowercases the code and replaces characters other than letters,
+// digits and underscores.
+func CheckboxColumn(field, code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(code)
+	return field + "___" + code
+}
+
+// SplitCheckbox splits a checkbox export column into field and code.
+func SplitCheckbox(column string) (field, code string, ok bool) {
+	return strings.Cut(column, "___")
+}
+
+// IsSpecialColumn reports whether column is one REDCap adds to records
+// rather than a dictionary field: event, repeat and DAG columns, survey
+// fields and form completion status.
+func (d *Dictionary) IsSpecialColumn(column string) bool {
+	switch column {
+	case "redcap_event_name", "redcap_repeat_instrument", "redcap_repeat_instance",
+		"redcap_data_access_group", "redcap_survey_identifier":
+		return true
+	}
+	if form, ok := strings.CutSuffix(column, "_complete"); ok {
+		for _, f := range d.forms {
+			if f == form {
+				return true
+			}
+		}
+	}
+	if form, ok := strings.CutSuffix(column, "_timestamp"); ok {
+		for _, f := range d.forms {
+			if f == form {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ColumnType is the type of values in a record export column, as
+// implied by the field type and text validation.
+type ColumnType int
+
+const (
+	ColumnText ColumnType = iota
+	ColumnInteger
+	ColumnNumber
+	ColumnDate
+	ColumnDatetime
+	ColumnTime
+	// ColumnBoolean is a 0/1 column: a checkbox choice, yes/no or
+	// true/false.
+	ColumnBoolean
+	// ColumnCategory is a dropdown or radio code, or a form status.
+	ColumnCategory
+)
+
+// String returns the type name.
+func (t ColumnType) String() string {
+	switch t {
+	case ColumnInteger:
+		return "integer"
+	case ColumnNumber:
+		return "number"
+	case ColumnDate:
+		return "date"
+	case ColumnDatetime:
+		return "datetime"
+	case ColumnTime:
+		return "time"
+	case ColumnBoolean:
+		return "boolean"
+	case ColumnCategory:
+		return "category"
+	}
+	return "text"
+}
+
+// ColumnType returns the type of a record export column. Columns not in
+// the dictionary are text, except repeat instances (integer) and form
+// status columns (category).
+func (d *Dictionary) ColumnType(column string) ColumnType {
+	if column == "redcap_repeat_instance" {
+		return ColumnInteger
+	}
+	if strings.HasSuffix(column, "_complete") && d.byName[column] == nil && d.IsSpecialColumn(column) {
+		return ColumnCategory
+	}
+	f, ok := d.Field(column)
+	if !ok {
+		return ColumnText
+	}
+	switch f.Field_type {
+	case "checkbox", "yesno", "truefalse":
+		return ColumnBoolean
+	case "dropdown", "radio":
+		return ColumnCategory
+	case "slider":
+		return ColumnInteger
+	case "calc":
+		return ColumnNumber
+	case "text":
+		vt := f.ValidationType()
+		switch {
+		case vt == "integer":
+			return ColumnInteger
+		case vt == "number" || strings.HasPrefix(vt, "number_"):
+			return ColumnNumber
+		case strings.HasPrefix(vt, "datetime"):
+			return ColumnDatetime
+		case strings.HasPrefix(vt, "date"):
+			return ColumnDate
+		case vt == "time":
+			return ColumnTime
+		}
+	}
+	return ColumnText
+}
+
+// ColumnLabel returns the field label of a record export column, with the
+// choice label for a checkbox column: "Race (Asian)". Columns not in the
+// dictionary have no label.
+func (d *Dictionary) ColumnLabel(column string) string {
+	f, ok := d.Field(column)
+	if !ok {
+		return ""
+	}
+	label := strings.TrimSpace(f.Field_label)
+	if f.Field_type != "checkbox" {
+		return label
+	}
+	for _, c := range f.Choices {
+		if CheckboxColumn(f.Field_name, c.Code) == column {
+			return label + " (" + c.Label + ")"
+		}
+	}
+	return label
+}
+
+// FormColumns returns the export columns of one instrument in dictionary
+// order, ending with its form status column.
+func (d *Dictionary) FormColumns(form string) []string {
+	var cols []string
+	for _, f := range d.FormFields(form) {
+		cols = append(cols, f.ExportNames()...)
+	}
+	return append(cols, form+"_complete")
+}
+
+// Label headers of the columns REDCap adds to records, as written in CSV
+// exports with rawOrLabelHeaders=label.
+var specialHeaders = map[string]string{
+	"redcap_event_name":        "Event Name",
+	"redcap_repeat_instrument": "Repeat Instrument",
+	"redcap_repeat_instance":   "Repeat Instance",
+	"redcap_data_access_group": "Data Access Group",
+	"redcap_survey_identifier": "Survey Identifier",
+}
+
+var tagRe = regexp.MustCompile(`<[^>]*>`)
+
+// ColumnHeader returns the label header REDCap writes for a column in CSV
+// exports with rawOrLabelHeaders=label: the field label without HTML, and
+// "Label (choice=Choice)" for checkbox columns.
+func (d *Dictionary) ColumnHeader(column string) string {
+	if h, ok := specialHeaders[column]; ok {
+		return h
+	}
+	if d.IsSpecialColumn(column) && d.byName[column] == nil {
+		if strings.HasSuffix(column, "_complete") {
+			return "Complete?"
+		}
+		return "Survey Timestamp"
+	}
+	f, ok := d.Field(column)
+	if !ok {
+		return column
+	}
+	label := strings.TrimSpace(tagRe.ReplaceAllString(f.Field_label, ""))
+	if f.Field_type == "checkbox" {
+		for _, c := range f.Choices {
+			if CheckboxColumn(f.Field_name, c.Code) == column {
+				return label + " (choice=" + c.Label + ")"
+			}
+		}
+	}
+	return label
+}
+
+// HeaderColumns maps the header of a CSV export back to column names.
+// Headers that are already column names are kept; label headers are
+// matched against ColumnHeader. Labels such as "Complete?" are shared by
+// several columns, so each label header takes the first unused column
+// with that label after the previous match, wrapping to the start, which
+// resolves them for exports in dictionary order. Headers that match
+// nothing are returned unchanged.
+func (d *Dictionary) HeaderColumns(headers []string) []string {
+	var columns []string
+	for col := range specialHeaders {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	for _, form := range d.forms {
+		columns = append(columns, form+"_timestamp")
+		columns = append(columns, d.FormColumns(form)...)
+	}
+
+	byHeader := make(map[string][]int)
+	for i, col := range columns {
+		key := headerKey(d.ColumnHeader(col))
+		byHeader[key] = append(byHeader[key], i)
+	}
+
+	out := make([]string, len(headers))
+	used := make(map[int]bool)
+	last := -1
+	for i, h := range headers {
+		out[i] = h
+		if _, ok := d.Field(h); ok || d.IsSpecialColumn(h) {
+			continue
+		}
+		candidates := byHeader[headerKey(h)]
+		pick := -1
+		for _, j := range candidates {
+			if !used[j] && j > last {
+				pick = j
+				break
+			}
+		}
+		if pick < 0 {
+			for _, j := range candidates {
+				if !used[j] {
+					pick = j
+					break
+				}
+			}
+		}
+		if pick >= 0 {
+			used[pick] = true
+			last = pick
+			out[i] = columns[pick]
+		}
+	}
+	return out
+}
+
+// headerKey normalizes a label header for matching.
+func headerKey(h string) string {
+	return strings.ToLower(strings.Join(strings.Fields(h), " "))
+}
+
+// TypedValue converts an exported value to the Go type of its column:
+// int64 for integers, float64 for numbers, time.Time for dates and
+// datetimes, and bool for booleans, whether raw, labelled or exported
+// with exportCheckboxLabel. Other columns, including choice codes and
+// times, are strings. Empty values are nil. A value that does not parse
+// as its type is an error.
+func (d *Dictionary) TypedValue(column, value string) (any, error) {
+	if value == "" {
+		return nil, nil
+	}
+	switch d.ColumnType(column) {
+	case ColumnInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not an integer", column, value)
+		}
+		return n, nil
+	case ColumnNumber:
+		n, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a number", column, value)
+		}
+		return n, nil
+	case ColumnDate:
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a Y-M-D date", column, value)
+		}
+		return t, nil
+	case ColumnDatetime:
+		if t, ok := ParseDatetime(value); ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("%s: %q is not a Y-M-D datetime", column, value)
+	case ColumnBoolean:
+		switch value {
+		case "1", "Checked", "Yes", "True":
+			return true, nil
+		case "0", "Unchecked", "No", "False":
+			return false, nil
+		}
+		// exportCheckboxLabel writes the choice label for checked choices
+		if f, ok := d.Field(column); ok && f.Field_type == "checkbox" {
+			for _, c := range f.Choices {
+				if CheckboxColumn(f.Field_name, c.Code) == column && c.Label == value {
+					return true, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s: %q is not a boolean", column, value)
+	}
+	return value, nil
+}
+
+// Datetime layouts of record exports, with and without seconds.
+var datetimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// ParseDatetime parses a datetime as records export it, with or without
+// seconds.
+func ParseDatetime(value string) (time.Time, bool) {
+	for _, layout := range datetimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ValueText renders a value of a JSON record export as REDCap text.
+// Numbers keep their shortest form and nil is empty.
+func ValueText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// HasData reports whether a record export row has a value in any of
+// columns. Checkbox and form status columns have values even on
+// instruments never entered, so they do not count, and neither do the
+// other columns REDCap adds.
+func (d *Dictionary) HasData(row map[string]any, columns []string) bool {
+	for _, col := range columns {
+		if d.IsSpecialColumn(col) {
+			continue
+		}
+		if f, ok := d.Field(col); ok && f.Field_type == "checkbox" {
+			continue
+		}
+		if ValueText(row[col]) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	dateRe     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	datetimeRe = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}$`)
+	secondsRe  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`)
+	timeRe     = regexp.MustCompile(`^\d{2}:\d{2}$`)
+)
+
+// CheckValue validates one import value for the named column. Dates are
+// expected in the API's Y-M-D import format. An empty value is always
+// valid; REDCap enforces required fields only in the UI.
+func (d *Dictionary) CheckValue(column, value string) error {
+	if value == "" || d.IsSpecialColumn(column) {
+		return nil
+	}
+	f, ok := d.Field(column)
+	if !ok {
+		return fmt.Errorf("field %s is not in the data dictionary", column)
+	}
+
+	switch f.Field_type {
+	case "checkbox":
+		if _, code, _ := SplitCheckbox(column); !hasCheckboxCode(f, code) {
+			return fmt.Errorf("%s is not a choice of %s", code, f.Field_name)
+		}
+		if value != "0" && value != "1" {
+			return fmt.Errorf("checkbox value must be 0 or 1")
+		}
+	case "dropdown", "radio":
+		if _, ok := f.Choice(value); !ok {
+			return fmt.Errorf("%q is not a choice of %s", value, f.Field_name)
+		}
+	case "yesno", "truefalse":
+		if value != "0" && value != "1" {
+			return fmt.Errorf("value must be 0 or 1")
+		}
+	case "slider":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 100 {
+			return fmt.Errorf("slider value must be an integer from 0 to 100")
+		}
+	case "calc", "file", "descriptive":
+		return fmt.Errorf("%s fields cannot be imported", f.Field_type)
+	case "text":
+		return checkValidation(f, value)
+	}
+	return nil
+}
+
+func hasCheckboxCode(f *Field, code string) bool {
+	for _, c := range f.Choices {
+		if CheckboxColumn("", c.Code) == "___"+code {
+			return true
+		}
+	}
+	return false
+}
+
+// checkValidation applies a text field's validation type and range.
+func checkValidation(f *Field, value string) error {
+	vt := f.ValidationType()
+	switch {
+	case vt == "":
+		return nil
+	case vt == "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		return checkRange(f, float64(n))
+	case vt == "number" || strings.HasPrefix(vt, "number_"):
+		n, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		return checkRange(f, n)
+	case strings.HasPrefix(vt, "datetime_seconds"):
+		return checkTime(value, secondsRe, "2006-01-02 15:04:05", "YYYY-MM-DD HH:MM:SS")
+	case strings.HasPrefix(vt, "datetime"):
+		return checkTime(value, datetimeRe, "2006-01-02 15:04", "YYYY-MM-DD HH:MM")
+	case strings.HasPrefix(vt, "date"):
+		return checkTime(value, dateRe, "2006-01-02", "YYYY-MM-DD")
+	case vt == "time":
+		return checkTime(value, timeRe, "15:04", "HH:MM")
+	case vt == "email":
+		if _, err := mail.ParseAddress(value); err != nil {
+			return fmt.Errorf("%q is not an email address", value)
+		}
+	}
+	return nil
+}
+
+func checkRange(f *Field, n float64) error {
+	if f.Text_validation_min != "" {
+		if lo, err := strconv.ParseFloat(f.Text_validation_min, 64); err == nil && n < lo {
+			return fmt.Errorf("%v is below the minimum %s", n, f.Text_validation_min)
+		}
+	}
+	if f.Text_validation_max != "" {
+		if hi, err := strconv.ParseFloat(f.Text_validation_max, 64); err == nil && n > hi {
+			return fmt.Errorf("%v is above the maximum %s", n, f.Text_validation_max)
+		}
+	}
+	return nil
+}
+
+func checkTime(value string, re *regexp.Regexp, layout, want string) error {
+	if !re.MatchString(value) {
+		return fmt.Errorf("%q is not in %s format", value, want)
+	}
+	if _, err := time.Parse(layout, value); err != nil {
+		return fmt.Errorf("%q is not a valid date or time", value)
+	}
+	return nil
+}
+
+// ValidateRows checks flat import rows against the dictionary and
+// returns every problem found, or nil.
+func (d *Dictionary) ValidateRows(rows []map[string]string) ValidationErrors {
+	var errs ValidationErrors
+	for _, row := range rows {
+		id := row[d.RecordIDField]
+		if id == "" {
+			errs = append(errs, ValidationError{
+				Field:   d.RecordIDField,
+				Message: "record ID is missing",
+			})
+		}
+		for column, value := range row {
+			if err := d.CheckValue(column, value); err != nil {
+				errs = append(errs, ValidationError{
+					Record:  id,
+					Field:   column,
+					Value:   value,
+					Message: err.Error(),
+				})
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,134 @@
+package redcap
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func testDictionary() *Dictionary {
+	return NewDictionary([]Field{
+		{Field_name: "record_id", Form_name: "demo", Field_type: "text", Field_label: "Record ID"},
+		{Field_name: "age", Form_name: "demo", Field_type: "text", Field_label: "Age <b>years</b>", Text_validation_type_or_show_slider_number: "integer"},
+		{Field_name: "race", Form_name: "demo", Field_type: "checkbox", Field_label: "Race", Choices: []FieldChoice{{ID: 1, Code: "1", Label: "Asian"}, {ID: 2, Code: "2", Label: "White"}}},
+		{Field_name: "seen", Form_name: "visit", Field_type: "text", Field_label: "Seen", Text_validation_type_or_show_slider_number: "datetime_ymd"},
+		{Field_name: "dob", Form_name: "visit", Field_type: "text", Field_label: "Birth date", Text_validation_type_or_show_slider_number: "date_ymd"},
+		{Field_name: "weight", Form_name: "visit", Field_type: "text", Field_label: "Weight", Text_validation_type_or_show_slider_number: "number"},
+		{Field_name: "consent", Form_name: "visit", Field_type: "yesno", Field_label: "Consent"},
+		{Field_name: "arm", Form_name: "visit", Field_type: "radio", Field_label: "Arm", Choices: []FieldChoice{{ID: 1, Code: "1", Label: "Drug"}}},
+	})
+}
+
+func TestTypedValue(t *testing.T) {
+	d := testDictionary()
+	tests := []struct {
+		column, value string
+		want          any
+		wantErr       bool
+	}{
+		{"age", "", nil, false},
+		{"age", "41", int64(41), false},
+		{"age", "41.5", nil, true},
+		{"weight", "70,5", 70.5, false},
+		{"weight", "heavy", nil, true},
+		{"dob", "2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		{"dob", "03/01/2024", nil, true},
+		{"seen", "2024-03-01 14:30", time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC), false},
+		{"consent", "Yes", true, false},
+		{"consent", "0", false, false},
+		{"race___2", "Checked", true, false},
+		{"race___1", "Asian", true, false},
+		{"race___1", "White", nil, true},
+		{"arm", "Drug", "Drug", false},
+		{"demo_complete", "2", "2", false},
+		{"redcap_repeat_instance", "3", int64(3), false},
+		{"unknown", "x", "x", false},
+	}
+	for _, tt := range tests {
+		got, err := d.TypedValue(tt.column, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("TypedValue(%s, %q) error = %v, want error %v", tt.column, tt.value, err, tt.wantErr)
+			continue
+		}
+		if want, ok := tt.want.(time.Time); ok {
+			if g, _ := got.(time.Time); !g.Equal(want) {
+				t.Errorf("TypedValue(%s, %q) = %v, want %v", tt.column, tt.value, got, want)
+			}
+		} else if got != tt.want {
+			t.Errorf("TypedValue(%s, %q) = %#v, want %#v", tt.column, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderColumns(t *testing.T) {
+	d := testDictionary()
+	headers := []string{
+		"Record ID", "Age  years", "Race (choice=Asian)", "Race (choice=White)", "Complete?",
+		"Seen", "consent", "Complete?", "Event Name", "Not a label",
+	}
+	want := []string{
+		"record_id", "age", "race___1", "race___2", "demo_complete",
+		"seen", "consent", "visit_complete", "redcap_event_name", "Not a label",
+	}
+	got := d.HeaderColumns(headers)
+	if !slices.Equal(got, want) {
+		t.Errorf("HeaderColumns =\n%q\nwant\n%q", got, want)
+	}
+
+	// Shared labels resolve in order even when the report starts later
+	got = d.HeaderColumns([]string{"Seen", "Complete?", "Record ID", "Complete?"})
+	want = []string{"seen", "visit_complete", "record_id", "demo_complete"}
+	if !slices.Equal(got, want) {
+		t.Errorf("HeaderColumns = %q, want %q", got, want)
+	}
+}
+
+func TestHasData(t *testing.T) {
+	d := testDictionary()
+	columns := []string{"age", "race___1", "race___2", "demo_complete"}
+	tests := []struct {
+		name string
+		row  map[string]any
+		want bool
+	}{
+		{"never entered", map[string]any{"age": "", "race___1": "0", "race___2": "0", "demo_complete": "0"}, false},
+		{"status only", map[string]any{"age": nil, "demo_complete": float64(2)}, false},
+		{"value", map[string]any{"age": float64(41), "race___1": "0", "demo_complete": "0"}, true},
+	}
+	for _, tt := range tests {
+		if got := d.HasData(tt.row, columns); got != tt.want {
+			t.Errorf("%s: HasData = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValueText(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{nil, ""},
+		{"abc", "abc"},
+		{float64(3), "3"},
+		{1.25, "1.25"},
+		{float64(1e21), "1000000000000000000000"},
+		{true, "true"},
+	}
+	for _, tt := range tests {
+		if got := ValueText(tt.in); got != tt.want {
+			t.Errorf("ValueText(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDatetime(t *testing.T) {
+	want := time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC)
+	for _, v := range []string{"2024-03-01 14:30", "2024-03-01 14:30:00"} {
+		if got, ok := ParseDatetime(v); !ok || !got.Equal(want) {
+			t.Errorf("ParseDatetime(%q) = %v, %v", v, got, ok)
+		}
+	}
+	if _, ok := ParseDatetime("2024-03-01"); ok {
+		t.Error("ParseDatetime accepted a date")
+	}
+}
@@ -1,6 +1,12 @@
 package redcap
 
-import "fmt"
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Error codes for REDCap API errors
 const (
@@ -18,7 +24,12 @@ type Error struct {
 	Code       string
 	Message    string
 	StatusCode int
-	Err        error
+	// RetryAfter is the delay requested by the server's Retry-After
+	// header, or zero if none was sent.
+	RetryAfter time.Duration
+	// Kind is the sentinel this error was classified as, if any.
+	Kind error
+	Err  error
 }
 
 func (e *Error) Error() string {
@@ -33,3 +44,106 @@ func (e *Error) Unwrap() error {
 func (e *Error) IsRetryable() bool {
 	return e.Code == ErrCodeRateLimit || e.Code == ErrCodeServerError
 }
+
+// Sentinel errors for common REDCap failures. Use errors.Is against an
+// error returned by any Client method.
+var (
+	ErrInvalidToken  = errors.New("redcap: invalid API token")
+	ErrNoAPIRights   = errors.New("redcap: no API rights")
+	ErrInvalidField  = errors.New("redcap: invalid field")
+	ErrInvalidRecord = errors.New("redcap: invalid record")
+	ErrRecordLocked  = errors.New("redcap: record locked")
+	ErrInvalidData   = errors.New("redcap: data values rejected")
+)
+
+// Is reports whether the error was classified as target.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// ValidationError is one rejected value from a failed record import.
+type ValidationError struct {
+	Record  string `json:"record"`
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every value REDCap rejected in an import. It is
+// reachable from a failed import with errors.As.
+type ValidationErrors []ValidationError
+
+func (v ValidationErrors) Error() string {
+	if len(v) == 0 {
+		return "redcap: no validation errors"
+	}
+	first := v[0]
+	msg := fmt.Sprintf("record %s, field %s, value %q: %s", first.Record, first.Field, first.Value, first.Message)
+	if len(v) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(v)-1)
+	}
+	return "redcap: " + msg
+}
+
+func (v ValidationErrors) Is(target error) bool {
+	return target == ErrInvalidData
+}
+
+// parseValidationErrors parses the "record","field","value","message"
+// lines REDCap returns when an import contains invalid values.
+func parseValidationErrors(msg string) ValidationErrors {
+	r := csv.NewReader(strings.NewReader(strings.TrimSpace(msg)))
+	r.FieldsPerRecord = 4
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil
+	}
+	out := make(ValidationErrors, len(rows))
+	for i, row := range rows {
+		out[i] = ValidationError{Record: row[0], Field: row[1], Value: row[2], Message: row[3]}
+	}
+	return out
+}
+
+// classify matches the REDCap error message against known failures and
+// fills in Kind, refining Code where the HTTP status was too coarse.
+func (e *Error) classify() {
+	msg := strings.ToLower(e.Message)
+	switch {
+	case strings.Contains(msg, "token") && (strings.Contains(msg, "invalid") ||
+		strings.Contains(msg, "not valid") ||
+		strings.Contains(msg, "formatted") ||
+		strings.Contains(msg, "must provide")):
+		e.Kind = ErrInvalidToken
+		e.Code = ErrCodeUnauthorized
+	case strings.Contains(msg, "do not have permissions to use the api") ||
+		strings.Contains(msg, "do not have api rights"):
+		e.Kind = ErrNoAPIRights
+		e.Code = ErrCodeForbidden
+	case strings.Contains(msg, "locked"):
+		e.Kind = ErrRecordLocked
+	default:
+		if v := parseValidationErrors(e.Message); v != nil {
+			e.Kind = ErrInvalidData
+			if e.Err == nil {
+				e.Err = v
+			}
+			return
+		}
+		switch {
+		case strings.Contains(msg, "field") && (strings.Contains(msg, "not valid") ||
+			strings.Contains(msg, "not found") ||
+			strings.Contains(msg, "do not exist") ||
+			strings.Contains(msg, "does not exist")):
+			e.Kind = ErrInvalidField
+		case strings.Contains(msg, "record") && (strings.Contains(msg, "do not exist") ||
+			strings.Contains(msg, "does not exist") ||
+			strings.Contains(msg, "not valid")):
+			e.Kind = ErrInvalidRecord
+		case strings.Contains(msg, "values are not valid") ||
+			strings.Contains(msg, "could not be validated"):
+			e.Kind = ErrInvalidData
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package redcap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseErrorClassify(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		wantCode string
+		wantKind error
+	}{
+		{400, `{"error":"You do not have permissions to use the API"}`, ErrCodeForbidden, ErrNoAPIRights},
+		{403, `{"error":"The token you provided is not valid"}`, ErrCodeUnauthorized, ErrInvalidToken},
+		{400, `{"error":"The following values in the parameter \"fields\" are not valid: 'agee'"}`, ErrCodeInvalidRequest, ErrInvalidField},
+		{400, `{"error":"The following records do not exist: 99"}`, ErrCodeInvalidRequest, ErrInvalidRecord},
+		{400, `{"error":"This record is locked and cannot be modified"}`, ErrCodeInvalidRequest, ErrRecordLocked},
+		{400, `{"error":"\"1\",\"age\",\"abc\",\"The value is not an integer\""}`, ErrCodeInvalidRequest, ErrInvalidData},
+		{400, `{"error":"Something else went wrong"}`, ErrCodeInvalidRequest, nil},
+		// Server errors are retried, not classified
+		{500, `{"error":"The token you provided is not valid"}`, ErrCodeServerError, nil},
+		{429, `slow down`, ErrCodeRateLimit, nil},
+	}
+	c := &Client{}
+	for _, tt := range tests {
+		e := c.parseError(tt.status, []byte(tt.body))
+		if e.Code != tt.wantCode {
+			t.Errorf("%d %s: code = %s, want %s", tt.status, tt.body, e.Code, tt.wantCode)
+		}
+		if e.Kind != tt.wantKind {
+			t.Errorf("%d %s: kind = %v, want %v", tt.status, tt.body, e.Kind, tt.wantKind)
+		}
+	}
+}
+
+func TestValidationErrorsFromImport(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"\"1\",\"age\",\"abc\",\"The value is not an integer\"\n\"2\",\"dob\",\"x\",\"The value is not a date\""}`))
+	})
+	_, err := c.ImportRecords(context.Background(), []Record{{ID: "1"}})
+	if !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("err = %v, want ErrInvalidData", err)
+	}
+	var v ValidationErrors
+	if !errors.As(err, &v) || len(v) != 2 {
+		t.Fatalf("ValidationErrors = %v", v)
+	}
+	if want := (ValidationError{Record: "2", Field: "dob", Value: "x", Message: "The value is not a date"}); v[1] != want {
+		t.Errorf("v[1] = %+v, want %+v", v[1], want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 )
 
 type Event struct {
@@ -15,6 +16,37 @@ type Event struct {
 	UniqueEventName string `json:"unique_event_name"`
 }
 
+// UnmarshalJSON decodes an event, whose arm number and offsets REDCap
+// sends as numbers or strings.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name            jsonText `json:"event_name"`
+		ArmNum          jsonText `json:"arm_num"`
+		DayOffset       jsonText `json:"day_offset"`
+		OffsetMin       jsonText `json:"offset_min"`
+		OffsetMax       jsonText `json:"offset_max"`
+		UniqueEventName jsonText `json:"unique_event_name"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*e = Event{
+		Name:            string(raw.Name),
+		DayOffset:       string(raw.DayOffset),
+		OffsetMin:       string(raw.OffsetMin),
+		OffsetMax:       string(raw.OffsetMax),
+		UniqueEventName: string(raw.UniqueEventName),
+	}
+	if raw.ArmNum != "" {
+		n, err := strconv.Atoi(string(raw.ArmNum))
+		if err != nil {
+			return fmt.Errorf("event %q: invalid arm_num %q", raw.Name, raw.ArmNum)
+		}
+		e.ArmNum = n
+	}
+	return nil
+}
+
 // ExportEvents returns the list of events for longitudinal projects.
 func (c *Client) ExportEvents(ctx context.Context) ([]Event, error) {
 	body, err := c.Request(ctx, "event", map[string]string{
@@ -48,3 +80,23 @@ func (c *Client) ExportArms(ctx context.Context) ([]Arm, error) {
 
 	return arms, nil
 }
+
+// ImportEvents adds events, or updates them when UniqueEventName is set,
+// and returns the number imported. With override, all existing events
+// are deleted first.
+func (c *Client) ImportEvents(ctx context.Context, events []Event, override bool) (int, error) {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling events: %w", err)
+	}
+	return c.importJSON(ctx, "event", data, map[string]string{
+		"action":   "import",
+		"override": overrideParam(override),
+	})
+}
+
+// DeleteEvents deletes events by unique name, with the data collected in
+// them, and returns the number deleted.
+func (c *Client) DeleteEvents(ctx context.Context, uniqueEventNames []string) (int, error) {
+	return c.deleteList(ctx, "event", "events", uniqueEventNames)
+}
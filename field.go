@@ -1,5 +1,11 @@
 package redcap
 
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
 // Represents a REDCap data dictionary field.
 type Field struct {
 	Branching_logic                            string
@@ -20,10 +26,142 @@ type Field struct {
 	Text_validation_max                        string
 	Text_validation_min                        string
 	Text_validation_type_or_show_slider_number string
+	Field_annotation                           string
 	Value                                      string
 }
 
 type FieldChoice struct {
 	ID    int
+	Code  string // the raw choice code; ID is its integer value, if any
 	Label string
 }
+
+// fieldJSON is the shape of a field in REDCap's metadata export.
+type fieldJSON struct {
+	FieldName       string `json:"field_name"`
+	FormName        string `json:"form_name"`
+	SectionHeader   string `json:"section_header"`
+	FieldType       string `json:"field_type"`
+	FieldLabel      string `json:"field_label"`
+	Choices         string `json:"select_choices_or_calculations"`
+	FieldNote       string `json:"field_note"`
+	ValidationType  string `json:"text_validation_type_or_show_slider_number"`
+	ValidationMin   string `json:"text_validation_min"`
+	ValidationMax   string `json:"text_validation_max"`
+	Identifier      string `json:"identifier"`
+	BranchingLogic  string `json:"branching_logic"`
+	RequiredField   string `json:"required_field"`
+	CustomAlignment string `json:"custom_alignment"`
+	QuestionNumber  string `json:"question_number"`
+	MatrixGroupName string `json:"matrix_group_name"`
+	MatrixRanking   string `json:"matrix_ranking"`
+	FieldAnnotation string `json:"field_annotation"`
+}
+
+// UnmarshalJSON decodes a field from REDCap's metadata export, splitting
+// select_choices_or_calculations into Choices or Calculations.
+func (f *Field) UnmarshalJSON(data []byte) error {
+	var raw fieldJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*f = Field{
+		Branching_logic:     raw.BranchingLogic,
+		Custom_alignment:    raw.CustomAlignment,
+		Field_label:         raw.FieldLabel,
+		Field_name:          raw.FieldName,
+		Field_note:          raw.FieldNote,
+		Field_type:          raw.FieldType,
+		Form_name:           raw.FormName,
+		Identifier:          raw.Identifier,
+		Matrix_group_name:   raw.MatrixGroupName,
+		Matrix_ranking:      raw.MatrixRanking,
+		Question_number:     raw.QuestionNumber,
+		Required_field:      raw.RequiredField == "y",
+		Section_header:      raw.SectionHeader,
+		Text_validation_max: raw.ValidationMax,
+		Text_validation_min: raw.ValidationMin,
+		Text_validation_type_or_show_slider_number: raw.ValidationType,
+		Field_annotation: raw.FieldAnnotation,
+	}
+
+	switch raw.FieldType {
+	case "dropdown", "radio", "checkbox":
+		f.Choices = parseChoices(raw.Choices)
+	default:
+		f.Calculations = raw.Choices
+	}
+	return nil
+}
+
+// MarshalJSON encodes the field in REDCap's metadata import shape.
+func (f Field) MarshalJSON() ([]byte, error) {
+	raw := fieldJSON{
+		FieldName:       f.Field_name,
+		FormName:        f.Form_name,
+		SectionHeader:   f.Section_header,
+		FieldType:       f.Field_type,
+		FieldLabel:      f.Field_label,
+		Choices:         f.Calculations,
+		FieldNote:       f.Field_note,
+		ValidationType:  f.Text_validation_type_or_show_slider_number,
+		ValidationMin:   f.Text_validation_min,
+		ValidationMax:   f.Text_validation_max,
+		Identifier:      f.Identifier,
+		BranchingLogic:  f.Branching_logic,
+		CustomAlignment: f.Custom_alignment,
+		QuestionNumber:  f.Question_number,
+		MatrixGroupName: f.Matrix_group_name,
+		MatrixRanking:   f.Matrix_ranking,
+		FieldAnnotation: f.Field_annotation,
+	}
+	if f.Required_field {
+		raw.RequiredField = "y"
+	}
+	if len(f.Choices) > 0 {
+		parts := make([]string, len(f.Choices))
+		for i, c := range f.Choices {
+			parts[i] = c.Code + ", " + c.Label
+		}
+		raw.Choices = strings.Join(parts, " | ")
+	}
+	return json.Marshal(raw)
+}
+
+// parseChoices parses "1, Yes | 0, No".
+func parseChoices(s string) []FieldChoice {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var choices []FieldChoice
+	for _, part := range strings.Split(s, "|") {
+		code, label, _ := strings.Cut(part, ",")
+		c := FieldChoice{
+			Code:  strings.TrimSpace(code),
+			Label: strings.TrimSpace(label),
+		}
+		c.ID, _ = strconv.Atoi(c.Code)
+		choices = append(choices, c)
+	}
+	return choices
+}
+
+// Choice returns the choice with the given code.
+func (f *Field) Choice(code string) (FieldChoice, bool) {
+	for _, c := range f.Choices {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return FieldChoice{}, false
+}
+
+// ValidationType returns the text validation type, such as "integer" or
+// "date_ymd", or "" for unvalidated and non-text fields.
+func (f *Field) ValidationType() string {
+	if f.Field_type != "text" {
+		return ""
+	}
+	return f.Text_validation_type_or_show_slider_number
+}
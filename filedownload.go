@@ -0,0 +1,367 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileManifestName is the manifest a FileDownloader keeps in its
+// directory.
+const FileManifestName = "manifest.json"
+
+// FileRef locates a file-upload value. Instance is 0 outside repeating
+// forms and events.
+type FileRef struct {
+	Record   string `json:"record"`
+	Event    string `json:"event,omitempty"`
+	Field    string `json:"field"`
+	Instance int    `json:"instance,omitempty"`
+}
+
+// fileValue is a file-upload value in a record export: where it is and
+// the value itself, the name of the uploaded file.
+type fileValue struct {
+	FileRef
+	Value string
+}
+
+// fileValues lists the non-empty values of the given file fields in flat
+// record export rows.
+func fileValues(rows []map[string]any, idField string, fields []string) []fileValue {
+	var values []fileValue
+	for _, row := range rows {
+		for _, field := range fields {
+			v, _ := row[field].(string)
+			if v == "" {
+				continue
+			}
+			fv := fileValue{FileRef: FileRef{Record: fmt.Sprint(row[idField]), Field: field}, Value: v}
+			fv.Event, _ = row["redcap_event_name"].(string)
+			fv.Instance, _ = strconv.Atoi(fmt.Sprint(row["redcap_repeat_instance"]))
+			values = append(values, fv)
+		}
+	}
+	return values
+}
+
+// FileManifest lists the files a FileDownloader has downloaded.
+type FileManifest struct {
+	UpdatedAt time.Time        `json:"updated_at"`
+	Files     []DownloadedFile `json:"files"`
+}
+
+// DownloadedFile is one downloaded file. Path is slash-separated and
+// relative to the download directory.
+type DownloadedFile struct {
+	FileRef
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	Path     string `json:"path"`
+	// Value is the field's value in the record export at download time,
+	// which REDCap sets to the uploaded file name.
+	Value string `json:"value,omitempty"`
+}
+
+// FileDownloadResult describes one FileDownloader run.
+type FileDownloadResult struct {
+	// Downloaded is the number of files downloaded by this run.
+	Downloaded int `json:"downloaded"`
+	// Skipped is the number of files already on disk from an earlier run.
+	Skipped int `json:"skipped"`
+	// Bytes is the size of the files downloaded by this run.
+	Bytes    int64         `json:"bytes"`
+	Manifest *FileManifest `json:"-"`
+}
+
+// FileDownloader downloads the files in every file-upload field of a
+// project into a directory, laid out as
+// record/event/field/instance/filename. Classic projects use "_" for the
+// event, and fields outside repeating forms and events are instance 1.
+// A manifest in the directory records each file with its checksum, so an
+// interrupted download resumes where it stopped.
+//
+// The manifest is a resume log, not a mirror check. A file is skipped
+// when the record still has the value it had when the file was
+// downloaded and the local copy matches its checksum. REDCap's value is
+// the file name, so a file replaced in REDCap by one of the same name is
+// not noticed; set Force to download everything again.
+type FileDownloader struct {
+	Client *Client
+	Dir    string
+	// Records limits the download to these records.
+	Records []string
+	// Fields limits the download to these file fields.
+	Fields []string
+	// Concurrency is how many files are downloaded at once; 0 means
+	// DefaultConcurrency. Requests still go through the client's rate
+	// limiter.
+	Concurrency int
+	// Force downloads files again even if the manifest has them.
+	Force bool
+	// Progress, if set, is called after each file is downloaded or
+	// skipped. Calls are serialized.
+	Progress func(f DownloadedFile, skipped bool)
+}
+
+// manifestSaveEvery is how many downloads go by between manifest saves,
+// so that a killed run loses little.
+const manifestSaveEvery = 25
+
+// Download downloads the files and writes the manifest. The manifest is
+// also written when the download fails part way.
+func (d *FileDownloader) Download(ctx context.Context) (*FileDownloadResult, error) {
+	fields, err := d.Client.ExportMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting metadata: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("project has no fields")
+	}
+	idField := fields[0].Field_name
+	var fileFields []string
+	for _, f := range fields {
+		if f.Field_type == "file" && (len(d.Fields) == 0 || slices.Contains(d.Fields, f.Field_name)) {
+			fileFields = append(fileFields, f.Field_name)
+		}
+	}
+	for _, name := range d.Fields {
+		if !slices.Contains(fileFields, name) {
+			return nil, fmt.Errorf("%s is not a file field", name)
+		}
+	}
+
+	manifestPath := filepath.Join(d.Dir, FileManifestName)
+	previous := make(map[FileRef]DownloadedFile)
+	if !d.Force {
+		old, err := loadFileManifest(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range old.Files {
+			previous[f.FileRef] = f
+		}
+	}
+
+	res := &FileDownloadResult{Manifest: &FileManifest{Files: []DownloadedFile{}}}
+	if len(fileFields) == 0 {
+		return res, nil
+	}
+
+	opts := []ExportOption{
+		ExportFormat("json"),
+		ExportRawOrLabel("raw"),
+		ExportFields(append([]string{idField}, fileFields...)),
+	}
+	if len(d.Records) > 0 {
+		opts = append(opts, ExportRecordsFilter(d.Records))
+	}
+	body, err := d.Client.ExportRecordsRaw(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("exporting records: %w", err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("unmarshaling records: %w", err)
+	}
+	refs := fileValues(rows, idField, fileFields)
+
+	if err := os.MkdirAll(d.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	concurrency := d.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		firstErr error
+		unsaved  int
+		seen     = make(map[FileRef]bool)
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, concurrency)
+	)
+	// done records a finished file; it runs under mu
+	done := func(f DownloadedFile, skipped bool) {
+		res.Manifest.Files = append(res.Manifest.Files, f)
+		seen[f.FileRef] = true
+		if skipped {
+			res.Skipped++
+		} else {
+			res.Downloaded++
+			res.Bytes += f.Size
+			if unsaved++; unsaved >= manifestSaveEvery {
+				unsaved = 0
+				if err := d.saveManifest(manifestPath, partialManifest(res.Manifest, previous, seen)); err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+			}
+		}
+		if d.Progress != nil {
+			d.Progress(f, skipped)
+		}
+	}
+
+	for _, ref := range refs {
+		if prev, ok := previous[ref.FileRef]; ok && prev.Value == ref.Value && d.onDisk(prev) {
+			mu.Lock()
+			done(prev, true)
+			mu.Unlock()
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			f, err := d.download(ctx, ref)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			done(f, false)
+		}()
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	// A complete run drops files no longer in the project; a failed one
+	// keeps what earlier runs had for the next to resume from
+	m := res.Manifest
+	if firstErr != nil {
+		m = partialManifest(m, previous, seen)
+	}
+	slices.SortFunc(m.Files, func(a, b DownloadedFile) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	if err := d.saveManifest(manifestPath, m); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return res, firstErr
+}
+
+// partialManifest adds the files of earlier runs not yet reached to m.
+func partialManifest(m *FileManifest, previous map[FileRef]DownloadedFile, seen map[FileRef]bool) *FileManifest {
+	files := slices.Clone(m.Files)
+	for ref, f := range previous {
+		if !seen[ref] {
+			files = append(files, f)
+		}
+	}
+	return &FileManifest{Files: files}
+}
+
+// download exports one file and writes it into its directory.
+func (d *FileDownloader) download(ctx context.Context, ref fileValue) (DownloadedFile, error) {
+	file, err := d.Client.ExportFile(ctx, ref.Record, ref.Field, ref.Event, FileRepeatInstance(ref.Instance))
+	if err != nil {
+		return DownloadedFile{}, fmt.Errorf("exporting file %s of record %s: %w", ref.Field, ref.Record, err)
+	}
+	name := pathElement(filepath.Base(file.Name))
+	if file.Name == "" {
+		name = ref.Field
+	}
+	event, instance := ref.Event, ref.Instance
+	if event == "" {
+		event = "_"
+	}
+	if instance == 0 {
+		instance = 1
+	}
+	rel := path.Join(pathElement(ref.Record), pathElement(event), pathElement(ref.Field), strconv.Itoa(instance), name)
+
+	dst := filepath.Join(d.Dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return DownloadedFile{}, err
+	}
+	if err := writeFileAtomic(dst, file.Data); err != nil {
+		return DownloadedFile{}, fmt.Errorf("writing %s: %w", rel, err)
+	}
+	return DownloadedFile{
+		FileRef:  ref.FileRef,
+		Name:     file.Name,
+		MIMEType: file.MIMEType,
+		Size:     file.Size,
+		SHA256:   checksum(file.Data),
+		Path:     rel,
+		Value:    ref.Value,
+	}, nil
+}
+
+// onDisk reports whether a file from an earlier run is still intact.
+func (d *FileDownloader) onDisk(f DownloadedFile) bool {
+	data, err := os.ReadFile(filepath.Join(d.Dir, filepath.FromSlash(f.Path)))
+	return err == nil && int64(len(data)) == f.Size && checksum(data) == f.SHA256
+}
+
+func (d *FileDownloader) saveManifest(path string, m *FileManifest) error {
+	m.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling file manifest: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("writing file manifest: %w", err)
+	}
+	return nil
+}
+
+func loadFileManifest(path string) (*FileManifest, error) {
+	m := &FileManifest{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("reading file manifest: %w", err)
+	default:
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("parsing file manifest %s: %w", path, err)
+		}
+	}
+	return m, nil
+}
+
+// pathElement makes a record ID, event, field or file name safe to use
+// as one path element.
+func pathElement(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package redcap
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileDownloaderResume(t *testing.T) {
+	p := newFakeProject()
+	p.addRecord("1", "one", "scan1")
+	p.addRecord("2", "two", "")
+	p.addRecord("3", "three", "scan3")
+	c := newTestClient(t, p.ServeHTTP)
+	dir := t.TempDir()
+	d := &FileDownloader{Client: c, Dir: dir}
+	ctx := context.Background()
+
+	res, err := d.Download(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Downloaded != 2 || res.Skipped != 0 {
+		t.Fatalf("first run: downloaded %d, skipped %d", res.Downloaded, res.Skipped)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "1", "_", "scan", "1", "scan1.txt"))
+	if err != nil || string(data) != "contents of scan1" {
+		t.Fatalf("record 1 file = %q, %v", data, err)
+	}
+	m, err := loadFileManifest(filepath.Join(dir, FileManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 || m.Files[0].Path != "1/_/scan/1/scan1.txt" || m.Files[0].Value != "scan1.txt" {
+		t.Fatalf("manifest = %+v", m.Files)
+	}
+
+	// Nothing changed: nothing is downloaded
+	p.requests = make(map[string]int)
+	if res, err = d.Download(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if res.Downloaded != 0 || res.Skipped != 2 || p.requests["file/export"] != 0 {
+		t.Errorf("second run: downloaded %d, skipped %d, exports %d", res.Downloaded, res.Skipped, p.requests["file/export"])
+	}
+
+	// A file replaced in REDCap changes the record value
+	p.records[0]["scan"] = "scan1-v2.txt"
+	p.files["1/scan"] = fakeFile{name: "scan1-v2.txt", data: []byte("second version")}
+	// A damaged local copy no longer matches its checksum
+	if err := os.WriteFile(filepath.Join(dir, "3", "_", "scan", "1", "scan3.txt"), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = d.Download(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if res.Downloaded != 2 || res.Skipped != 0 {
+		t.Errorf("third run: downloaded %d, skipped %d, want 2 and 0", res.Downloaded, res.Skipped)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "1", "_", "scan", "1", "scan1-v2.txt"))
+	if err != nil || string(data) != "second version" {
+		t.Errorf("replaced file = %q, %v", data, err)
+	}
+
+	d.Force = true
+	if res, err = d.Download(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if res.Downloaded != 2 || res.Skipped != 0 {
+		t.Errorf("forced run: downloaded %d, skipped %d", res.Downloaded, res.Skipped)
+	}
+}
+
+func TestFileDownloaderUnknownField(t *testing.T) {
+	p := newFakeProject()
+	d := &FileDownloader{Client: newTestClient(t, p.ServeHTTP), Dir: t.TempDir(), Fields: []string{"name"}}
+	if _, err := d.Download(context.Background()); err == nil {
+		t.Fatal("downloading a text field succeeded")
+	}
+}
+
+func TestExportFileRepeatInstance(t *testing.T) {
+	var instances []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		instances = append(instances, r.FormValue("repeat_instance"))
+		w.Header().Set("Content-Type", `application/pdf; name="consent.pdf"`)
+		w.Write([]byte("%PDF"))
+	})
+	ctx := context.Background()
+	f, err := c.ExportFile(ctx, "1", "consent", "", FileRepeatInstance(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "consent.pdf" || f.MIMEType != "application/pdf" || f.Size != 4 {
+		t.Errorf("file = %+v", f)
+	}
+	if _, err := c.ExportFile(ctx, "1", "consent", "", FileRepeatInstance(0)); err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 || instances[0] != "3" || instances[1] != "" {
+		t.Errorf("repeat_instance sent = %q, want 3 then none", instances)
+	}
+}
@@ -0,0 +1,124 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// RepositoryItem is a folder or file in the project's File Repository.
+type RepositoryItem struct {
+	// FolderID is set for folders and DocID for files.
+	FolderID int    `json:"folder_id,omitempty"`
+	DocID    int    `json:"doc_id,omitempty"`
+	Name     string `json:"name"`
+}
+
+// IsFolder reports whether the item is a folder.
+func (i RepositoryItem) IsFolder() bool {
+	return i.FolderID != 0
+}
+
+// UnmarshalJSON decodes an item of a repository listing, whose IDs REDCap
+// sends as numbers or strings.
+func (i *RepositoryItem) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		FolderID jsonText `json:"folder_id"`
+		DocID    jsonText `json:"doc_id"`
+		Name     jsonText `json:"name"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*i = RepositoryItem{Name: string(raw.Name)}
+	i.FolderID, _ = strconv.Atoi(string(raw.FolderID))
+	i.DocID, _ = strconv.Atoi(string(raw.DocID))
+	return nil
+}
+
+// ListRepository returns the folders and files in a repository folder;
+// folder 0 is the top level.
+func (c *Client) ListRepository(ctx context.Context, folder int) ([]RepositoryItem, error) {
+	params := map[string]string{
+		"action": "list",
+		"format": "json",
+	}
+	if folder != 0 {
+		params["folder_id"] = strconv.Itoa(folder)
+	}
+	body, err := c.Request(ctx, "fileRepository", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []RepositoryItem
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("unmarshaling repository listing: %w", err)
+	}
+	return items, nil
+}
+
+// CreateRepositoryFolder creates a folder inside parent (0 for the top
+// level) and returns its ID.
+func (c *Client) CreateRepositoryFolder(ctx context.Context, name string, parent int) (int, error) {
+	params := map[string]string{
+		"action": "createFolder",
+		"format": "json",
+		"name":   name,
+	}
+	if parent != 0 {
+		params["folder_id"] = strconv.Itoa(parent)
+	}
+	body, err := c.Request(ctx, "fileRepository", params)
+	if err != nil {
+		return 0, err
+	}
+
+	var created []RepositoryItem
+	if err := json.Unmarshal(body, &created); err != nil {
+		return 0, fmt.Errorf("unmarshaling created folder: %w", err)
+	}
+	if len(created) == 0 || created[0].FolderID == 0 {
+		return 0, errors.New("creating folder: no folder ID returned")
+	}
+	return created[0].FolderID, nil
+}
+
+// ExportRepositoryFile downloads a repository file and returns its name
+// and contents.
+func (c *Client) ExportRepositoryFile(ctx context.Context, docID int) (string, []byte, error) {
+	resp, err := c.request(ctx, "fileRepository", map[string]string{
+		"action": "export",
+		"doc_id": strconv.Itoa(docID),
+	}, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return fileName(resp.header), resp.body, nil
+}
+
+// ImportRepositoryFile uploads a file into a repository folder (0 for the
+// top level). REDCap keeps files of the same name side by side, so
+// replacing a file means deleting the old one.
+func (c *Client) ImportRepositoryFile(ctx context.Context, folder int, name string, data []byte) error {
+	params := map[string]string{
+		"action": "import",
+	}
+	if folder != 0 {
+		params["folder_id"] = strconv.Itoa(folder)
+	}
+	_, err := c.request(ctx, "fileRepository", params, &upload{filename: name, data: data})
+	return err
+}
+
+// DeleteRepositoryFile deletes a repository file. It stays in the
+// project's recycle bin for 30 days.
+func (c *Client) DeleteRepositoryFile(ctx context.Context, docID int) error {
+	_, err := c.Request(ctx, "fileRepository", map[string]string{
+		"action": "delete",
+		"doc_id": strconv.Itoa(docID),
+	})
+	return err
+}
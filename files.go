@@ -2,26 +2,95 @@ package redcap
 
 import (
 	"context"
+	"mime"
+	"net/http"
+	"strconv"
 )
 
-// ExportFile exports a file field from a record.
-func (c *Client) ExportFile(ctx context.Context, recordID, field, event string) ([]byte, error) {
+// File is a file exported from a record field.
+type File struct {
+	// Name is the file name REDCap sent, empty if it sent none.
+	Name     string
+	MIMEType string
+	Size     int64
+	Data     []byte
+}
+
+// FileOption sets the repeat instance of ExportFile.
+type FileOption func(map[string]string)
+
+// FileRepeatInstance selects an instance of a repeating form or event.
+// REDCap uses instance 1 when it is not given.
+func FileRepeatInstance(n int) FileOption {
+	return func(p map[string]string) {
+		if n > 0 {
+			p["repeat_instance"] = strconv.Itoa(n)
+		}
+	}
+}
+
+// ExportFile exports a file field from a record. FileRepeatInstance
+// selects an instance of a repeating form or event.
+func (c *Client) ExportFile(ctx context.Context, recordID, field, event string, opts ...FileOption) (*File, error) {
+	p := make(map[string]string)
+	for _, opt := range opts {
+		opt(p)
+	}
+	instance, _ := strconv.Atoi(p["repeat_instance"])
+
+	resp, err := c.exportFile(ctx, recordID, field, event, instance)
+	if err != nil {
+		return nil, err
+	}
+	return newFile(resp), nil
+}
+
+func newFile(resp *response) *File {
+	f := &File{
+		Name: fileName(resp.header),
+		Size: int64(len(resp.body)),
+		Data: resp.body,
+	}
+	f.MIMEType, _, _ = mime.ParseMediaType(resp.header.Get("Content-Type"))
+	return f
+}
+
+// exportFile exports a file field from a record, keeping the response
+// headers, which carry the file name. An instance of 0 means the field
+// is not on a repeating form or event.
+func (c *Client) exportFile(ctx context.Context, recordID, field, event string, instance int) (*response, error) {
 	params := map[string]string{
 		"content": "file",
+		"action":  "export",
 		"record":  recordID,
 		"field":   field,
 	}
 	if event != "" {
 		params["event"] = event
 	}
+	if instance > 0 {
+		params["repeat_instance"] = strconv.Itoa(instance)
+	}
 
-	return c.Request(ctx, "", params)
+	return c.request(ctx, "", params, nil)
 }
 
-// ImportFile imports a file into a record field.
+// fileName returns the name REDCap gives an exported file in the
+// Content-Type header (image/png; name="scan.png").
+func fileName(h http.Header) string {
+	_, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return params["name"]
+}
+
+// ImportFile uploads a file into a record field. The file is named after
+// the field unless ImportFileName is given.
 func (c *Client) ImportFile(ctx context.Context, recordID, field, event string, data []byte, opts ...ImportOption) error {
 	params := map[string]string{
 		"content": "file",
+		"action":  "import",
 		"record":  recordID,
 		"field":   field,
 	}
@@ -33,7 +102,14 @@ func (c *Client) ImportFile(ctx context.Context, recordID, field, event string,
 		opt(params)
 	}
 
-	_, err := c.Request(ctx, "", params)
+	// The name travels with the file part, not as a form field
+	name := params["filename"]
+	delete(params, "filename")
+	if name == "" {
+		name = field
+	}
+
+	_, err := c.request(ctx, "", params, &upload{filename: name, data: data})
 	return err
 }
 
@@ -41,6 +117,7 @@ func (c *Client) ImportFile(ctx context.Context, recordID, field, event string,
 func (c *Client) DeleteFile(ctx context.Context, recordID, field, event string) error {
 	params := map[string]string{
 		"content": "file",
+		"action":  "delete",
 		"record":  recordID,
 		"field":   field,
 	}
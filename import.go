@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 // ImportRecords imports records into the project.
 func (c *Client) ImportRecords(ctx context.Context, records []Record, opts ...ImportOption) (*ImportResult, error) {
 	params := map[string]string{
 		"content": "record",
+		"action":  "import",
 		"format":  "json",
 		"type":    "flat",
 	}
@@ -30,6 +33,45 @@ func (c *Client) ImportRecords(ctx context.Context, records []Record, opts ...Im
 		return nil, err
 	}
 
+	return parseImportResult(body)
+}
+
+// ImportRecordsRaw imports records already encoded in the given format
+// (JSON by default; set ImportFormat for CSV or XML).
+func (c *Client) ImportRecordsRaw(ctx context.Context, data []byte, opts ...ImportOption) (*ImportResult, error) {
+	params := map[string]string{
+		"content": "record",
+		"action":  "import",
+		"format":  "json",
+		"type":    "flat",
+	}
+
+	for _, opt := range opts {
+		opt(params)
+	}
+	params["data"] = string(data)
+
+	body, err := c.Request(ctx, "", params)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseImportResult(body)
+}
+
+// parseImportResult reads an import response, which is {"count": n}, a
+// bare count, or, with returnContent ids or auto_ids, a JSON array of
+// record names.
+func parseImportResult(body []byte) (*ImportResult, error) {
+	if n, err := strconv.Atoi(strings.TrimSpace(string(body))); err == nil {
+		return &ImportResult{Count: n}, nil
+	}
+
+	var ids []string
+	if err := json.Unmarshal(body, &ids); err == nil {
+		return &ImportResult{Count: len(ids), IDs: ids}, nil
+	}
+
 	var result ImportResult
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("unmarshaling import result: %w", err)
@@ -38,6 +80,28 @@ func (c *Client) ImportRecords(ctx context.Context, records []Record, opts ...Im
 	return &result, nil
 }
 
+// importJSON sends JSON data to an import endpoint other than records,
+// such as metadata or arm, and returns the count REDCap reports.
+func (c *Client) importJSON(ctx context.Context, content string, data []byte, params map[string]string) (int, error) {
+	p := map[string]string{
+		"format": "json",
+		"data":   string(data),
+	}
+	for k, v := range params {
+		p[k] = v
+	}
+
+	body, err := c.Request(ctx, content, p)
+	if err != nil {
+		return 0, err
+	}
+	res, err := parseImportResult(body)
+	if err != nil {
+		return 0, err
+	}
+	return res.Count, nil
+}
+
 // GenerateNextRecordName generates the next sequential record name.
 func (c *Client) GenerateNextRecordName(ctx context.Context) (string, error) {
 	body, err := c.Request(ctx, "generateNextRecordName", map[string]string{
@@ -0,0 +1,160 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeRows(t *testing.T) {
+	row := func(id, v string) map[string]any {
+		return map[string]any{"record_id": id, "v": v}
+	}
+	base := []map[string]any{row("1", "a"), row("2", "old"), row("2", "old"), row("3", "c")}
+	changed := []map[string]any{row("4", "new"), row("2", "x")}
+
+	got := MergeRows(base, changed, "record_id")
+	want := []map[string]any{row("1", "a"), row("2", "x"), row("3", "c"), row("4", "new")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeRows = %v, want %v", got, want)
+	}
+
+	if got := MergeRows(nil, changed, "record_id"); !reflect.DeepEqual(got, []map[string]any{row("4", "new"), row("2", "x")}) {
+		t.Errorf("MergeRows into nothing = %v", got)
+	}
+	if got := MergeRows(base, nil, "record_id"); !reflect.DeepEqual(got, base) {
+		t.Errorf("MergeRows with no changes = %v", got)
+	}
+}
+
+func TestServerTime(t *testing.T) {
+	date := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	start := time.Now().Add(-2 * time.Second)
+
+	h := http.Header{"Date": []string{date.Format(http.TimeFormat)}}
+	got := serverTime(h, start)
+	if want := date.Add(-2 * time.Second); got.After(want) || got.Before(want.Add(-time.Second)) {
+		t.Errorf("serverTime = %v, want about %v", got, want)
+	}
+	if got.Location() != time.UTC {
+		t.Errorf("serverTime location = %v, want UTC", got.Location())
+	}
+
+	for _, h := range []http.Header{{}, {"Date": []string{"yesterday"}}} {
+		if got := serverTime(h, start); !got.Equal(start) {
+			t.Errorf("serverTime(%v) = %v, want the start time", h, got)
+		}
+	}
+}
+
+// changeServer serves metadata and record exports, with a fixed Date
+// header, recording each dateRangeBegin sent.
+type changeServer struct {
+	mu     sync.Mutex
+	date   time.Time
+	rows   []map[string]any
+	begins []string
+}
+
+func (s *changeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Date", s.date.Format(http.TimeFormat))
+	switch r.FormValue("content") {
+	case "metadata":
+		w.Write([]byte(`[{"field_name":"record_id","form_name":"demo","field_type":"text"}]`))
+	case "record":
+		s.begins = append(s.begins, r.FormValue("dateRangeBegin"))
+		json.NewEncoder(w).Encode(s.rows)
+	}
+}
+
+func TestIncrementalExporterRun(t *testing.T) {
+	srv := &changeServer{
+		date: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		rows: []map[string]any{{"record_id": "1", "v": "a"}, {"record_id": "2", "v": "b"}},
+	}
+	dir := t.TempDir()
+	loc := time.FixedZone("EST", -5*3600)
+	e := &IncrementalExporter{
+		Client:      newTestClient(t, srv.ServeHTTP),
+		Key:         "study1",
+		StatePath:   filepath.Join(dir, "state.json"),
+		DatasetPath: filepath.Join(dir, "records.json"),
+		Location:    loc,
+	}
+	ctx := context.Background()
+
+	res, err := e.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Full || !res.Begin.IsZero() || res.Records != 2 || srv.begins[0] != "" {
+		t.Fatalf("first run = %+v, dateRangeBegin %q; want a full export", res, srv.begins[0])
+	}
+
+	state, err := LoadExportState(e.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mark := state.Marks["study1"]
+	if mark == nil || !mark.Since.Equal(res.Mark) || mark.Records != 2 || mark.Dataset != e.DatasetPath {
+		t.Fatalf("state mark = %+v, want since %v", mark, res.Mark)
+	}
+	if d := srv.date.Sub(mark.Since); d < 0 || d > time.Second {
+		t.Errorf("mark %v is not the server's time %v", mark.Since, srv.date)
+	}
+
+	// The next run asks for changes since the mark less the overlap, in
+	// the server's time zone, and merges them
+	srv.date = srv.date.Add(time.Hour)
+	srv.rows = []map[string]any{{"record_id": "2", "v": "b2"}, {"record_id": "3", "v": "c"}}
+	res, err = e.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{}
+	ExportDateRangeBegin(mark.Since.Add(-DefaultOverlap).In(loc))(want)
+	if res.Full || srv.begins[1] != want["dateRangeBegin"] || !res.Begin.Equal(mark.Since.Add(-DefaultOverlap)) {
+		t.Errorf("second run = %+v, dateRangeBegin %q, want %q", res, srv.begins[1], want["dateRangeBegin"])
+	}
+	if got := srv.begins[1]; got[:16] != "2024-05-01 06:54" {
+		t.Errorf("dateRangeBegin = %q, want server-local time", got)
+	}
+	rows, err := readDataset(e.DatasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRows := []map[string]any{{"record_id": "1", "v": "a"}, {"record_id": "2", "v": "b2"}, {"record_id": "3", "v": "c"}}
+	if !reflect.DeepEqual(rows, wantRows) || res.Records != 3 {
+		t.Errorf("dataset = %v (%d records), want %v", rows, res.Records, wantRows)
+	}
+
+	// A missing dataset forces a full export despite the mark
+	os.Remove(e.DatasetPath)
+	if res, err = e.Run(ctx); err != nil || !res.Full || srv.begins[2] != "" {
+		t.Errorf("run without dataset = %+v, %v, dateRangeBegin %q", res, err, srv.begins[2])
+	}
+	e.Full = true
+	if res, err = e.Run(ctx); err != nil || !res.Full || srv.begins[3] != "" {
+		t.Errorf("Full run = %+v, %v, dateRangeBegin %q", res, err, srv.begins[3])
+	}
+}
+
+func TestLoadExportState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := LoadExportState(path)
+	if err != nil || s.Marks == nil || len(s.Marks) != 0 {
+		t.Fatalf("missing state = %+v, %v", s, err)
+	}
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := LoadExportState(path); err == nil {
+		t.Error("corrupt state file loaded")
+	}
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cjodo/go-cap"
+)
+
+var auditCmd = &command{
+	name:    "audit",
+	summary: "Review project access",
+	subs: []*command{
+		{name: "users", summary: "Audit user rights against least-privilege checks and a role policy", run: runAuditUsers},
+	},
+}
+
+// errFindings is returned when an audit finds violations, so CI jobs
+// fail after the report is written.
+var errFindings = errors.New("audit found violations")
+
+func runAuditUsers(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap audit users")
+	var (
+		policyPath = fs.String("policy", "", "YAML role policy file to check role drift against")
+		format     = fs.String("format", "text", "output format: text, json, csv")
+		out        = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "text", "json", "csv"); err != nil {
+		return err
+	}
+	var policy *redcap.AuditPolicy
+	if *policyPath != "" {
+		var err error
+		if policy, err = loadPolicy(*policyPath); err != nil {
+			return err
+		}
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	report, err := c.AuditUsers(ctx, policy)
+	if err != nil {
+		return err
+	}
+
+	err = a.writeTo(*out, func(w io.Writer) error {
+		switch *format {
+		case "json":
+			return writeJSON(w, report)
+		case "csv":
+			rows := make([][]string, len(report.Findings))
+			for i, f := range report.Findings {
+				rows[i] = []string{string(f.Check), f.Username, f.Role, f.Detail}
+			}
+			return writeCSV(w, []string{"check", "username", "role", "detail"}, rows)
+		}
+		return writeAuditText(w, report)
+	})
+	if err != nil {
+		return err
+	}
+	if len(report.Findings) > 0 {
+		return fmt.Errorf("%w: %d findings", errFindings, len(report.Findings))
+	}
+	return nil
+}
+
+// loadPolicy reads a role policy file. The policy's rights are checked
+// up front so a typo fails before any request.
+func loadPolicy(path string) (*redcap.AuditPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy redcap.AuditPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, usageErrorf("parsing %s: %v", path, err)
+	}
+	for label, rights := range policy.Roles {
+		for name, v := range rights {
+			if err := (&redcap.Rights{}).Set(name, v); err != nil {
+				return nil, usageErrorf("%s: role %q: %v", path, label, err)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+func writeAuditText(w io.Writer, r *redcap.AuditReport) error {
+	stage := "development"
+	if r.Production {
+		stage = "production"
+	}
+	if _, err := fmt.Fprintf(w, "%d users, %d roles, %d DAGs, %s\n", r.Users, r.Roles, r.DAGs, stage); err != nil {
+		return err
+	}
+	if len(r.Findings) == 0 {
+		_, err := fmt.Fprintln(w, "no findings")
+		return err
+	}
+	for _, f := range r.Findings {
+		who := f.Username
+		if who == "" {
+			who = "role " + f.Role
+		} else if f.Role != "" {
+			who += " (" + f.Role + ")"
+		}
+		if _, err := fmt.Fprintf(w, "%-24s %-28s %s\n", f.Check, who, f.Detail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
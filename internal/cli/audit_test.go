@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newAuditServer(t *testing.T, users string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("content") {
+		case "project":
+			w.Write([]byte(`[{"project_id":1,"in_production":1}]`))
+		case "metadata":
+			w.Write([]byte(`[{"field_name":"record_id","form_name":"demo","field_type":"text"}]`))
+		case "user":
+			w.Write([]byte(users))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAuditUsersExitCode(t *testing.T) {
+	cfg := writeConfig(t, "")
+
+	clean := newAuditServer(t, `[{"username":"ann","design":0}]`)
+	code, out := run("--config", cfg, "--url", clean.URL, "--token", flagToken, "audit", "users")
+	if code != ExitOK || !strings.Contains(out, "no findings") {
+		t.Errorf("audit without findings = %d: %s", code, out)
+	}
+
+	// Findings fail the command after the report is written
+	srv := newAuditServer(t, `[{"username":"ann","design":1}]`)
+	code, out = run("--config", cfg, "--url", srv.URL, "--token", flagToken, "audit", "users")
+	if code != ExitFindings {
+		t.Errorf("audit with findings = %d, want %d: %s", code, ExitFindings, out)
+	}
+	if !strings.Contains(out, "design_in_production") || !strings.Contains(out, "1 findings") {
+		t.Errorf("output:\n%s", out)
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "audit.json")
+	code, _ = run("--config", cfg, "--url", srv.URL, "--token", flagToken, "audit", "users", "--format", "json", "-o", reportPath)
+	if code != ExitFindings {
+		t.Errorf("audit --format json = %d, want %d", code, ExitFindings)
+	}
+	var report struct {
+		Findings []struct{ Check, Username string }
+	}
+	b, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].Username != "ann" {
+		t.Errorf("report findings = %+v", report.Findings)
+	}
+
+	// An exempt user is not a finding
+	policy := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policy, []byte("exempt:\n  design_in_production: [ann]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := run("--config", cfg, "--url", srv.URL, "--token", flagToken, "audit", "users", "--policy", policy); code != ExitOK {
+		t.Errorf("audit with exemption = %d: %s", code, out)
+	}
+	if err := os.WriteFile(policy, []byte("roles:\n  Coordinator:\n    design: maybe\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := run("--config", cfg, "--url", srv.URL, "--token", flagToken, "audit", "users", "--policy", policy); code != ExitUsage {
+		t.Errorf("audit with an invalid policy = %d, want %d: %s", code, ExitUsage, out)
+	}
+}
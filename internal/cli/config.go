@@ -0,0 +1,463 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cjodo/go-cap"
+)
+
+// Environment variables for configuration.
+const (
+	configEnv     = "CAP_CONFIG"
+	projectEnv    = "CAP_PROJECT"
+	timeoutEnv    = "CAP_TIMEOUT"
+	passphraseEnv = "CAP_PASSPHRASE"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// config is the ~/.cap.yaml file.
+type config struct {
+	URL            string                    `yaml:"url,omitempty"`
+	Token          string                    `yaml:"token,omitempty"`
+	TokenFrom      *redcap.TokenSpec         `yaml:"token_from,omitempty"`
+	Timeout        string                    `yaml:"timeout,omitempty"`
+	LogLevel       string                    `yaml:"log_level,omitempty"`
+	DefaultProject string                    `yaml:"default_project,omitempty"`
+	Projects       map[string]*projectConfig `yaml:"projects,omitempty"`
+}
+
+// projectConfig is one named project profile.
+type projectConfig struct {
+	URL       string            `yaml:"url"`
+	Token     string            `yaml:"token,omitempty"`
+	TokenFrom *redcap.TokenSpec `yaml:"token_from,omitempty"`
+	Timeout   string            `yaml:"timeout,omitempty"`
+	RPS       float64           `yaml:"rps,omitempty"`
+}
+
+// configPath returns the config file location: --config, CAP_CONFIG, or
+// ~/.cap.yaml.
+func (a *app) configPath() string {
+	if a.ConfigPath != "" {
+		return a.ConfigPath
+	}
+	if v := os.Getenv(configEnv); v != "" {
+		return v
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".cap.yaml"
+	}
+	return filepath.Join(home, ".cap.yaml")
+}
+
+// loadConfig reads the config file. A missing file is an empty config.
+func (a *app) loadConfig() (*config, error) {
+	if a.config != nil {
+		return a.config, nil
+	}
+	cfg := &config{}
+	path := a.configPath()
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("reading config: %w", err)
+	default:
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		a.debugf("loaded config %s", path)
+	}
+	if cfg.Projects == nil {
+		cfg.Projects = make(map[string]*projectConfig)
+	}
+	a.config = cfg
+	return cfg, nil
+}
+
+// saveConfig writes the config file with mode 0600, since it may hold
+// tokens.
+func (a *app) saveConfig(cfg *config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshaling config: %w", err)
+	}
+	path := a.configPath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	a.debugf("wrote %s", path)
+	return nil
+}
+
+// settings are the connection parameters after applying precedence:
+// flags, then environment, then the project profile, then defaults.
+type settings struct {
+	Project string
+	URL     string
+	Token   redcap.TokenSource
+	Timeout time.Duration
+	RPS     float64
+}
+
+func (a *app) resolve() (*settings, error) {
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &settings{Project: a.Project}
+	if s.Project == "" {
+		s.Project = os.Getenv(projectEnv)
+	}
+	if s.Project == "" {
+		s.Project = cfg.DefaultProject
+	}
+
+	// The profile layer: a named project, or the file's top level
+	prof := &projectConfig{URL: cfg.URL, Token: cfg.Token, TokenFrom: cfg.TokenFrom, Timeout: cfg.Timeout}
+	if s.Project != "" {
+		p, ok := cfg.Projects[s.Project]
+		if !ok {
+			return nil, usageErrorf("no project %q in %s", s.Project, a.configPath())
+		}
+		prof = p
+	}
+	s.RPS = prof.RPS
+
+	switch {
+	case a.URL != "":
+		s.URL = a.URL
+	case firstEnv(urlEnvVars) != "":
+		s.URL = firstEnv(urlEnvVars)
+	default:
+		s.URL = prof.URL
+	}
+	// A profile's token is only ever sent to the profile's own server
+	foreignURL := s.URL != prof.URL
+	if s.URL == "" {
+		return nil, usageErrorf("no REDCap URL: use --url, set %s, or configure a project", strings.Join(urlEnvVars, " or "))
+	}
+
+	switch {
+	case a.Token != "":
+		s.Token = redcap.StaticToken(a.Token)
+	case firstEnv(tokenEnvVars) != "":
+		s.Token = redcap.EnvToken(tokenEnvVars...)
+	case foreignURL && (prof.Token != "" || prof.TokenFrom != nil):
+		return nil, usageErrorf("the URL %s is not the one configured for %s; pass --token or set %s to use it",
+			s.URL, profileName(s.Project), strings.Join(tokenEnvVars, " or "))
+	case !foreignURL:
+		if s.Token, err = a.profileToken(s.Project, prof); err != nil {
+			return nil, err
+		}
+	}
+	if s.Token == nil {
+		return nil, usageErrorf("no REDCap token: use --token, set %s, or configure a project", strings.Join(tokenEnvVars, " or "))
+	}
+
+	timeout := prof.Timeout
+	if v := os.Getenv(timeoutEnv); v != "" {
+		timeout = v
+	}
+	if s.Timeout, err = parseTimeout(timeout); err != nil {
+		return nil, err
+	}
+	if a.Timeout > 0 {
+		s.Timeout = a.Timeout
+	}
+	return s, nil
+}
+
+// parseTimeout reads a configured timeout; empty means defaultTimeout.
+func parseTimeout(v string) (time.Duration, error) {
+	if v == "" {
+		return defaultTimeout, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, usageErrorf("invalid timeout %q: %v", v, err)
+	}
+	return d, nil
+}
+
+// profileName names the profile layer in messages.
+func profileName(project string) string {
+	if project == "" {
+		return "the default profile"
+	}
+	return "project " + project
+}
+
+// profileToken builds the token source of a profile, or nil if it has
+// none.
+func (a *app) profileToken(name string, p *projectConfig) (redcap.TokenSource, error) {
+	if p.Token != "" {
+		return redcap.StaticToken(p.Token), nil
+	}
+	if p.TokenFrom == nil {
+		return nil, nil
+	}
+	ts, err := p.TokenFrom.Source(name, a.passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("project %s: %w", name, err)
+	}
+	return ts, nil
+}
+
+// passphrase returns the token store passphrase from CAP_PASSPHRASE, or
+// prompts for it when attached to a terminal. It is asked for once.
+func (a *app) passphrase() ([]byte, error) {
+	if a.pass != nil {
+		return a.pass, nil
+	}
+	if v, ok := os.LookupEnv(passphraseEnv); ok {
+		a.pass = []byte(v)
+		return a.pass, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("token store passphrase needed: set %s", passphraseEnv)
+	}
+	fmt.Fprint(a.stderr, "Token store passphrase: ")
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(a.stderr)
+	if err != nil {
+		return nil, fmt.Errorf("reading passphrase: %w", err)
+	}
+	a.pass = pass
+	return pass, nil
+}
+
+var configCmd = &command{
+	name:    "config",
+	summary: "Manage project profiles in ~/.cap.yaml",
+	subs: []*command{
+		{name: "add", summary: "Add or replace a project profile", run: runConfigAdd},
+		{name: "list", summary: "List project profiles", run: runConfigList},
+		{name: "remove", summary: "Remove a project profile", run: runConfigRemove},
+		{name: "test", summary: "Check project profiles against the API", run: runConfigTest},
+	},
+}
+
+func runConfigAdd(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap config add")
+	var (
+		spec       redcap.TokenSpec
+		timeout    = fs.String("project-timeout", "", "request timeout for this project")
+		rps        = fs.Float64("rps", 0, "requests per second for this project's host")
+		setDefault = fs.Bool("default", false, "make this the default project")
+		skipTest   = fs.Bool("skip-test", false, "do not verify the profile against the API")
+	)
+	fs.StringVar(&spec.Env, "token-env", "", "read the token from this environment variable")
+	fs.StringVar(&spec.File, "token-file", "", "read the token from this file (mode 0600)")
+	fs.StringVar(&spec.Command, "token-command", "", "run this command to get the token")
+	fs.StringVar(&spec.Store, "token-store", "", "read the token from this encrypted token store")
+	fs.StringVar(&spec.Key, "token-key", "", "name of the token in the store (default: project name)")
+	positional, err := a.parse(fs, "<name> --url URL (--token T | --token-env VAR | --token-file F | --token-command CMD | --token-store F) [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap config add: expected a project name")
+	}
+	name := positional[0]
+	if a.URL == "" {
+		return usageErrorf("cap config add: --url is required")
+	}
+
+	p := &projectConfig{URL: a.URL, Token: a.Token, Timeout: *timeout, RPS: *rps}
+	sources := 0
+	for _, v := range []string{a.Token, spec.Env, spec.File, spec.Command, spec.Store} {
+		if v != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return usageErrorf("cap config add: give exactly one of --token, --token-env, --token-file, --token-command, --token-store")
+	}
+	if a.Token == "" {
+		p.TokenFrom = &spec
+	} else if err := redcap.ValidateToken(a.Token); err != nil {
+		return err
+	}
+
+	if !*skipTest {
+		if err := a.testProfile(ctx, name, p); err != nil {
+			return fmt.Errorf("profile %s not saved: %w", name, err)
+		}
+	}
+
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	cfg.Projects[name] = p
+	if *setDefault || len(cfg.Projects) == 1 && cfg.DefaultProject == "" {
+		cfg.DefaultProject = name
+	}
+	if err := a.saveConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "saved project %s\n", name)
+	return nil
+}
+
+func runConfigList(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap config list")
+	if _, err := a.parse(fs, "", args); err != nil {
+		return err
+	}
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range sortedProjects(cfg) {
+		p := cfg.Projects[name]
+		mark := " "
+		if name == cfg.DefaultProject {
+			mark = "*"
+		}
+		fmt.Fprintf(a.stdout, "%s %-20s %-50s %s\n", mark, name, p.URL, describeToken(p))
+	}
+	return nil
+}
+
+func runConfigRemove(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap config remove")
+	positional, err := a.parse(fs, "<name>", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap config remove: expected a project name")
+	}
+	name := positional[0]
+
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Projects[name]; !ok {
+		return usageErrorf("no project %q in %s", name, a.configPath())
+	}
+	delete(cfg.Projects, name)
+	if cfg.DefaultProject == name {
+		cfg.DefaultProject = ""
+	}
+	if err := a.saveConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "removed project %s\n", name)
+	return nil
+}
+
+func runConfigTest(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap config test")
+	names, err := a.parse(fs, "[name...]", args)
+	if err != nil {
+		return err
+	}
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = sortedProjects(cfg)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no profiles in %s; add one with cap config add", a.configPath())
+	}
+
+	var failed int
+	for _, name := range names {
+		p, ok := cfg.Projects[name]
+		if !ok {
+			return usageErrorf("no project %q in %s", name, a.configPath())
+		}
+		if err := a.testProfile(ctx, name, p); err != nil {
+			failed++
+			fmt.Fprintf(a.stdout, "%-20s FAIL %v\n", name, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d projects failed", failed, len(names))
+	}
+	return nil
+}
+
+// testProfile checks a profile with Ping and ExportProject and prints the
+// project it reaches.
+func (a *app) testProfile(ctx context.Context, name string, p *projectConfig) error {
+	ts, err := a.profileToken(name, p)
+	if err != nil {
+		return err
+	}
+	if ts == nil {
+		return errors.New("no token configured")
+	}
+	timeout, err := parseTimeout(p.Timeout)
+	if err != nil {
+		return err
+	}
+	c, err := a.newClient(&settings{Project: name, URL: p.URL, Token: ts, Timeout: timeout, RPS: p.RPS})
+	if err != nil {
+		return err
+	}
+	if err := c.Ping(ctx); err != nil {
+		return err
+	}
+	info, err := c.ExportProject(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "%-20s ok   %v (project %v)\n", name, info["project_title"], info["project_id"])
+	return nil
+}
+
+func sortedProjects(cfg *config) []string {
+	names := make([]string, 0, len(cfg.Projects))
+	for name := range cfg.Projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describeToken says where a profile's token comes from without
+// revealing it.
+func describeToken(p *projectConfig) string {
+	if p.Token != "" {
+		return "token: inline"
+	}
+	if t := p.TokenFrom; t != nil {
+		switch {
+		case t.Env != "":
+			return "token: env " + t.Env
+		case t.File != "":
+			return "token: file " + t.File
+		case t.Command != "":
+			return "token: command " + t.Command
+		case t.Store != "":
+			return "token: store " + t.Store
+		}
+	}
+	return "token: none"
+}
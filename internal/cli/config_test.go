@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	profileToken = "11111111111111111111111111111111"
+	flagToken    = "22222222222222222222222222222222"
+)
+
+// projectServer answers project exports and records the tokens it sees.
+type projectServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	tokens []string
+}
+
+func newProjectServer(t *testing.T) *projectServer {
+	s := &projectServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.tokens = append(s.tokens, r.FormValue("token"))
+		s.mu.Unlock()
+		w.Write([]byte(`[{"project_id":1,"project_title":"Test"}]`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *projectServer) seen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokens...)
+}
+
+// writeConfig writes a config file and clears the connection variables
+// so that only the test's settings apply.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	for _, name := range []string{"REDCAP_URL", "CAP_URL", "REDCAP_TOKEN", "CAP_TOKEN", configEnv, projectEnv, timeoutEnv} {
+		t.Setenv(name, "")
+	}
+	path := filepath.Join(t.TempDir(), "cap.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func run(args ...string) (int, string) {
+	var out bytes.Buffer
+	code := Run(context.Background(), args, &out, &out)
+	return code, out.String()
+}
+
+func TestProfileTokenStaysWithProfileURL(t *testing.T) {
+	profile := newProjectServer(t)
+	other := newProjectServer(t)
+	cfg := writeConfig(t, "default_project: study1\nprojects:\n  study1:\n    url: "+profile.URL+"\n    token: "+profileToken+"\n")
+
+	if code, out := run("--config", cfg, "ping"); code != ExitOK {
+		t.Fatalf("ping with the profile = %d: %s", code, out)
+	}
+	if got := profile.seen(); len(got) == 0 || got[0] != profileToken {
+		t.Errorf("profile server saw %v", got)
+	}
+
+	code, out := run("--config", cfg, "--url", other.URL, "ping")
+	if code != ExitUsage || !strings.Contains(out, "--token") {
+		t.Errorf("ping --url elsewhere = %d: %s, want a usage error", code, out)
+	}
+	t.Setenv("REDCAP_URL", other.URL)
+	if code, _ := run("--config", cfg, "ping"); code != ExitUsage {
+		t.Errorf("ping with REDCAP_URL elsewhere = %d, want a usage error", code)
+	}
+	if got := other.seen(); len(got) != 0 {
+		t.Fatalf("other server was sent tokens %v", got)
+	}
+
+	if code, out := run("--config", cfg, "--url", other.URL, "--token", flagToken, "ping"); code != ExitOK {
+		t.Fatalf("ping --url --token = %d: %s", code, out)
+	}
+	if got := other.seen(); len(got) != 1 || got[0] != flagToken {
+		t.Errorf("other server saw %v, want only the --token", got)
+	}
+}
+
+func TestConfigTestNoProfiles(t *testing.T) {
+	cfg := writeConfig(t, "")
+	code, out := run("--config", cfg, "config", "test")
+	if code == ExitOK || !strings.Contains(out, "no profiles") {
+		t.Errorf("config test with no profiles = %d: %q", code, out)
+	}
+}
+
+func TestConfigTestUsesProfileTimeout(t *testing.T) {
+	srv := newProjectServer(t)
+	cfg := writeConfig(t, "projects:\n  fast:\n    url: "+srv.URL+"\n    token: "+profileToken+"\n    timeout: 5s\n"+
+		"  broken:\n    url: "+srv.URL+"\n    token: "+profileToken+"\n    timeout: soon\n")
+
+	code, out := run("--config", cfg, "config", "test")
+	if code == ExitOK {
+		t.Errorf("config test with a broken profile exited 0")
+	}
+	if !strings.Contains(out, `broken               FAIL invalid timeout "soon"`) || !strings.Contains(out, "fast                 ok") {
+		t.Errorf("config test output:\n%s", out)
+	}
+}
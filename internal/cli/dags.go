@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cjodo/go-cap"
+)
+
+var dagsCmd = &command{
+	name:    "dags",
+	summary: "Manage data access groups",
+	subs: []*command{
+		{name: "list", summary: "List data access groups", run: runDAGsList},
+		{name: "create", summary: "Create data access groups", run: runDAGsCreate},
+		{name: "rename", summary: "Rename a data access group", run: runDAGsRename},
+		{name: "delete", summary: "Delete data access groups", run: runDAGsDelete},
+		{name: "users", summary: "List users with their data access group", run: runDAGsUsers},
+		{name: "assign", summary: "Assign users to a data access group", run: runDAGsAssign},
+		{name: "records", summary: "Assign records to a data access group", run: runDAGsRecords},
+		{name: "switch", summary: "Switch the API user's current data access group", run: runDAGsSwitch},
+	},
+}
+
+func runDAGsList(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap dags list")
+	var (
+		format = fs.String("format", "text", "output format: text, json, csv")
+		out    = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "text", "json", "csv"); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	dags, err := c.ExportDAGs(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		switch *format {
+		case "json":
+			return writeJSON(w, dags)
+		case "csv":
+			rows := make([][]string, len(dags))
+			for i, d := range dags {
+				rows[i] = []string{d.UniqueGroupName, d.GroupName}
+			}
+			return writeCSV(w, []string{"unique_group_name", "data_access_group_name"}, rows)
+		}
+		for _, d := range dags {
+			if _, err := fmt.Fprintf(w, "%-24s %s\n", d.UniqueGroupName, d.GroupName); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func runDAGsCreate(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap dags create")
+	positional, err := a.parse(fs, "<name>...", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return usageErrorf("cap dags create: expected at least one group name")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	dags := make([]redcap.DAG, len(positional))
+	for i, name := range positional {
+		dags[i] = redcap.DAG{GroupName: name}
+	}
+	n, err := c.ImportDAGs(ctx, dags)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "created %d DAGs\n", n)
+	return nil
+}
+
+func runDAGsRename(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap dags rename")
+	positional, err := a.parse(fs, "<unique-group-name> <new name>", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return usageErrorf("cap dags rename: expected a unique group name and a new name")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	_, err = c.ImportDAGs(ctx, []redcap.DAG{{UniqueGroupName: positional[0], GroupName: positional[1]}})
+	return err
+}
+
+func runDAGsDelete(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap dags delete")
+	positional, err := a.parse(fs, "<unique-group-name>...", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return usageErrorf("cap dags delete: expected at least one unique group name")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	n, err := c.DeleteDAGs(ctx, positional)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "deleted %d DAGs\n", n)
+	return nil
+}
+
+func runDAGsUsers(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap dags users")
+	var (
+		format = fs.String("format", "text", "output format: text, json, csv")
+		out    = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "text", "json", "csv"); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	mappings, err := c.ExportUserDAGMapping(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		switch *format {
+		case "json":
+			return writeJSON(w, mappings)
+		case "csv":
+			rows := make([][]string, len(mappings))
+			for i, m := range mappings {
+				rows[i] = []string{m.Username, m.DataAccessGroup}
+			}
+			return writeCSV(w, []string{"username", "redcap_data_access_group"}, rows)
+		}
+		for _, m := range mappings {
+			if _, err := fmt.Fprintf(w, "%-20s %s\n", m.Username, m.DataAccessGroup); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dagTarget reads the group argument of assign and records, which --none
+// replaces.
+func dagTarget(cmd string, none bool, positional []string) (string, []string, error) {
+	if none {
+		if len(positional) == 0 {
+			return "", nil, usageErrorf("%s: expected at least one name", cmd)
+		}
+		return "", positional, nil
+	}
+	if len(positional) < 2 {
+		return "", nil, usageErrorf("%s: expected a unique group name and at least one name", cmd)
+	}
+	return positional[0], positional[1:], nil
+}
+
+func runDAGsAssign(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap dags assign")
+	none := fs.Bool("none", false, "take the users out of their group")
+	positional, err := a.parse(fs, "<unique-group-name> <username>... | --none <username>...", args)
+	if err != nil {
+		return err
+	}
+	dag, users, err := dagTarget("cap dags assign", *none, positional)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	mappings := make([]redcap.UserDAGMapping, len(users))
+	for i, u := range users {
+		mappings[i] = redcap.UserDAGMapping{Username: u, DataAccessGroup: dag}
+	}
+	n, err := c.ImportUserDAGMapping(ctx, mappings)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "assigned %d users\n", n)
+	return nil
+}
+
+func runDAGsRecords(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap dags records")
+	none := fs.Bool("none", false, "take the records out of their group")
+	positional, err := a.parse(fs, "<unique-group-name> <record>... | --none <record>...", args)
+	if err != nil {
+		return err
+	}
+	dag, records, err := dagTarget("cap dags records", *none, positional)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	res, err := c.AssignRecordsToDAG(ctx, dag, records)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "assigned %d records\n", res.Count)
+	return nil
+}
+
+func runDAGsSwitch(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap dags switch")
+	positional, err := a.parse(fs, "<unique-group-name>", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || strings.TrimSpace(positional[0]) == "" {
+		return usageErrorf("cap dags switch: expected one unique group name")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	if err := c.SwitchDAG(ctx, positional[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "switched to %s\n", positional[0])
+	return nil
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cjodo/go-cap"
+)
+
+var designCmd = &command{
+	name:    "design",
+	summary: "Manage the longitudinal design: arms, events and form-event mapping",
+	subs: []*command{
+		{name: "export", summary: "Write the arms, events and mapping as JSON", run: runDesignExport},
+		{name: "apply", summary: "Bring the project to a design file with the fewest changes", run: runDesignApply},
+	},
+}
+
+func runDesignExport(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap design export")
+	out := fs.String("out", "", "output file (default stdout)")
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	design, err := c.ExportLongitudinalDesign(ctx)
+	if err != nil {
+		return err
+	}
+	return a.writeTo(*out, func(w io.Writer) error {
+		return writeJSON(w, design)
+	})
+}
+
+func runDesignApply(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap design apply")
+	var (
+		dryRun      = fs.Bool("dry-run", false, "show the changes without making them")
+		allowDelete = fs.Bool("allow-delete", false, "delete arms and events the file leaves out, with their data")
+	)
+	positional, err := a.parse(fs, "<design.json|design.yaml> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap design apply: expected one design file")
+	}
+	desired, err := loadDesign(positional[0])
+	if err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	current, err := c.ExportLongitudinalDesign(ctx)
+	if err != nil {
+		return err
+	}
+	plan, err := redcap.DiffLongitudinalDesign(current, desired)
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		fmt.Fprintln(a.stderr, "design is up to date")
+		return nil
+	}
+	for _, line := range plan.Changes() {
+		fmt.Fprintln(a.stdout, line)
+	}
+	if *dryRun {
+		return nil
+	}
+	if plan.Destructive() && !*allowDelete {
+		return usageErrorf("the design deletes arms or events and their data; review the plan with --dry-run and rerun with --allow-delete")
+	}
+
+	if err := c.ApplyDesignPlan(ctx, plan); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "applied %d changes\n", len(plan.Changes()))
+	return nil
+}
+
+// loadDesign reads a design file. JSON is valid YAML, so both are read
+// as YAML and decoded through JSON, which keeps REDCap's field names.
+func loadDesign(path string) (*redcap.LongitudinalDesign, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, usageErrorf("parsing %s: %v", path, err)
+	}
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return nil, usageErrorf("parsing %s: %v", path, err)
+	}
+	var design redcap.LongitudinalDesign
+	if err := json.Unmarshal(data, &design); err != nil {
+		return nil, usageErrorf("parsing %s: %v", path, err)
+	}
+	return &design, nil
+}
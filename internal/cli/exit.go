@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cjodo/go-cap"
+)
+
+// Exit codes. API failures map from redcap.Error.Code so scripts can tell
+// a bad token from a server outage.
+const (
+	ExitOK           = 0
+	ExitError        = 1
+	ExitUsage        = 2
+	ExitUnauthorized = 3
+	ExitForbidden    = 4
+	ExitNotFound     = 5
+	ExitInvalid      = 6
+	ExitRateLimit    = 7
+	ExitServerError  = 8
+	ExitUnavailable  = 9
+	ExitTimeout      = 10
+	ExitFindings     = 11
+)
+
+func exitCode(err error) int {
+	var uerr *usageError
+	if errors.As(err, &uerr) {
+		return ExitUsage
+	}
+	if errors.Is(err, errFindings) {
+		return ExitFindings
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ExitTimeout
+	}
+	if errors.Is(err, redcap.ErrCircuitOpen) {
+		return ExitUnavailable
+	}
+	if errors.Is(err, redcap.ErrInvalidData) || errors.Is(err, redcap.ErrSnapshotCorrupt) {
+		return ExitInvalid
+	}
+
+	var rerr *redcap.Error
+	if errors.As(err, &rerr) {
+		switch rerr.Code {
+		case redcap.ErrCodeUnauthorized:
+			return ExitUnauthorized
+		case redcap.ErrCodeForbidden:
+			return ExitForbidden
+		case redcap.ErrCodeNotFound:
+			return ExitNotFound
+		case redcap.ErrCodeInvalidRequest:
+			return ExitInvalid
+		case redcap.ErrCodeRateLimit:
+			return ExitRateLimit
+		case redcap.ErrCodeServerError:
+			return ExitServerError
+		}
+	}
+
+	var resErr *redcap.ResponseError
+	if errors.As(err, &resErr) {
+		return ExitUnavailable
+	}
+	return ExitError
+}
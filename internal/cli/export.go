@@ -0,0 +1,314 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cjodo/go-cap"
+	"github.com/cjodo/go-cap/parquet"
+	"github.com/cjodo/go-cap/xlsx"
+)
+
+var exportCmd = &command{
+	name:    "export",
+	summary: "Export data from a project",
+	subs: []*command{
+		{name: "records", summary: "Export records", run: runExportRecords},
+		{name: "report", summary: "Export a report by ID", run: runExportReport},
+		{name: "log", summary: "Export project logging", run: runExportLog},
+		{name: "metadata", summary: "Export the data dictionary", run: exportContent("metadata")},
+		{name: "forms", summary: "List instruments", run: exportContent("instrument")},
+		{name: "users", summary: "Export project users", run: exportContent("user")},
+		{name: "events", summary: "Export longitudinal events", run: exportContent("event")},
+	},
+}
+
+func runExportRecords(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap export records")
+	var (
+		records = fs.String("records", "", "comma-separated record IDs")
+		fields  = fs.String("fields", "", "comma-separated field names")
+		forms   = fs.String("forms", "", "comma-separated form names")
+		events  = fs.String("events", "", "comma-separated unique event names")
+		format  = fs.String("format", "json", "output format: json, csv, parquet, xlsx")
+		out     = fs.String("out", "", "output file (default stdout)")
+		raw     = fs.Bool("raw", false, "export raw values instead of labels")
+		filter  = fs.String("filter", "", "filter logic expression")
+		batch   = fs.Int("batch-size", 500, "records per API call for parquet and xlsx output")
+
+		sinceLastRun = fs.Bool("since-last-run", false, "export records changed since the last run and merge them into --out")
+		statePath    = fs.String("state", "", "incremental export state file (default ~/.cap-state.json)")
+		overlap      = fs.Duration("overlap", redcap.DefaultOverlap, "re-export window before the last run, for clock skew")
+		full         = fs.Bool("full", false, "with --since-last-run, re-export everything")
+		serverTZ     = fs.String("server-tz", "", "REDCap server time zone, e.g. America/Chicago (default local)")
+
+		combined = fs.Bool("combined", false, "with --format xlsx, write one sheet instead of one per instrument")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "json", "csv", "parquet", "xlsx"); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return usageErrorf("--batch-size must be positive")
+	}
+	if *sinceLastRun {
+		if *out == "" || *out == "-" {
+			return usageErrorf("--since-last-run needs a dataset file in --out")
+		}
+		if *format != "json" {
+			return usageErrorf("--since-last-run keeps a JSON dataset; --format must be json")
+		}
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	rawOrLabel := "label"
+	if *raw {
+		rawOrLabel = "raw"
+	}
+	opts := []redcap.ExportOption{
+		redcap.ExportRawOrLabel(rawOrLabel),
+	}
+	if v := commaList(*records); len(v) > 0 {
+		opts = append(opts, redcap.ExportRecordsFilter(v))
+	}
+	if v := commaList(*fields); len(v) > 0 {
+		opts = append(opts, redcap.ExportFields(v))
+	}
+	if v := commaList(*forms); len(v) > 0 {
+		opts = append(opts, redcap.ExportForms(v))
+	}
+	if v := commaList(*events); len(v) > 0 {
+		opts = append(opts, redcap.ExportEvents(v))
+	}
+	if *filter != "" {
+		opts = append(opts, redcap.ExportFilterLogic(*filter))
+	}
+
+	switch {
+	case *format == "parquet":
+		return a.exportParquet(ctx, c, opts, *out, *batch)
+	case *format == "xlsx":
+		return a.exportXLSX(ctx, c, opts, *out, *batch, xlsx.Options{Combined: *combined})
+	case *sinceLastRun:
+		return a.exportIncremental(ctx, c, opts, *out, *statePath, *overlap, *full, *serverTZ)
+	}
+
+	body, err := c.ExportRecordsRaw(ctx, append(opts, redcap.ExportFormat(*format))...)
+	if err != nil {
+		return err
+	}
+	return a.writeTo(*out, func(w io.Writer) error {
+		return writeRaw(w, *format, body)
+	})
+}
+
+func runExportReport(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap export report")
+	var (
+		format         = fs.String("format", "json", "output format: json, csv")
+		out            = fs.String("out", "", "output file (default stdout)")
+		raw            = fs.Bool("raw", false, "export raw values instead of labels")
+		labelHeaders   = fs.Bool("label-headers", false, "with --format csv, use field labels as column headers")
+		checkboxLabels = fs.Bool("checkbox-labels", false, "export checked choices as their labels instead of Checked")
+		typed          = fs.Bool("typed", false, "decode values by field type and write JSON keyed by field name")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	positional, err := a.parse(fs, "<report-id> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap export report: expected one report ID")
+	}
+	id, err := strconv.Atoi(positional[0])
+	if err != nil || id < 1 {
+		return usageErrorf("cap export report: invalid report ID %q", positional[0])
+	}
+	if err := checkFormat(*format, "json", "csv"); err != nil {
+		return err
+	}
+	if *labelHeaders && *format != "csv" && !*typed {
+		return usageErrorf("--label-headers needs --format csv")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	rawOrLabel := "label"
+	if *raw {
+		rawOrLabel = "raw"
+	}
+	opts := []redcap.ExportOption{
+		redcap.ExportRawOrLabel(rawOrLabel),
+		redcap.ExportCheckboxLabel(*checkboxLabels),
+	}
+	if *labelHeaders {
+		opts = append(opts, redcap.ExportRawOrLabelHeaders("label"))
+	}
+
+	if *typed {
+		fields, err := c.ExportMetadata(ctx)
+		if err != nil {
+			return fmt.Errorf("exporting data dictionary: %w", err)
+		}
+		rows, err := c.ExportReportTyped(ctx, id, redcap.NewDictionary(fields), opts...)
+		if err != nil {
+			return err
+		}
+		return a.writeTo(*out, func(w io.Writer) error {
+			return writeJSON(w, rows)
+		})
+	}
+
+	body, err := c.ExportReportRaw(ctx, id, append(opts, redcap.ExportFormat(*format))...)
+	if err != nil {
+		return err
+	}
+	return a.writeTo(*out, func(w io.Writer) error {
+		return writeRaw(w, *format, body)
+	})
+}
+
+// exportParquet streams records to a Parquet file batch by batch.
+func (a *app) exportParquet(ctx context.Context, c *redcap.Client, opts []redcap.ExportOption, out string, batchSize int) error {
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("exporting data dictionary: %w", err)
+	}
+	dict := redcap.NewDictionary(fields)
+
+	var invalid map[string]int
+	err = a.writeTo(out, func(w io.Writer) error {
+		pw := parquet.NewWriter(w, dict)
+		invalid = pw.Invalid
+		if err := c.ExportRecordBatches(ctx, batchSize, pw.Write, opts...); err != nil {
+			return err
+		}
+		return pw.Close()
+	})
+	if err != nil {
+		return err
+	}
+	for col, n := range invalid {
+		fmt.Fprintf(a.stderr, "warning: %d values of %s did not match its type and were written as null\n", n, col)
+	}
+	return nil
+}
+
+// exportXLSX writes records to an Excel workbook, exported batch by batch.
+func (a *app) exportXLSX(ctx context.Context, c *redcap.Client, opts []redcap.ExportOption, out string, batchSize int, xo xlsx.Options) error {
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("exporting data dictionary: %w", err)
+	}
+	dict := redcap.NewDictionary(fields)
+
+	return a.writeTo(out, func(w io.Writer) error {
+		xw := xlsx.NewWriter(w, dict, xo)
+		if err := c.ExportRecordBatches(ctx, batchSize, xw.Write, opts...); err != nil {
+			return err
+		}
+		return xw.Close()
+	})
+}
+
+// exportIncremental runs an incremental export into the dataset file,
+// keyed in the state file by profile name, or URL without a profile.
+func (a *app) exportIncremental(ctx context.Context, c *redcap.Client, opts []redcap.ExportOption, dataset, statePath string, overlap time.Duration, full bool, serverTZ string) error {
+	s, err := a.resolve()
+	if err != nil {
+		return err
+	}
+	key := s.Project
+	if key == "" {
+		key = s.URL
+	}
+	if statePath == "" {
+		statePath = defaultStatePath()
+	}
+	loc := time.Local
+	if serverTZ != "" {
+		if loc, err = time.LoadLocation(serverTZ); err != nil {
+			return usageErrorf("invalid --server-tz: %v", err)
+		}
+	}
+
+	e := &redcap.IncrementalExporter{
+		Client:      c,
+		Key:         key,
+		StatePath:   statePath,
+		DatasetPath: dataset,
+		Overlap:     overlap,
+		Location:    loc,
+		Options:     opts,
+		Full:        full,
+	}
+	res, err := e.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if res.Full {
+		fmt.Fprintf(a.stderr, "full export: %d records\n", res.Records)
+	} else {
+		fmt.Fprintf(a.stderr, "%d records changed since %s; dataset has %d records\n",
+			len(res.Changed), res.Begin.In(loc).Format(time.RFC3339), res.Records)
+	}
+	a.debugf("next export starts from %s", res.Mark.Format(time.RFC3339))
+	return nil
+}
+
+// defaultStatePath returns ~/.cap-state.json.
+func defaultStatePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".cap-state.json"
+	}
+	return filepath.Join(home, ".cap-state.json")
+}
+
+// exportContent returns a command exporting a simple REDCap content type
+// in the format REDCap renders it.
+func exportContent(content string) func(ctx context.Context, a *app, args []string) error {
+	return func(ctx context.Context, a *app, args []string) error {
+		fs := a.flags("cap export " + content)
+		var (
+			format = fs.String("format", "json", "output format: json, csv")
+			out    = fs.String("out", "", "output file (default stdout)")
+		)
+		fs.StringVar(out, "o", "", "shorthand for --out")
+		if _, err := a.parse(fs, "[options]", args); err != nil {
+			return err
+		}
+		if err := checkFormat(*format, "json", "csv"); err != nil {
+			return err
+		}
+
+		c, err := a.Client()
+		if err != nil {
+			return err
+		}
+		body, err := c.Request(ctx, content, map[string]string{
+			"format": *format,
+		})
+		if err != nil {
+			return err
+		}
+		return a.writeTo(*out, func(w io.Writer) error {
+			return writeRaw(w, *format, body)
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cjodo/go-cap"
+)
+
+var filesCmd = &command{
+	name:    "files",
+	summary: "Manage project files",
+	subs: []*command{
+		{name: "get", summary: "Download the file in a record's file-upload field", run: runFilesGet},
+		{name: "download", summary: "Download every file-upload value into a directory", run: runFilesDownload},
+		{
+			name:    "repo",
+			summary: "Manage the File Repository",
+			subs: []*command{
+				{name: "list", summary: "List folders and files", run: runRepoList},
+				{name: "mkdir", summary: "Create a folder", run: runRepoMkdir},
+				{name: "get", summary: "Download a file", run: runRepoGet},
+				{name: "put", summary: "Upload files", run: runRepoPut},
+				{name: "rm", summary: "Delete files", run: runRepoRm},
+				{
+					name:    "sync",
+					summary: "Mirror a local directory and a repository folder",
+					subs: []*command{
+						{name: "push", summary: "Upload new and changed local files", run: runRepoPush},
+						{name: "pull", summary: "Download new and changed repository files", run: runRepoPull},
+					},
+				},
+			},
+		},
+	},
+}
+
+func runFilesGet(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap files get")
+	var (
+		event    = fs.String("event", "", "unique event name (longitudinal projects)")
+		instance = fs.Int("instance", 0, "repeat instance")
+		out      = fs.String("out", "", "output file, - for stdout (default the uploaded file name)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	positional, err := a.parse(fs, "<record> <field> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return usageErrorf("cap files get: expected a record ID and a field")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	f, err := c.ExportFile(ctx, positional[0], positional[1], *event, redcap.FileRepeatInstance(*instance))
+	if err != nil {
+		return err
+	}
+	return a.saveFile(*out, f.Name, f.Data)
+}
+
+// saveFile writes a downloaded file to dst, to stdout for "-", or under
+// the server-sent name when dst is empty.
+func (a *app) saveFile(dst, name string, data []byte) error {
+	if dst == "" {
+		// Never trust a server-sent name with a path
+		dst = filepath.Base(name)
+		if name == "" || dst == "." || dst == ".." || dst == string(filepath.Separator) {
+			return usageErrorf("the server sent no file name; pass -o")
+		}
+	}
+	if dst == "-" {
+		_, err := a.stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "wrote %s (%d bytes)\n", dst, len(data))
+	return nil
+}
+
+func runFilesDownload(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap files download")
+	var (
+		records     = fs.String("records", "", "comma-separated record IDs (default all)")
+		fields      = fs.String("fields", "", "comma-separated file fields (default all)")
+		concurrency = fs.Int("concurrency", redcap.DefaultConcurrency, "files to download at once")
+		force       = fs.Bool("force", false, "download files again even if the manifest has them")
+		quiet       = fs.Bool("quiet", false, "do not print each file")
+	)
+	positional, err := a.parse(fs, "<dir> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap files download: expected one directory")
+	}
+	if *concurrency < 1 {
+		return usageErrorf("--concurrency must be at least 1")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	d := &redcap.FileDownloader{
+		Client:      c,
+		Dir:         positional[0],
+		Records:     commaList(*records),
+		Fields:      commaList(*fields),
+		Concurrency: *concurrency,
+		Force:       *force,
+	}
+	if !*quiet {
+		d.Progress = func(f redcap.DownloadedFile, skipped bool) {
+			if !skipped {
+				fmt.Fprintln(a.stdout, f.Path)
+			}
+		}
+	}
+	res, err := d.Download(ctx)
+	if res != nil {
+		fmt.Fprintf(a.stderr, "downloaded %d files (%d bytes), %d already present\n", res.Downloaded, res.Bytes, res.Skipped)
+	}
+	return err
+}
+
+// repoEntry is a listed item with its path from the listed folder.
+type repoEntry struct {
+	Path string `json:"path"`
+	redcap.RepositoryItem
+}
+
+func runRepoList(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap files repo list")
+	var (
+		folder    = fs.Int("folder", 0, "folder ID (default the top level)")
+		recursive = fs.Bool("recursive", false, "list subfolders too")
+		format    = fs.String("format", "text", "output format: text, json, csv")
+		out       = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.BoolVar(recursive, "r", false, "shorthand for --recursive")
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "text", "json", "csv"); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	entries := []repoEntry{}
+	var walk func(folder int, dir string) error
+	walk = func(folder int, dir string) error {
+		items, err := c.ListRepository(ctx, folder)
+		if err != nil {
+			return err
+		}
+		for _, it := range items {
+			p := path.Join(dir, it.Name)
+			if it.IsFolder() {
+				p += "/"
+			}
+			entries = append(entries, repoEntry{Path: p, RepositoryItem: it})
+			if it.IsFolder() && *recursive {
+				if err := walk(it.FolderID, path.Join(dir, it.Name)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(*folder, ""); err != nil {
+		return err
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		switch *format {
+		case "json":
+			return writeJSON(w, entries)
+		case "csv":
+			rows := make([][]string, len(entries))
+			for i, e := range entries {
+				rows[i] = []string{repoID(e.RepositoryItem), e.Path}
+			}
+			return writeCSV(w, []string{"id", "path"}, rows)
+		}
+		for _, e := range entries {
+			if _, err := fmt.Fprintf(w, "%-10s %s\n", repoID(e.RepositoryItem), e.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// repoID shows folder IDs as "folder:N" and doc IDs as plain numbers,
+// since the two number independently.
+func repoID(it redcap.RepositoryItem) string {
+	if it.IsFolder() {
+		return "folder:" + strconv.Itoa(it.FolderID)
+	}
+	return strconv.Itoa(it.DocID)
+}
+
+func runRepoMkdir(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap files repo mkdir")
+	parent := fs.Int("folder", 0, "parent folder ID (default the top level)")
+	positional, err := a.parse(fs, "<name> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap files repo mkdir: expected one folder name")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	id, err := c.CreateRepositoryFolder(ctx, positional[0], *parent)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout, id)
+	return nil
+}
+
+func runRepoGet(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap files repo get")
+	out := fs.String("out", "", "output file, - for stdout (default the repository file name)")
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	positional, err := a.parse(fs, "<doc_id> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap files repo get: expected one doc ID")
+	}
+	doc, err := strconv.Atoi(positional[0])
+	if err != nil {
+		return usageErrorf("invalid doc ID %q", positional[0])
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	name, data, err := c.ExportRepositoryFile(ctx, doc)
+	if err != nil {
+		return err
+	}
+	return a.saveFile(*out, name, data)
+}
+
+func runRepoPut(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap files repo put")
+	folder := fs.Int("folder", 0, "folder ID (default the top level)")
+	positional, err := a.parse(fs, "<file>... [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return usageErrorf("cap files repo put: expected at least one file")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	for _, p := range positional {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := c.ImportRepositoryFile(ctx, *folder, filepath.Base(p), data); err != nil {
+			return fmt.Errorf("uploading %s: %w", p, err)
+		}
+	}
+	fmt.Fprintf(a.stderr, "uploaded %d files\n", len(positional))
+	return nil
+}
+
+func runRepoRm(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap files repo rm")
+	positional, err := a.parse(fs, "<doc_id>...", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return usageErrorf("cap files repo rm: expected at least one doc ID")
+	}
+	docs := make([]int, len(positional))
+	for i, p := range positional {
+		if docs[i], err = strconv.Atoi(p); err != nil {
+			return usageErrorf("invalid doc ID %q", p)
+		}
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := c.DeleteRepositoryFile(ctx, doc); err != nil {
+			return fmt.Errorf("deleting %d: %w", doc, err)
+		}
+	}
+	fmt.Fprintf(a.stderr, "deleted %d files\n", len(docs))
+	return nil
+}
+
+func runRepoPush(ctx context.Context, a *app, args []string) error {
+	return runRepoSync(ctx, a, "push", args)
+}
+
+func runRepoPull(ctx context.Context, a *app, args []string) error {
+	return runRepoSync(ctx, a, "pull", args)
+}
+
+func runRepoSync(ctx context.Context, a *app, direction string, args []string) error {
+	name := "cap files repo sync " + direction
+	fs := a.flags(name)
+	var (
+		folder = fs.Int("folder", 0, "repository folder ID (default the top level)")
+		del    = fs.Bool("delete", false, "delete files missing from the source side, emptying repository folders on push")
+		dryRun = fs.Bool("dry-run", false, "show the changes without making them")
+		state  = fs.String("state", "", "state file (default "+redcap.RepositoryStateFile+" in the directory)")
+	)
+	positional, err := a.parse(fs, "<dir> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("%s: expected one directory", name)
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	s := &redcap.RepositorySync{
+		Client:    c,
+		Dir:       positional[0],
+		Folder:    *folder,
+		StatePath: *state,
+		Delete:    *del,
+		DryRun:    *dryRun,
+	}
+	var report *redcap.RepositorySyncReport
+	if direction == "push" {
+		report, err = s.Push(ctx)
+	} else {
+		report, err = s.Pull(ctx)
+	}
+	if report != nil {
+		for _, ch := range report.Changes {
+			fmt.Fprintf(a.stdout, "%-14s %s\n", ch.Action, ch.Path)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	verb := "changed"
+	if *dryRun {
+		verb = "would change"
+	}
+	fmt.Fprintf(a.stderr, "%s %d, unchanged %d\n", verb, len(report.Changes), report.Unchanged)
+	return nil
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errHelp is returned when -h or --help was requested.
+var errHelp = flag.ErrHelp
+
+// usageError is a mistake on the command line.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// globalFlags are the names registered by flags.
+var globalFlags = map[string]bool{
+	"url": true, "u": true, "token": true, "t": true,
+	"timeout": true, "verbose": true, "v": true,
+	"config": true, "project": true, "p": true,
+}
+
+// flags returns a FlagSet for a command with the global flags registered,
+// so they may appear anywhere on the command line.
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	fs.StringVar(&a.URL, "url", a.URL, "REDCap API URL (env REDCAP_URL, CAP_URL)")
+	fs.StringVar(&a.URL, "u", a.URL, "shorthand for --url")
+	fs.StringVar(&a.Token, "token", a.Token, "REDCap API token (env REDCAP_TOKEN, CAP_TOKEN)")
+	fs.StringVar(&a.Token, "t", a.Token, "shorthand for --token")
+	fs.DurationVar(&a.Timeout, "timeout", a.Timeout, "request timeout (default 30s)")
+	fs.BoolVar(&a.Verbose, "verbose", a.Verbose, "log API calls to stderr")
+	fs.BoolVar(&a.Verbose, "v", a.Verbose, "shorthand for --verbose")
+	fs.StringVar(&a.ConfigPath, "config", a.ConfigPath, "config file (env CAP_CONFIG, default ~/.cap.yaml)")
+	fs.StringVar(&a.Project, "project", a.Project, "project profile from the config file (env CAP_PROJECT)")
+	fs.StringVar(&a.Project, "p", a.Project, "shorthand for --project")
+	return fs
+}
+
+// parse parses a leaf command's arguments, printing usage on -h. Flags
+// and positional arguments may be mixed.
+func (a *app) parse(fs *flag.FlagSet, usage string, args []string) ([]string, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: %s %s\n\nOptions:\n", fs.Name(), usage)
+		fs.VisitAll(func(f *flag.Flag) {
+			if globalFlags[f.Name] {
+				return
+			}
+			name, help := flag.UnquoteUsage(f)
+			if f.DefValue != "" && f.DefValue != "false" {
+				help += fmt.Sprintf(" (default %q)", f.DefValue)
+			}
+			fmt.Fprintf(a.stderr, "  -%s %s\n    \t%s\n", f.Name, name, help)
+		})
+		fmt.Fprintf(a.stderr, "\nGlobal options are listed by 'cap help'.\n")
+	}
+	return parseArgs(fs, args)
+}
+
+// parseArgs parses flags interspersed with positional arguments, which
+// the flag package alone stops at.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, usageErrorf("%s: %v", fs.Name(), err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseRoot parses the global flags before the command name.
+func parseRoot(fs *flag.FlagSet, args []string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, usageErrorf("%v", err)
+	}
+	return fs.Args(), nil
+}
+
+// commaList splits a comma-separated flag value, dropping empty items.
+func commaList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cjodo/go-cap"
+)
+
+var importCmd = &command{
+	name:    "import",
+	summary: "Import data into a project",
+	subs: []*command{
+		{name: "records", summary: "Import records from a file or stdin", run: runImportRecords},
+	},
+}
+
+// importReport is the machine-readable result of cap import records.
+type importReport struct {
+	DryRun  bool                    `json:"dry_run"`
+	Format  string                  `json:"format"`
+	Rows    int                     `json:"rows"`
+	Records int                     `json:"records"`
+	Created []string                `json:"created"`
+	Updated []string                `json:"updated"`
+	Failed  []string                `json:"failed"`
+	Errors  redcap.ValidationErrors `json:"errors"`
+	Batches []batchReport           `json:"batches"`
+}
+
+type batchReport struct {
+	Records int    `json:"records"`
+	Error   string `json:"error,omitempty"`
+}
+
+func runImportRecords(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap import records")
+	var (
+		format      = fs.String("format", "", "input format: json, csv, xml (default: detect)")
+		overwrite   = fs.String("overwrite", "normal", "overwrite behavior: normal, overwrite")
+		forceNumber = fs.Bool("force-number", false, "let REDCap assign record names")
+		dryRun      = fs.Bool("dry-run", false, "validate without importing")
+		batchSize   = fs.Int("batch-size", 500, "records per API call")
+		reportPath  = fs.String("report", "", "write a JSON report to this file (- for stdout)")
+	)
+	positional, err := a.parse(fs, "[file] [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return usageErrorf("cap import records: expected at most one file")
+	}
+	if *overwrite != "normal" && *overwrite != "overwrite" {
+		return usageErrorf("--overwrite must be normal or overwrite")
+	}
+	if *batchSize < 1 {
+		return usageErrorf("--batch-size must be positive")
+	}
+
+	data, err := readInput(positional)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = detectFormat(data)
+		a.debugf("detected %s input", *format)
+	}
+	rows, err := decodeRows(data, *format)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("exporting data dictionary: %w", err)
+	}
+	dict := redcap.NewDictionary(fields)
+
+	report := &importReport{
+		DryRun:  *dryRun,
+		Format:  *format,
+		Rows:    len(rows),
+		Created: []string{},
+		Updated: []string{},
+		Failed:  []string{},
+		Errors:  redcap.ValidationErrors{},
+	}
+
+	// Rows of one record (events, repeat instances) travel together
+	ids, byRecord := groupRows(rows, dict.RecordIDField)
+	report.Records = len(ids)
+
+	invalid := make(map[string]bool)
+	for _, e := range dict.ValidateRows(rows) {
+		report.Errors = append(report.Errors, e)
+		invalid[e.Record] = true
+	}
+	var valid []string
+	for _, id := range ids {
+		if invalid[id] {
+			report.Failed = append(report.Failed, id)
+		} else {
+			valid = append(valid, id)
+		}
+	}
+
+	existing := make(map[string]bool)
+	if !*forceNumber {
+		if existing, err = existingRecords(ctx, c, dict.RecordIDField, valid, *batchSize); err != nil {
+			return fmt.Errorf("checking existing records: %w", err)
+		}
+	}
+
+	for start := 0; start < len(valid); start += *batchSize {
+		batch := valid[start:min(start+*batchSize, len(valid))]
+		br := batchReport{Records: len(batch)}
+
+		if *dryRun {
+			classify(report, batch, existing, *forceNumber)
+			report.Batches = append(report.Batches, br)
+			continue
+		}
+
+		var payload []map[string]string
+		for _, id := range batch {
+			payload = append(payload, byRecord[id]...)
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("marshaling batch: %w", err)
+		}
+
+		opts := []redcap.ImportOption{
+			redcap.ImportOverwriteBehavior(*overwrite),
+			redcap.ImportReturnContent("ids"),
+		}
+		if *forceNumber {
+			opts = append(opts,
+				redcap.ImportForceAutoNumber(true),
+				redcap.ImportReturnContent("auto_ids"),
+			)
+		}
+
+		res, err := c.ImportRecordsRaw(ctx, body, opts...)
+		if err != nil {
+			if errors.Is(err, redcap.ErrInvalidToken) || errors.Is(err, redcap.ErrNoAPIRights) || ctx.Err() != nil {
+				return err
+			}
+			br.Error = err.Error()
+			var verrs redcap.ValidationErrors
+			if errors.As(err, &verrs) {
+				report.Errors = append(report.Errors, verrs...)
+			}
+			report.Failed = append(report.Failed, batch...)
+			report.Batches = append(report.Batches, br)
+			a.debugf("batch of %d records failed: %v", len(batch), err)
+			continue
+		}
+
+		if *forceNumber {
+			// auto_ids returns "new,original" pairs; report the new names
+			for _, pair := range res.IDs {
+				newID, _, _ := strings.Cut(pair, ",")
+				report.Created = append(report.Created, newID)
+			}
+		} else {
+			classify(report, batch, existing, false)
+		}
+		report.Batches = append(report.Batches, br)
+	}
+
+	verb := "imported"
+	if *dryRun {
+		verb = "would import"
+	}
+	fmt.Fprintf(a.stderr, "%d records (%d rows): %s %d created, %d updated; %d failed\n",
+		report.Records, report.Rows, verb, len(report.Created), len(report.Updated), len(report.Failed))
+	for _, e := range report.Errors {
+		fmt.Fprintf(a.stderr, "  record %s, field %s, value %q: %s\n", e.Record, e.Field, e.Value, e.Message)
+	}
+
+	if *reportPath != "" {
+		if err := a.writeTo(*reportPath, func(w io.Writer) error {
+			return writeJSON(w, report)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%w: %d of %d records failed", redcap.ErrInvalidData, len(report.Failed), report.Records)
+	}
+	return nil
+}
+
+// readInput reads the named file, or stdin when no file is given.
+func readInput(positional []string) ([]byte, error) {
+	if len(positional) == 0 || positional[0] == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading stdin: %w", err)
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	return data, nil
+}
+
+// groupRows groups rows by record ID, keeping first-seen order.
+func groupRows(rows []map[string]string, idField string) ([]string, map[string][]map[string]string) {
+	var ids []string
+	byRecord := make(map[string][]map[string]string)
+	for _, row := range rows {
+		id := row[idField]
+		if _, ok := byRecord[id]; !ok {
+			ids = append(ids, id)
+		}
+		byRecord[id] = append(byRecord[id], row)
+	}
+	return ids, byRecord
+}
+
+// existingRecords returns which of ids already exist in the project.
+func existingRecords(ctx context.Context, c *redcap.Client, idField string, ids []string, batchSize int) (map[string]bool, error) {
+	found := make(map[string]bool)
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		body, err := c.ExportRecordsRaw(ctx,
+			redcap.ExportFormat("json"),
+			redcap.ExportRecordsFilter(batch),
+			redcap.ExportFields([]string{idField}),
+		)
+		if err != nil {
+			return nil, err
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(body, &rows); err != nil {
+			return nil, fmt.Errorf("unmarshaling records: %w", err)
+		}
+		for _, row := range rows {
+			found[fmt.Sprint(row[idField])] = true
+		}
+	}
+	return found, nil
+}
+
+func classify(report *importReport, batch []string, existing map[string]bool, forceNumber bool) {
+	for _, id := range batch {
+		if existing[id] && !forceNumber {
+			report.Updated = append(report.Updated, id)
+		} else {
+			report.Created = append(report.Created, id)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`[{"record_id":"1"}]`, "json"},
+		{"\ufeff\n  {\"record_id\":\"1\"}", "json"},
+		{"<?xml version=\"1.0\"?><records></records>", "xml"},
+		{"record_id,name\n1,Ann\n", "csv"},
+		{"", "csv"},
+	}
+	for _, tt := range tests {
+		if got := detectFormat([]byte(tt.in)); got != tt.want {
+			t.Errorf("detectFormat(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		in      string
+		want    []map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "json array",
+			format: "json",
+			in:     `[{"record_id":"1","age":41,"weight":70.5,"notes":null}]`,
+			want:   []map[string]string{{"record_id": "1", "age": "41", "weight": "70.5", "notes": ""}},
+		},
+		{
+			name:   "json object",
+			format: "json",
+			in:     `{"record_id":"2"}`,
+			want:   []map[string]string{{"record_id": "2"}},
+		},
+		{
+			name:   "csv with byte order mark",
+			format: "csv",
+			in:     "\xef\xbb\xbfrecord_id, name\n1,\"Smith, Ann\"\n2,Bo\n",
+			want:   []map[string]string{{"record_id": "1", "name": "Smith, Ann"}, {"record_id": "2", "name": "Bo"}},
+		},
+		{
+			name:    "csv short line",
+			format:  "csv",
+			in:      "record_id,name\n1\n",
+			wantErr: true,
+		},
+		{
+			name:   "xml",
+			format: "xml",
+			in:     "<?xml version=\"1.0\"?><records><item><record_id>1</record_id><name> Ann </name></item><item><record_id>2</record_id><name></name></item></records>",
+			want:   []map[string]string{{"record_id": "1", "name": "Ann"}, {"record_id": "2", "name": ""}},
+		},
+		{
+			name:    "bad json",
+			format:  "json",
+			in:      `[{"record_id":`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			format:  "odm",
+			in:      "<ODM/>",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeRows([]byte(tt.in), tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeRows succeeded: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("content") {
+		case "metadata":
+			w.Write([]byte(`[{"field_name":"record_id","form_name":"demo","field_type":"text"},` +
+				`{"field_name":"name","form_name":"demo","field_type":"text"}]`))
+		case "record":
+			if r.FormValue("action") == "import" || r.FormValue("data") != "" {
+				t.Error("dry run imported records")
+			}
+			rows := []map[string]string{}
+			for _, id := range strings.Split(r.FormValue("records"), ",") {
+				if id == "1" || id == "3" {
+					rows = append(rows, map[string]string{"record_id": id})
+				}
+			}
+			json.NewEncoder(w).Encode(rows)
+		default:
+			http.Error(w, `{"error":"unsupported"}`, http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "records.csv")
+	data := "record_id,name\n1,Ann\n2,Bo\n3,Cy\n4,Di\n5,Ed\n"
+	if err := os.WriteFile(input, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(dir, "report.json")
+	cfg := writeConfig(t, "")
+
+	code, out := run("--config", cfg, "--url", srv.URL, "--token", flagToken,
+		"import", "records", input, "--dry-run", "--batch-size", "2", "--report", reportPath)
+	if code != ExitOK {
+		t.Fatalf("import --dry-run = %d: %s", code, out)
+	}
+	if !strings.Contains(out, "5 records (5 rows): would import 3 created, 2 updated; 0 failed") {
+		t.Errorf("summary:\n%s", out)
+	}
+
+	var report importReport
+	b, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Format != "csv" || report.Records != 5 || len(report.Batches) != 3 {
+		t.Errorf("report = %+v", report)
+	}
+	if !slices.Equal(report.Created, []string{"2", "4", "5"}) || !slices.Equal(report.Updated, []string{"1", "3"}) {
+		t.Errorf("created %v, updated %v", report.Created, report.Updated)
+	}
+
+	// Rows that fail validation are reported and not classified
+	if err := os.WriteFile(input, []byte("record_id,name,shoe_size\n1,Ann,\n6,Fay,40\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, out = run("--config", cfg, "--url", srv.URL, "--token", flagToken,
+		"import", "records", input, "--dry-run", "--report", reportPath)
+	if code != ExitInvalid {
+		t.Errorf("import with an unknown field = %d, want %d: %s", code, ExitInvalid, out)
+	}
+	b, _ = os.ReadFile(reportPath)
+	report = importReport{}
+	json.Unmarshal(b, &report)
+	if !slices.Equal(report.Failed, []string{"6"}) || !slices.Equal(report.Updated, []string{"1"}) || len(report.Errors) != 1 {
+		t.Errorf("report = %+v", report)
+	}
+}
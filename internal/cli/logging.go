@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/cjodo/go-cap"
+)
+
+func runExportLog(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap export log")
+	var (
+		logType  = fs.String("type", "", "event type: export, manage, user, record, record_add, record_edit, record_delete, lock_record, page_view")
+		user     = fs.String("user", "", "only events by this username")
+		record   = fs.String("record", "", "only events on this record")
+		dag      = fs.String("dag", "", "only events in this data access group")
+		begin    = fs.String("begin", "", "earliest event time, YYYY-MM-DD[ HH:MM] in the server's time zone")
+		end      = fs.String("end", "", "latest event time, YYYY-MM-DD[ HH:MM] in the server's time zone")
+		serverTZ = fs.String("server-tz", "", "REDCap server time zone, e.g. America/Chicago (default local)")
+		window   = fs.Duration("window", 0, "export in windows of this length, e.g. 720h, to bound response size")
+		changes  = fs.Bool("changes", false, "write one row per field change of data-change events")
+		format   = fs.String("format", "csv", "output format: csv, json")
+		out      = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "csv", "json"); err != nil {
+		return err
+	}
+	switch redcap.LogType(*logType) {
+	case "", redcap.LogExport, redcap.LogManage, redcap.LogUserActivity, redcap.LogRecord, redcap.LogRecordAdd,
+		redcap.LogRecordEdit, redcap.LogRecordDelete, redcap.LogLockRecord, redcap.LogPageView:
+	default:
+		return usageErrorf("invalid --type %q", *logType)
+	}
+	loc := time.Local
+	if *serverTZ != "" {
+		var err error
+		if loc, err = time.LoadLocation(*serverTZ); err != nil {
+			return usageErrorf("invalid --server-tz: %v", err)
+		}
+	}
+
+	var opts []redcap.LogOption
+	if *logType != "" {
+		opts = append(opts, redcap.LogTypeFilter(redcap.LogType(*logType)))
+	}
+	if *user != "" {
+		opts = append(opts, redcap.LogUser(*user))
+	}
+	if *record != "" {
+		opts = append(opts, redcap.LogRecordFilter(*record))
+	}
+	if *dag != "" {
+		opts = append(opts, redcap.LogDAG(*dag))
+	}
+	for _, f := range []struct {
+		name, value string
+		opt         func(time.Time) redcap.LogOption
+	}{{"--begin", *begin, redcap.LogBegin}, {"--end", *end, redcap.LogEnd}} {
+		if f.value == "" {
+			continue
+		}
+		t, err := parseLogTime(f.value, loc)
+		if err != nil {
+			return usageErrorf("invalid %s: %v", f.name, err)
+		}
+		opts = append(opts, f.opt(t))
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		lw := newLogWriter(w, *format, *changes)
+		if *window > 0 {
+			if err := c.ExportLoggingStream(ctx, *window, lw.write, opts...); err != nil {
+				return err
+			}
+			return lw.close()
+		}
+		entries, err := c.ExportLogging(ctx, opts...)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := lw.write(e); err != nil {
+				return err
+			}
+		}
+		return lw.close()
+	})
+}
+
+// parseLogTime parses a date, or a date and time to the minute.
+func parseLogTime(v string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04", v, loc); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, loc)
+}
+
+// logWriter writes log entries as CSV as they arrive, or collects them
+// for one JSON array.
+type logWriter struct {
+	w       io.Writer
+	changes bool
+	csv     *csv.Writer
+	entries []any
+}
+
+func newLogWriter(w io.Writer, format string, changes bool) *logWriter {
+	lw := &logWriter{w: w, changes: changes, entries: []any{}}
+	if format == "csv" {
+		lw.csv = csv.NewWriter(w)
+		if changes {
+			lw.csv.Write([]string{"timestamp", "username", "action", "record", "instance", "field", "value"})
+		} else {
+			lw.csv.Write([]string{"timestamp", "username", "action", "record", "details"})
+		}
+	}
+	return lw
+}
+
+// logChange is one row of cap export log --changes output.
+type logChange struct {
+	Timestamp string `json:"timestamp"`
+	Username  string `json:"username"`
+	Action    string `json:"action"`
+	Record    string `json:"record"`
+	redcap.LogChange
+}
+
+func (lw *logWriter) write(e redcap.LogEntry) error {
+	if !lw.changes {
+		if lw.csv == nil {
+			lw.entries = append(lw.entries, e)
+			return nil
+		}
+		return lw.csv.Write([]string{e.Timestamp, e.Username, e.Action, e.Record, e.Details})
+	}
+
+	for _, ch := range e.Changes() {
+		if lw.csv == nil {
+			lw.entries = append(lw.entries, logChange{e.Timestamp, e.Username, e.Action, e.Record, ch})
+			continue
+		}
+		instance := ""
+		if ch.Instance > 0 {
+			instance = strconv.Itoa(ch.Instance)
+		}
+		if err := lw.csv.Write([]string{e.Timestamp, e.Username, e.Action, e.Record, instance, ch.Field, ch.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lw *logWriter) close() error {
+	if lw.csv == nil {
+		return writeJSON(lw.w, lw.entries)
+	}
+	lw.csv.Flush()
+	if err := lw.csv.Error(); err != nil {
+		return fmt.Errorf("writing log: %w", err)
+	}
+	return nil
+}
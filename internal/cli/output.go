@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeTo writes via fn to path, or to stdout when path is empty or "-".
+// A file is written beside path and renamed over it only when fn
+// succeeds, so a failed export never leaves a partial or empty file.
+func (a *app) writeTo(path string, fn func(w io.Writer) error) error {
+	if path == "" || path == "-" {
+		return fn(a.stdout)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating output: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return fmt.Errorf("writing output: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	a.debugf("wrote %s", path)
+	return nil
+}
+
+// writeRaw writes a REDCap response body, indenting JSON for readability.
+func writeRaw(w io.Writer, format string, body []byte) error {
+	if format == "json" {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, body, "", "  "); err == nil {
+			buf.WriteByte('\n')
+			_, err = buf.WriteTo(w)
+			return err
+		}
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// checkFormat rejects output formats a command does not support.
+func checkFormat(format string, allowed ...string) error {
+	for _, f := range allowed {
+		if format == f {
+			return nil
+		}
+	}
+	return usageErrorf("unsupported format %q (want one of %v)", format, allowed)
+}
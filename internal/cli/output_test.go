@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteToKeepsFileOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.json")
+	if err := os.WriteFile(path, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a := &app{stdout: io.Discard}
+
+	boom := errors.New("export failed halfway")
+	err := a.writeTo(path, func(w io.Writer) error {
+		io.WriteString(w, "[{\"record_id\":")
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("writeTo = %v, want the export error", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous" {
+		t.Errorf("file = %q after a failed write, want it untouched", data)
+	}
+
+	if err := a.writeTo(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("file = %q, want new", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want no temporary files left", len(entries))
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want 0644", fi.Mode().Perm())
+	}
+}
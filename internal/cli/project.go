@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"time"
+)
+
+var pingCmd = &command{
+	name:    "ping",
+	summary: "Check connectivity and the API token",
+	run:     runPing,
+}
+
+var projectCmd = &command{
+	name:    "project",
+	summary: "Project information",
+	subs: []*command{
+		{name: "info", summary: "Display project information", run: runProjectInfo},
+	},
+}
+
+var versionCmd = &command{
+	name:    "version",
+	summary: "Display version information",
+	run:     runVersion,
+}
+
+func runPing(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap ping")
+	if _, err := a.parse(fs, "", args); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := c.Ping(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "ok (%s)\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func runProjectInfo(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap project info")
+	var (
+		format = fs.String("format", "text", "output format: text, json, csv")
+		out    = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "text", "json", "csv"); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	info, err := c.ExportProject(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(info))
+	for k := range info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		switch *format {
+		case "json":
+			return writeJSON(w, info)
+		case "csv":
+			row := make([]string, len(keys))
+			for i, k := range keys {
+				row[i] = fmt.Sprint(info[k])
+			}
+			return writeCSV(w, keys, [][]string{row})
+		}
+		for _, k := range keys {
+			if _, err := fmt.Fprintf(w, "%-40s %v\n", k+":", info[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func runVersion(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap version")
+	if _, err := a.parse(fs, "", args); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "cap %s (%s, %s/%s)\n", Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	// The REDCap version is only shown when a project is configured
+	c, err := a.Client()
+	if err != nil {
+		var uerr *usageError
+		if errors.As(err, &uerr) {
+			return nil
+		}
+		return err
+	}
+	v, err := c.ExportVersion(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "REDCap %s\n", v)
+	return nil
+}
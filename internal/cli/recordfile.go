@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// detectFormat guesses the format of a record file from its first
+// non-blank byte: JSON starts with [ or {, XML with <, anything else is
+// taken as CSV.
+func detectFormat(data []byte) string {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	if len(trimmed) == 0 {
+		return "csv"
+	}
+	switch trimmed[0] {
+	case '[', '{':
+		return "json"
+	case '<':
+		return "xml"
+	}
+	return "csv"
+}
+
+// decodeRows parses flat records in the given format into rows of
+// column -> value.
+func decodeRows(data []byte, format string) ([]map[string]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	switch format {
+	case "json":
+		return decodeJSONRows(data)
+	case "csv":
+		return decodeCSVRows(data)
+	case "xml":
+		return decodeXMLRows(data)
+	}
+	return nil, usageErrorf("unsupported import format %q (want json, csv or xml)", format)
+}
+
+func decodeJSONRows(data []byte) ([]map[string]string, error) {
+	var raw []map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		// A single record object is accepted too
+		var one map[string]any
+		if json.Unmarshal(data, &one) != nil {
+			return nil, fmt.Errorf("parsing JSON records: %w", err)
+		}
+		raw = []map[string]any{one}
+	}
+
+	rows := make([]map[string]string, len(raw))
+	for i, r := range raw {
+		row := make(map[string]string, len(r))
+		for k, v := range r {
+			switch v := v.(type) {
+			case nil:
+				row[k] = ""
+			case string:
+				row[k] = v
+			default:
+				row[k] = fmt.Sprint(v)
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func decodeCSVRows(data []byte) ([]map[string]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parsing CSV records: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for n, rec := range records[1:] {
+		if len(rec) != len(header) {
+			return nil, fmt.Errorf("parsing CSV records: line %d has %d columns, header has %d", n+2, len(rec), len(header))
+		}
+		row := make(map[string]string, len(header))
+		for i, col := range header {
+			row[strings.TrimSpace(col)] = rec[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// decodeXMLRows reads REDCap's flat XML: <records><item><field>value
+// </field>...</item>...</records>.
+func decodeXMLRows(data []byte) ([]map[string]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		rows  []map[string]string
+		row   map[string]string
+		field string
+		text  strings.Builder
+		depth int
+	)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing XML records: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch depth {
+			case 2:
+				row = make(map[string]string)
+			case 3:
+				field = t.Name.Local
+				text.Reset()
+			}
+		case xml.CharData:
+			if depth == 3 {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch depth {
+			case 3:
+				row[field] = strings.TrimSpace(text.String())
+			case 2:
+				rows = append(rows, row)
+			}
+			depth--
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,211 @@
+// Package cli implements the cap command line tool.
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cjodo/go-cap"
+)
+
+// Version is the cap version, set at build time with
+// -ldflags "-X github.com/cjodo/go-cap/internal/cli.Version=...".
+var Version = "dev"
+
+// URL and token environment variables, in order of preference.
+var (
+	urlEnvVars   = []string{"REDCAP_URL", "CAP_URL"}
+	tokenEnvVars = redcap.TokenEnvVars
+)
+
+// globals are the flags accepted by every command.
+type globals struct {
+	URL        string
+	Token      string
+	Timeout    time.Duration
+	Verbose    bool
+	ConfigPath string
+	Project    string
+}
+
+// app is the state shared by all commands of one invocation.
+type app struct {
+	globals
+	stdout io.Writer
+	stderr io.Writer
+	log    *log.Logger
+
+	config *config
+	pass   []byte
+	client *redcap.Client
+}
+
+// command is a node in the command tree. Leaf commands have run; group
+// commands have subs.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, a *app, args []string) error
+	subs    []*command
+}
+
+func commands() []*command {
+	return []*command{
+		pingCmd,
+		exportCmd,
+		importCmd,
+		configCmd,
+		projectCmd,
+		surveyCmd,
+		designCmd,
+		scheduleCmd,
+		usersCmd,
+		dagsCmd,
+		filesCmd,
+		auditCmd,
+		snapshotCmd,
+		syncCmd,
+		versionCmd,
+	}
+}
+
+// Run executes the cap command line and returns the process exit code.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	a := &app{
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	a.log = log.New(stderr, "cap: ", 0)
+
+	rest, err := parseRoot(a.flags("cap"), args)
+	if errors.Is(err, errHelp) {
+		a.printUsage("cap", commands())
+		return ExitOK
+	}
+	if err != nil {
+		return a.fail(err)
+	}
+
+	return a.fail(a.dispatch(ctx, "cap", commands(), rest))
+}
+
+func (a *app) dispatch(ctx context.Context, path string, subs []*command, args []string) error {
+	if len(args) == 0 {
+		a.printUsage(path, subs)
+		return usageErrorf("missing command")
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.printUsage(path, subs)
+		return nil
+	}
+
+	for _, cmd := range subs {
+		if cmd.name != args[0] {
+			continue
+		}
+		if cmd.run != nil {
+			return cmd.run(ctx, a, args[1:])
+		}
+		return a.dispatch(ctx, path+" "+cmd.name, cmd.subs, args[1:])
+	}
+	a.printUsage(path, subs)
+	return usageErrorf("%s: unknown command %q", path, args[0])
+}
+
+func (a *app) printUsage(path string, subs []*command) {
+	fmt.Fprintf(a.stderr, "Usage: %s <command> [options]\n\nCommands:\n", path)
+	for _, cmd := range subs {
+		fmt.Fprintf(a.stderr, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(a.stderr, "\nGlobal options:\n")
+	fs := a.flags(path)
+	fs.SetOutput(a.stderr)
+	fs.PrintDefaults()
+}
+
+// Client returns the REDCap client, creating it on first use from the
+// flags, environment and config file.
+func (a *app) Client() (*redcap.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+	s, err := a.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if s.Project != "" {
+		a.debugf("using project %s", s.Project)
+	}
+	c, err := a.newClient(s)
+	if err != nil {
+		return nil, err
+	}
+	a.client = c
+	return c, nil
+}
+
+func (a *app) newClient(s *settings) (*redcap.Client, error) {
+	var transport http.RoundTripper = http.DefaultTransport
+	if a.Verbose {
+		transport = &verboseTransport{next: transport, log: a.log}
+	}
+	opts := []redcap.Option{
+		redcap.WithHTTPClient(&http.Client{Timeout: s.Timeout, Transport: transport}),
+		redcap.WithTokenSource(s.Token),
+	}
+	if s.RPS > 0 {
+		opts = append(opts, redcap.WithRateLimiter(redcap.NewRateLimiter(s.RPS, redcap.DefaultBurst)))
+	}
+	return redcap.NewClient(s.URL, "", opts...)
+}
+
+func (a *app) debugf(format string, args ...any) {
+	if a.Verbose {
+		a.log.Printf(format, args...)
+	}
+}
+
+// fail reports err and maps it to an exit code.
+func (a *app) fail(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, errHelp) {
+		return ExitOK
+	}
+	fmt.Fprintf(a.stderr, "cap: %v\n", err)
+	return exitCode(err)
+}
+
+func firstEnv(names []string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// verboseTransport logs every API call to stderr.
+type verboseTransport struct {
+	next http.RoundTripper
+	log  *log.Logger
+}
+
+func (t *verboseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.log.Printf("%s %s: %v (%s)", req.Method, req.URL, err, time.Since(start).Round(time.Millisecond))
+		return nil, err
+	}
+	t.log.Printf("%s %s: %s (%s)", req.Method, req.URL, resp.Status, time.Since(start).Round(time.Millisecond))
+	return resp, nil
+}
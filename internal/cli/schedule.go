@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/cjodo/go-cap"
+)
+
+var scheduleCmd = &command{
+	name:    "schedule",
+	summary: "Show each record's visit calendar from event offsets",
+	run:     runSchedule,
+}
+
+func runSchedule(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap schedule")
+	var (
+		anchor      = fs.String("anchor", "", "date field holding each record's day 0, e.g. enrollment_date (required)")
+		anchorEvent = fs.String("anchor-event", "", "event to read the anchor field from (default the first with a value)")
+		dateField   = fs.String("date-field", "", "visit date field recorded on each event, to classify visits as on time, early or late")
+		records     = fs.String("records", "", "comma-separated record IDs (default all)")
+		status      = fs.String("status", "", "comma-separated statuses to show: on_time, early, late, missing, due, upcoming, collected")
+		today       = fs.String("today", "", "judge due and missing visits as of this date, YYYY-MM-DD (default today)")
+		format      = fs.String("format", "text", "output format: text, csv, json")
+		out         = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "--anchor <field> [options]", args); err != nil {
+		return err
+	}
+	if *anchor == "" {
+		return usageErrorf("cap schedule: --anchor is required")
+	}
+	if err := checkFormat(*format, "text", "csv", "json"); err != nil {
+		return err
+	}
+	opts := redcap.ScheduleOptions{
+		AnchorField: *anchor,
+		AnchorEvent: *anchorEvent,
+		DateField:   *dateField,
+		Records:     commaList(*records),
+	}
+	if *today != "" {
+		t, err := time.Parse("2006-01-02", *today)
+		if err != nil {
+			return usageErrorf("invalid --today %q, want YYYY-MM-DD", *today)
+		}
+		opts.Now = t
+	}
+	show := make(map[redcap.VisitStatus]bool)
+	for _, s := range commaList(*status) {
+		switch st := redcap.VisitStatus(s); st {
+		case redcap.VisitOnTime, redcap.VisitEarly, redcap.VisitLate, redcap.VisitMissing,
+			redcap.VisitDue, redcap.VisitUpcoming, redcap.VisitCollected:
+			show[st] = true
+		default:
+			return usageErrorf("invalid --status %q", s)
+		}
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	visits, err := c.ExportSchedule(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if len(show) > 0 {
+		kept := visits[:0]
+		for _, v := range visits {
+			if show[v.Status] {
+				kept = append(kept, v)
+			}
+		}
+		visits = kept
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		switch *format {
+		case "json":
+			if visits == nil {
+				visits = []redcap.ScheduledVisit{}
+			}
+			return writeJSON(w, visits)
+		case "csv":
+			rows := make([][]string, len(visits))
+			for i, v := range visits {
+				actual, days := "", ""
+				if !v.Actual.IsZero() {
+					actual, days = day(v.Actual), strconv.Itoa(v.DaysFromTarget)
+				}
+				rows[i] = []string{v.Record, v.Event, v.Label, day(v.Target), day(v.WindowStart), day(v.WindowEnd), actual, days, string(v.Status)}
+			}
+			return writeCSV(w, []string{"record", "event", "label", "target", "window_start", "window_end", "actual", "days_from_target", "status"}, rows)
+		}
+		return writeCalendar(w, visits)
+	})
+}
+
+func day(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// writeCalendar prints visits grouped by record.
+func writeCalendar(w io.Writer, visits []redcap.ScheduledVisit) error {
+	record := ""
+	for i, v := range visits {
+		if i == 0 || v.Record != record {
+			record = v.Record
+			if i > 0 {
+				if _, err := fmt.Fprintln(w); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "record %s\n", record); err != nil {
+				return err
+			}
+		}
+		window := day(v.Target)
+		if !v.WindowStart.Equal(v.WindowEnd) {
+			window = day(v.WindowStart) + ".." + day(v.WindowEnd)
+		}
+		actual := ""
+		if !v.Actual.IsZero() {
+			actual = fmt.Sprintf("%s (%+d)", day(v.Actual), v.DaysFromTarget)
+		}
+		if _, err := fmt.Fprintf(w, "  %-24s %-22s %-10s %-16s %s\n", v.Event, window, v.Status, actual, v.Label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cjodo/go-cap"
+)
+
+var snapshotCmd = &command{
+	name:    "snapshot",
+	summary: "Back up and restore whole projects",
+	subs: []*command{
+		{name: "create", summary: "Write a project snapshot archive", run: runSnapshotCreate},
+		{name: "restore", summary: "Restore a snapshot into an empty project", run: runSnapshotRestore},
+		{name: "verify", summary: "Check a snapshot archive against its manifest", run: runSnapshotVerify},
+	},
+}
+
+func runSnapshotCreate(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap snapshot create")
+	var (
+		out     = fs.String("out", "", "archive file (default snapshot-<project>-<time>.zip)")
+		noFiles = fs.Bool("no-files", false, "leave out file-upload field contents")
+		noUsers = fs.Bool("no-users", false, "leave out user rights")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	// Write beside the target and rename, so an interrupted snapshot never
+	// leaves a truncated archive under the final name
+	dir := filepath.Dir(*out)
+	tmp, err := os.CreateTemp(dir, ".cap-snapshot-*")
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	m, err := c.Snapshot(ctx, tmp, redcap.SnapshotOptions{
+		SkipFiles: *noFiles,
+		SkipUsers: *noUsers,
+	})
+	if cerr := tmp.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("writing snapshot: %w", cerr)
+	}
+	if err != nil {
+		return err
+	}
+
+	name := *out
+	if name == "" {
+		name = fmt.Sprintf("snapshot-%s-%s.zip", m.ProjectID, m.CreatedAt.Format("20060102-150405"))
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+
+	fmt.Fprintf(a.stderr, "wrote %s: project %s %q, %d records, %d files\n",
+		name, m.ProjectID, m.ProjectTitle, m.Records, len(m.Files))
+	return nil
+}
+
+func runSnapshotRestore(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap snapshot restore")
+	var (
+		force      = fs.Bool("force", false, "restore into a project that already has records")
+		users      = fs.Bool("users", false, "restore user rights")
+		noFiles    = fs.Bool("no-files", false, "do not upload files")
+		batchSize  = fs.Int("batch-size", 500, "records per API call")
+		reportPath = fs.String("report", "", "write a JSON report to this file (- for stdout)")
+	)
+	positional, err := a.parse(fs, "<file> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap snapshot restore: expected one snapshot file")
+	}
+	if *batchSize < 1 {
+		return usageErrorf("--batch-size must be positive")
+	}
+
+	s, err := redcap.OpenSnapshot(positional[0])
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	a.debugf("restoring snapshot of project %s taken %s", s.Manifest.ProjectID, s.Manifest.CreatedAt.Format(time.RFC3339))
+
+	report, err := c.Restore(ctx, s, redcap.RestoreOptions{
+		Force:     *force,
+		Users:     *users,
+		SkipFiles: *noFiles,
+		BatchSize: *batchSize,
+	})
+	if report != nil {
+		for _, st := range report.Steps {
+			if st.Skipped {
+				fmt.Fprintf(a.stderr, "%-20s skipped\n", st.Name)
+			} else {
+				fmt.Fprintf(a.stderr, "%-20s %d\n", st.Name, st.Count)
+			}
+		}
+		for _, m := range report.Mismatches {
+			fmt.Fprintf(a.stderr, "  mismatch: %s\n", m)
+		}
+		if *reportPath != "" {
+			if werr := a.writeTo(*reportPath, func(w io.Writer) error {
+				return writeJSON(w, report)
+			}); werr != nil && err == nil {
+				err = werr
+			}
+		}
+	}
+	return err
+}
+
+func runSnapshotVerify(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap snapshot verify")
+	positional, err := a.parse(fs, "<file>", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap snapshot verify: expected one snapshot file")
+	}
+
+	s, err := redcap.OpenSnapshot(positional[0])
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := s.Verify(); err != nil {
+		return err
+	}
+
+	m := s.Manifest
+	fmt.Fprintf(a.stdout, "project:  %s %q\n", m.ProjectID, m.ProjectTitle)
+	fmt.Fprintf(a.stdout, "source:   %s (REDCap %s)\n", m.SourceURL, m.REDCapVersion)
+	fmt.Fprintf(a.stdout, "created:  %s\n", m.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(a.stdout, "records:  %d\n", m.Records)
+	fmt.Fprintf(a.stdout, "files:    %d\n", len(m.Files))
+	fmt.Fprintf(a.stdout, "entries:  %d ok\n", len(m.Entries))
+	return nil
+}
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cjodo/go-cap"
+)
+
+var surveyCmd = &command{
+	name:    "survey",
+	summary: "Survey participants and links",
+	subs: []*command{
+		{name: "participants", summary: "List a survey's participants", run: runSurveyParticipants},
+		{name: "links", summary: "Generate survey links for records", run: runSurveyLinks},
+	},
+}
+
+func runSurveyParticipants(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap survey participants")
+	var (
+		event  = fs.String("event", "", "unique event name (longitudinal projects)")
+		format = fs.String("format", "text", "output format: text, json, csv")
+		out    = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	positional, err := a.parse(fs, "<instrument> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap survey participants: expected one instrument name")
+	}
+	if err := checkFormat(*format, "text", "json", "csv"); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	participants, err := c.ExportSurveyParticipants(ctx, positional[0], redcap.SurveyEvent(*event))
+	if err != nil {
+		return err
+	}
+
+	header := []string{"record", "email", "identifier", "invitation", "send_time", "response", "access_code", "link"}
+	rows := make([][]string, len(participants))
+	for i, p := range participants {
+		rows[i] = []string{p.Record, p.Email, p.Identifier, p.Invitation.String(),
+			p.InvitationSendTime, p.Response.String(), p.AccessCode, p.Link}
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		switch *format {
+		case "json":
+			return writeJSON(w, participants)
+		case "csv":
+			return writeCSV(w, header, rows)
+		}
+		for _, r := range rows {
+			if _, err := fmt.Fprintf(w, "%-10s %-30s %-10s %-12s %s\n", r[0], r[1], r[3], r[5], r[7]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// surveyLink is one line of cap survey links output.
+type surveyLink struct {
+	Record     string `json:"record"`
+	Link       string `json:"link"`
+	ReturnCode string `json:"return_code,omitempty"`
+	AccessCode string `json:"access_code,omitempty"`
+}
+
+func runSurveyLinks(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap survey links")
+	var (
+		instrument  = fs.String("instrument", "", "survey instrument")
+		event       = fs.String("event", "", "unique event name (longitudinal projects)")
+		instance    = fs.Int("instance", 0, "repeat instance of a repeating survey")
+		records     = fs.String("records", "", "comma-separated record IDs (default all records)")
+		queue       = fs.Bool("queue", false, "generate survey queue links instead of survey links")
+		returnCodes = fs.Bool("return-codes", false, "include each record's return code")
+		accessCodes = fs.Bool("access-codes", false, "include each record's survey access code")
+		format      = fs.String("format", "csv", "output format: csv, json")
+		out         = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "csv", "json"); err != nil {
+		return err
+	}
+	if *instrument == "" && (!*queue || *returnCodes || *accessCodes) {
+		return usageErrorf("cap survey links: --instrument is required")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	ids := commaList(*records)
+	if len(ids) == 0 {
+		if ids, err = recordNames(ctx, c); err != nil {
+			return err
+		}
+	}
+
+	opts := []redcap.SurveyOption{redcap.SurveyEvent(*event), redcap.SurveyRepeatInstance(*instance)}
+	links := make([]surveyLink, 0, len(ids))
+	for _, id := range ids {
+		l := surveyLink{Record: id}
+		if *queue {
+			l.Link, err = c.ExportSurveyQueueLink(ctx, id)
+		} else {
+			l.Link, err = c.ExportSurveyLink(ctx, id, *instrument, opts...)
+		}
+		if err == nil && *returnCodes {
+			l.ReturnCode, err = c.ExportSurveyReturnCode(ctx, id, *instrument, opts...)
+		}
+		if err == nil && *accessCodes {
+			l.AccessCode, err = c.ExportSurveyAccessCode(ctx, id, *instrument, opts...)
+		}
+		if err != nil {
+			return fmt.Errorf("record %s: %w", id, err)
+		}
+		links = append(links, l)
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		if *format == "json" {
+			return writeJSON(w, links)
+		}
+		header := []string{"record", "link"}
+		if *returnCodes {
+			header = append(header, "return_code")
+		}
+		if *accessCodes {
+			header = append(header, "access_code")
+		}
+		rows := make([][]string, len(links))
+		for i, l := range links {
+			rows[i] = []string{l.Record, l.Link}
+			if *returnCodes {
+				rows[i] = append(rows[i], l.ReturnCode)
+			}
+			if *accessCodes {
+				rows[i] = append(rows[i], l.AccessCode)
+			}
+		}
+		return writeCSV(w, header, rows)
+	})
+}
+
+// recordNames returns every record name in the project, in export order.
+func recordNames(ctx context.Context, c *redcap.Client) ([]string, error) {
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting data dictionary: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("project has no fields")
+	}
+	idField := fields[0].Field_name
+
+	body, err := c.ExportRecordsRaw(ctx,
+		redcap.ExportFormat("json"),
+		redcap.ExportFields([]string{idField}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("unmarshaling records: %w", err)
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		id := fmt.Sprint(row[idField])
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
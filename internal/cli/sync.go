@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cjodo/go-cap"
+	"github.com/cjodo/go-cap/sqlite"
+)
+
+var syncCmd = &command{
+	name:    "sync",
+	summary: "Mirror a project into a local database",
+	subs: []*command{
+		{name: "sqlite", summary: "Mirror a project into a SQLite database", run: runSyncSQLite},
+	},
+}
+
+func runSyncSQLite(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap sync sqlite")
+	var (
+		full     = fs.Bool("full", false, "rebuild the database instead of refreshing changed records")
+		overlap  = fs.Duration("overlap", redcap.DefaultOverlap, "re-export window before the last sync, for clock skew")
+		serverTZ = fs.String("server-tz", "", "REDCap server time zone, e.g. America/Chicago (default local)")
+		batch    = fs.Int("batch-size", 500, "records per API call for a full sync")
+	)
+	positional, err := a.parse(fs, "<database> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap sync sqlite: expected one database file")
+	}
+	if *batch <= 0 {
+		return usageErrorf("--batch-size must be positive")
+	}
+	loc := time.Local
+	if *serverTZ != "" {
+		if loc, err = time.LoadLocation(*serverTZ); err != nil {
+			return usageErrorf("invalid --server-tz: %v", err)
+		}
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	m, err := sqlite.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	res, err := m.Sync(ctx, c, sqlite.Options{
+		Full:      *full,
+		Overlap:   *overlap,
+		Location:  loc,
+		BatchSize: *batch,
+	})
+	if err != nil {
+		return err
+	}
+	if res.Full {
+		fmt.Fprintf(a.stderr, "rebuilt %s: %d records in %d instrument tables\n", positional[0], res.Records, len(res.Tables))
+	} else {
+		fmt.Fprintf(a.stderr, "refreshed %s: %d records changed since %s\n",
+			positional[0], res.Records, res.Since.In(loc).Format(time.RFC3339))
+	}
+	return nil
+}
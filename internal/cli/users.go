@@ -0,0 +1,299 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cjodo/go-cap"
+)
+
+var usersCmd = &command{
+	name:    "users",
+	summary: "Manage project users and roles",
+	subs: []*command{
+		{name: "list", summary: "List users with their role and DAG", run: runUsersList},
+		{name: "roles", summary: "List user roles", run: runUsersRoles},
+		{name: "provision", summary: "Add or update users from a CSV file", run: runUsersProvision},
+		{name: "delete", summary: "Remove users from the project", run: runUsersDelete},
+	},
+}
+
+func runUsersList(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap users list")
+	var (
+		format = fs.String("format", "text", "output format: text, json, csv")
+		out    = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "text", "json", "csv"); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	users, err := c.ExportUsers(ctx)
+	if err != nil {
+		return err
+	}
+	roles, err := userRoles(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	header := []string{"username", "email", "firstname", "lastname", "role", "data_access_group", "expiration"}
+	rows := make([][]string, len(users))
+	for i, u := range users {
+		rows[i] = []string{u.Username, u.Email, u.FirstName, u.LastName, roles[u.Username], u.DataAccessGroup, u.Expiration}
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		switch *format {
+		case "json":
+			return writeJSON(w, users)
+		case "csv":
+			return writeCSV(w, header, rows)
+		}
+		for _, r := range rows {
+			if _, err := fmt.Fprintf(w, "%-20s %-30s %-20s %-16s %s\n", r[0], r[1], r[4], r[5], r[6]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// userRoles maps usernames to the label of their role.
+func userRoles(ctx context.Context, c *redcap.Client) (map[string]string, error) {
+	roles, err := c.ExportUserRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string, len(roles))
+	for _, r := range roles {
+		labels[r.UniqueRoleName] = r.RoleLabel
+	}
+	mapping, err := c.ExportUserRoleMapping(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byUser := make(map[string]string, len(mapping))
+	for _, m := range mapping {
+		if m.UniqueRoleName != "" {
+			byUser[m.Username] = labels[m.UniqueRoleName]
+		}
+	}
+	return byUser, nil
+}
+
+func runUsersRoles(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap users roles")
+	var (
+		format = fs.String("format", "text", "output format: text, json")
+		out    = fs.String("out", "", "output file (default stdout)")
+	)
+	fs.StringVar(out, "o", "", "shorthand for --out")
+	if _, err := a.parse(fs, "[options]", args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "text", "json"); err != nil {
+		return err
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	roles, err := c.ExportUserRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.writeTo(*out, func(w io.Writer) error {
+		if *format == "json" {
+			return writeJSON(w, roles)
+		}
+		for _, r := range roles {
+			if _, err := fmt.Fprintf(w, "%-16s %s\n", r.UniqueRoleName, r.RoleLabel); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Columns of a provisioning file other than rights.
+var userColumns = map[string]bool{
+	"username": true, "email": true, "firstname": true, "lastname": true,
+	"expiration": true, "data_access_group": true, "role": true,
+}
+
+func runUsersProvision(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap users provision")
+	dryRun := fs.Bool("dry-run", false, "show the changes without making them")
+	positional, err := a.parse(fs, "<file.csv> [options]", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageErrorf("cap users provision: expected one CSV file")
+	}
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+	rows, err := decodeRows(data, "csv")
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if strings.TrimSpace(row["username"]) == "" {
+			return usageErrorf("%s: every row needs a username", positional[0])
+		}
+		for col := range row {
+			if userColumns[col] {
+				continue
+			}
+			if err := (&redcap.Rights{}).Set(col, row[col]); err != nil {
+				return usageErrorf("%s: %v", positional[0], err)
+			}
+		}
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	existing, err := c.ExportUsers(ctx)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]redcap.User, len(existing))
+	for _, u := range existing {
+		byName[strings.ToLower(u.Username)] = u
+	}
+	roles, err := c.ExportUserRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		users    []redcap.User
+		mappings []redcap.UserRoleMapping
+		added    int
+	)
+	for _, row := range rows {
+		name := strings.TrimSpace(row["username"])
+		u, ok := byName[strings.ToLower(name)]
+		if !ok {
+			u = redcap.User{Username: name}
+			added++
+		}
+		// Columns left empty keep the user's current value
+		for col, v := range row {
+			if v == "" {
+				continue
+			}
+			switch col {
+			case "username", "role":
+			case "email":
+				u.Email = v
+			case "firstname":
+				u.FirstName = v
+			case "lastname":
+				u.LastName = v
+			case "expiration":
+				u.Expiration = v
+			case "data_access_group":
+				u.DataAccessGroup = v
+			default:
+				u.Rights.Set(col, v) // checked above
+			}
+		}
+		users = append(users, u)
+
+		if role := strings.TrimSpace(row["role"]); role != "" {
+			unique, err := findRole(roles, role)
+			if err != nil {
+				return err
+			}
+			mappings = append(mappings, redcap.UserRoleMapping{Username: u.Username, UniqueRoleName: unique})
+		}
+	}
+
+	if *dryRun {
+		for _, u := range users {
+			action := "update"
+			if _, ok := byName[strings.ToLower(u.Username)]; !ok {
+				action = "add"
+			}
+			fmt.Fprintf(a.stdout, "%-6s %s\n", action, u.Username)
+		}
+		for _, m := range mappings {
+			fmt.Fprintf(a.stdout, "role   %s -> %s\n", m.Username, m.UniqueRoleName)
+		}
+		return nil
+	}
+
+	if _, err := c.ImportUsers(ctx, users); err != nil {
+		return err
+	}
+	if len(mappings) > 0 {
+		if _, err := c.ImportUserRoleMapping(ctx, mappings); err != nil {
+			return fmt.Errorf("assigning roles: %w", err)
+		}
+	}
+	fmt.Fprintf(a.stderr, "added %d users, updated %d, assigned %d roles\n", added, len(users)-added, len(mappings))
+	return nil
+}
+
+// findRole resolves a role by unique name or label.
+func findRole(roles []redcap.UserRole, role string) (string, error) {
+	var matches []string
+	for _, r := range roles {
+		if r.UniqueRoleName == role {
+			return r.UniqueRoleName, nil
+		}
+		if strings.EqualFold(r.RoleLabel, role) {
+			matches = append(matches, r.UniqueRoleName)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", usageErrorf("no user role %q", role)
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", usageErrorf("role label %q is ambiguous: %s", role, strings.Join(matches, ", "))
+}
+
+func runUsersDelete(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("cap users delete")
+	positional, err := a.parse(fs, "<username>...", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return usageErrorf("cap users delete: expected at least one username")
+	}
+
+	c, err := a.Client()
+	if err != nil {
+		return err
+	}
+	n, err := c.DeleteUsers(ctx, positional)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "deleted %d users\n", n)
+	return nil
+}
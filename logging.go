@@ -0,0 +1,325 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogType selects a category of logging events.
+type LogType string
+
+const (
+	LogExport       LogType = "export"
+	LogManage       LogType = "manage"
+	LogUserActivity LogType = "user"
+	LogRecord       LogType = "record"
+	LogRecordAdd    LogType = "record_add"
+	LogRecordEdit   LogType = "record_edit"
+	LogRecordDelete LogType = "record_delete"
+	LogLockRecord   LogType = "lock_record"
+	LogPageView     LogType = "page_view"
+)
+
+// logTimeLayout is the minute-precision server-local time format of
+// logging filters and timestamps.
+const logTimeLayout = "2006-01-02 15:04"
+
+// LogOption filters a logging export.
+type LogOption func(map[string]string)
+
+// LogTypeFilter limits the export to one category of events.
+func LogTypeFilter(t LogType) LogOption {
+	return func(p map[string]string) {
+		p["logtype"] = string(t)
+	}
+}
+
+// LogUser limits the export to events by one username.
+func LogUser(username string) LogOption {
+	return func(p map[string]string) {
+		p["user"] = username
+	}
+}
+
+// LogRecordFilter limits the export to events on one record.
+func LogRecordFilter(record string) LogOption {
+	return func(p map[string]string) {
+		p["record"] = record
+	}
+}
+
+// LogDAG limits the export to events in one data access group, by unique
+// group name.
+func LogDAG(dag string) LogOption {
+	return func(p map[string]string) {
+		p["dag"] = dag
+	}
+}
+
+// LogBegin limits the export to events at or after t, to the minute. t is
+// sent in its own location, which should be the server's.
+func LogBegin(t time.Time) LogOption {
+	return func(p map[string]string) {
+		p["beginTime"] = t.Format(logTimeLayout)
+	}
+}
+
+// LogEnd limits the export to events at or before t, to the minute. t is
+// sent in its own location, which should be the server's.
+func LogEnd(t time.Time) LogOption {
+	return func(p map[string]string) {
+		p["endTime"] = t.Format(logTimeLayout)
+	}
+}
+
+// LogEntry is one event of a project's logging.
+type LogEntry struct {
+	// Timestamp is the server-local time of the event, "2006-01-02 15:04".
+	Timestamp string `json:"timestamp"`
+	Username  string `json:"username"`
+	// Action describes the event, such as "Update record 12".
+	Action  string `json:"action"`
+	Details string `json:"details"`
+	// Record is the record the event concerns, when there is one.
+	Record string `json:"record,omitempty"`
+}
+
+// Time parses Timestamp in the server's location.
+func (e LogEntry) Time(loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(logTimeLayout, e.Timestamp, loc)
+}
+
+// LogChange is one field value set by a data-change event.
+type LogChange struct {
+	// Field is the record export column: "race___2" for a checkbox choice.
+	Field string `json:"field"`
+	// Value is the new value; checkbox choices are "1" or "0".
+	Value string `json:"value"`
+	// Instance is the repeat instance the value was saved on, or 0.
+	Instance int `json:"instance,omitempty"`
+}
+
+// IsDataChange reports whether the entry created, updated or deleted a
+// record or survey response.
+func (e LogEntry) IsDataChange() bool {
+	a := strings.ToLower(e.Action)
+	if !strings.Contains(a, "record") && !strings.Contains(a, "response") {
+		return false
+	}
+	return strings.HasPrefix(a, "create") || strings.HasPrefix(a, "update") || strings.HasPrefix(a, "delete")
+}
+
+// Changes parses the details of a data-change entry, such as
+// "age = '34', race(2) = checked, [instance = 2], notes = 'n/a'", into
+// field values. Other entries have no changes.
+func (e LogEntry) Changes() []LogChange {
+	if !e.IsDataChange() {
+		return nil
+	}
+	return parseLogDetails(e.Details)
+}
+
+// parseLogDetails scans the comma-separated assignments of data-change
+// details. Values are quoted with single quotes, which REDCap escapes
+// with a backslash inside values; checkbox choices are written as
+// field(code) = checked or unchecked.
+func parseLogDetails(s string) []LogChange {
+	var changes []LogChange
+	instance := 0
+	for {
+		s = strings.TrimLeft(s, " ,\n")
+		if s == "" {
+			return changes
+		}
+		if s[0] == '[' {
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return changes
+			}
+			if k, v, ok := strings.Cut(s[1:end], "="); ok && strings.TrimSpace(k) == "instance" {
+				instance, _ = strconv.Atoi(strings.TrimSpace(v))
+			}
+			s = s[end+1:]
+			continue
+		}
+
+		name, rest, ok := strings.Cut(s, " = ")
+		if !ok {
+			return changes
+		}
+		var value string
+		if strings.HasPrefix(rest, "'") {
+			value, s = scanQuoted(rest[1:])
+		} else {
+			end := strings.Index(rest, ", ")
+			if end < 0 {
+				end = len(rest)
+			}
+			value, s = rest[:end], rest[end:]
+		}
+
+		c := LogChange{Field: strings.TrimSpace(name), Value: value, Instance: instance}
+		if field, code, ok := strings.Cut(c.Field, "("); ok && strings.HasSuffix(code, ")") {
+			c.Field = CheckboxColumn(field, strings.TrimSuffix(code, ")"))
+			c.Value = "0"
+			if value == "checked" {
+				c.Value = "1"
+			}
+		}
+		changes = append(changes, c)
+	}
+}
+
+// scanQuoted reads a single-quoted value up to its closing quote, which
+// is followed by a comma or the end of the details.
+func scanQuoted(s string) (value, rest string) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case s[i] == '\'' && (i+1 == len(s) || s[i+1] == ','):
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// ExportLogging returns the project's logging, newest first, filtered by
+// opts.
+func (c *Client) ExportLogging(ctx context.Context, opts ...LogOption) ([]LogEntry, error) {
+	params := map[string]string{
+		"format": "json",
+	}
+	for _, opt := range opts {
+		opt(params)
+	}
+	return c.exportLogging(ctx, params)
+}
+
+func (c *Client) exportLogging(ctx context.Context, params map[string]string) ([]LogEntry, error) {
+	body, err := c.Request(ctx, "log", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []LogEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("unmarshaling logging: %w", err)
+	}
+	for i := range entries {
+		if entries[i].Record == "" {
+			entries[i].Record = actionRecord(entries[i].Action)
+		}
+	}
+
+	return entries, nil
+}
+
+// actionRecord returns the record named by an action such as
+// "Update record 12" or "Update record 12 (Auto calculation)".
+func actionRecord(action string) string {
+	_, rest, ok := strings.Cut(action, "record ")
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, " ")
+	return id
+}
+
+// ExportLoggingStream exports logging in windows of the given length,
+// oldest window first, calling fn for each entry, so that long audit
+// trails stay under the response size limit. Entries within a window are
+// in REDCap's order, newest first. Without LogBegin the stream starts at
+// the project's creation time; without LogEnd the last window is open.
+func (c *Client) ExportLoggingStream(ctx context.Context, window time.Duration, fn func(LogEntry) error, opts ...LogOption) error {
+	if window < time.Minute {
+		return fmt.Errorf("logging window must be at least a minute, got %s", window)
+	}
+	params := map[string]string{
+		"format": "json",
+	}
+	for _, opt := range opts {
+		opt(params)
+	}
+
+	// Windows are computed on server wall-clock times, without a zone
+	begin, err := c.logBegin(ctx, params["beginTime"])
+	if err != nil {
+		return err
+	}
+	var end time.Time
+	if params["endTime"] != "" {
+		if end, err = time.Parse(logTimeLayout, params["endTime"]); err != nil {
+			return fmt.Errorf("invalid logging end time: %w", err)
+		}
+	}
+	// Without an end, closed windows stop a day before the local clock,
+	// whatever the server's zone, and one open window takes the rest
+	now, _ := time.Parse(logTimeLayout, time.Now().Format(logTimeLayout))
+	last := now.Add(-24 * time.Hour)
+	if !end.IsZero() {
+		last = end
+	}
+
+	for start := begin; ; start = start.Add(window) {
+		params["beginTime"] = start.Format(logTimeLayout)
+		// endTime includes its whole minute
+		stop := start.Add(window - time.Minute)
+		open := end.IsZero() && !stop.Before(last)
+		switch {
+		case open:
+			delete(params, "endTime")
+		case stop.After(last):
+			params["endTime"] = last.Format(logTimeLayout)
+		default:
+			params["endTime"] = stop.Format(logTimeLayout)
+		}
+
+		entries, err := c.exportLogging(ctx, params)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if open || !stop.Before(last) {
+			return nil
+		}
+	}
+}
+
+// logBegin parses a beginTime filter, defaulting to the project's
+// creation time.
+func (c *Client) logBegin(ctx context.Context, v string) (time.Time, error) {
+	if v != "" {
+		t, err := time.Parse(logTimeLayout, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid logging begin time: %w", err)
+		}
+		return t, nil
+	}
+	info, err := c.ExportProject(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("exporting project info: %w", err)
+	}
+	created, _ := info["creation_time"].(string)
+	if len(created) < len(logTimeLayout) {
+		return time.Time{}, errors.New("project info has no creation time; give a logging begin time")
+	}
+	t, err := time.Parse(logTimeLayout, created[:len(logTimeLayout)])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing project creation time: %w", err)
+	}
+	return t, nil
+}
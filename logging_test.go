@@ -0,0 +1,81 @@
+package redcap
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseLogDetails(t *testing.T) {
+	tests := []struct {
+		name    string
+		details string
+		want    []LogChange
+	}{
+		{"empty", "", nil},
+		{
+			"quoted and bare values",
+			"record_id = '12', age = '34', score = 7",
+			[]LogChange{{Field: "record_id", Value: "12"}, {Field: "age", Value: "34"}, {Field: "score", Value: "7"}},
+		},
+		{
+			"commas and escaped quotes",
+			`notes = 'tired, but it\'s fine', name = 'O\'Brien'`,
+			[]LogChange{{Field: "notes", Value: "tired, but it's fine"}, {Field: "name", Value: "O'Brien"}},
+		},
+		{
+			"checkboxes",
+			"race(2) = checked, race(Other) = unchecked",
+			[]LogChange{{Field: "race___2", Value: "1"}, {Field: "race___other", Value: "0"}},
+		},
+		{
+			"instance marker",
+			"age = '34', [instance = 2], weight = '70', visit_date = ''",
+			[]LogChange{{Field: "age", Value: "34"}, {Field: "weight", Value: "70", Instance: 2}, {Field: "visit_date", Value: "", Instance: 2}},
+		},
+		{
+			"multiline",
+			"age = '34',\nnotes = 'line one\nline two'",
+			[]LogChange{{Field: "age", Value: "34"}, {Field: "notes", Value: "line one\nline two"}},
+		},
+		{"not assignments", "Record locked", nil},
+	}
+	for _, tt := range tests {
+		if got := parseLogDetails(tt.details); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: parseLogDetails(%q) =\n%v\nwant\n%v", tt.name, tt.details, got, tt.want)
+		}
+	}
+}
+
+func TestLogEntryChanges(t *testing.T) {
+	tests := []struct {
+		action string
+		want   bool
+	}{
+		{"Update record 12", true},
+		{"Create record 3", true},
+		{"Delete record 3", true},
+		{"Update response 4", true},
+		{"Manage/Design", false},
+		{"Lock/Unlock Record 5", false},
+	}
+	for _, tt := range tests {
+		e := LogEntry{Action: tt.action, Details: "age = '1'"}
+		if got := len(e.Changes()) > 0; got != tt.want {
+			t.Errorf("Changes for %q: got changes %v, want %v", tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestActionRecord(t *testing.T) {
+	tests := map[string]string{
+		"Update record 12":                    "12",
+		"Update record 12 (Auto calculation)": "12",
+		"Create record 1001-3":                "1001-3",
+		"Manage/Design":                       "",
+	}
+	for action, want := range tests {
+		if got := actionRecord(action); got != want {
+			t.Errorf("actionRecord(%q) = %q, want %q", action, got, want)
+		}
+	}
+}
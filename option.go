@@ -1,6 +1,9 @@
 package redcap
 
-import "strconv"
+import (
+	"strconv"
+	"time"
+)
 
 type ExportOptions struct {
 	Records                []string // Record IDs
@@ -71,6 +74,14 @@ func ExportRawOrLabel(v string) ExportOption {
 	}
 }
 
+// ExportRawOrLabelHeaders sets whether CSV headers are field names
+// ("raw") or field labels ("label").
+func ExportRawOrLabelHeaders(v string) ExportOption {
+	return func(p map[string]string) {
+		p["rawOrLabelHeaders"] = v
+	}
+}
+
 // ExportFormat sets the export format.
 func ExportFormat(format string) ExportOption {
 	return func(p map[string]string) {
@@ -106,6 +117,27 @@ func ExportFilterLogic(logic string) ExportOption {
 	}
 }
 
+// dateRangeLayout is the timestamp format of dateRangeBegin/End.
+const dateRangeLayout = "2006-01-02 15:04:05"
+
+// ExportDateRangeBegin limits the export to records created or modified
+// at or after t. REDCap compares against its own local time, so t is
+// formatted in its location; use t.In(serverZone) when the server's zone
+// differs.
+func ExportDateRangeBegin(t time.Time) ExportOption {
+	return func(p map[string]string) {
+		p["dateRangeBegin"] = t.Format(dateRangeLayout)
+	}
+}
+
+// ExportDateRangeEnd limits the export to records created or modified
+// before t, in the same way as ExportDateRangeBegin.
+func ExportDateRangeEnd(t time.Time) ExportOption {
+	return func(p map[string]string) {
+		p["dateRangeEnd"] = t.Format(dateRangeLayout)
+	}
+}
+
 // ImportOption is a functional option for ImportRecords.
 type ImportOption func(map[string]string)
 
@@ -130,6 +162,13 @@ func ImportForceAutoNumber(b bool) ImportOption {
 	}
 }
 
+// ImportDateFormat sets the date format of imported values.
+func ImportDateFormat(format string) ImportOption {
+	return func(p map[string]string) {
+		p["dateFormat"] = format
+	}
+}
+
 // ImportReturnContent sets what to return.
 func ImportReturnContent(content string) ImportOption {
 	return func(p map[string]string) {
@@ -137,6 +176,21 @@ func ImportReturnContent(content string) ImportOption {
 	}
 }
 
+// ImportFileName sets the name of a file sent with ImportFile.
+func ImportFileName(name string) ImportOption {
+	return func(p map[string]string) {
+		p["filename"] = name
+	}
+}
+
+// ImportRepeatInstance targets one instance of a repeating form or event
+// with ImportFile.
+func ImportRepeatInstance(n int) ImportOption {
+	return func(p map[string]string) {
+		p["repeat_instance"] = strconv.Itoa(n)
+	}
+}
+
 func commaJoin(s []string) string {
 	if len(s) == 0 {
 		return ""
@@ -0,0 +1,276 @@
+// Package parquet writes REDCap records as Parquet files with column types
+// taken from the data dictionary.
+//
+// Integer and slider columns are INT64, numbers are DOUBLE (or DECIMAL for
+// fixed-decimal validations), dates are DATE, datetimes are TIMESTAMP and
+// times are TIME. Dropdown, radio and form status columns are
+// dictionary-encoded strings whose choice labels are stored in the file's
+// key/value metadata as "redcap.choices.<field>". Checkbox, yes/no and
+// true/false columns are BOOLEAN. Field labels are stored as
+// "redcap.label.<column>".
+package parquet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjodo/go-cap"
+	pq "github.com/parquet-go/parquet-go"
+)
+
+// Writer streams batches of flat records to a Parquet file. Each batch
+// becomes one row group, so memory use is bounded by the batch size.
+type Writer struct {
+	out  io.Writer
+	dict *redcap.Dictionary
+
+	pw      *pq.Writer
+	columns []column
+
+	// Invalid counts values that did not parse as their column's type and
+	// were written as null, by column.
+	Invalid map[string]int
+}
+
+type column struct {
+	name  string
+	kind  kind
+	scale int // decimal places for kindDecimal
+}
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindCategory
+	kindInt
+	kindDouble
+	kindDecimal
+	kindDate
+	kindTimestamp
+	kindTime
+	kindBool
+)
+
+// NewWriter returns a Writer for records of the dictionary's project. The
+// schema is taken from the first batch written; call Close to finish the
+// file.
+func NewWriter(w io.Writer, dict *redcap.Dictionary) *Writer {
+	return &Writer{out: w, dict: dict, Invalid: make(map[string]int)}
+}
+
+// Write appends one batch of flat export rows as a row group.
+func (w *Writer) Write(rows []map[string]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if w.pw == nil {
+		// Every row of a REDCap export has the same columns
+		names := make([]string, 0, len(rows[0]))
+		for k := range rows[0] {
+			names = append(names, k)
+		}
+		w.start(names)
+	}
+
+	batch := make([]pq.Row, len(rows))
+	for i, r := range rows {
+		row := make(pq.Row, len(w.columns))
+		for j, col := range w.columns {
+			row[j] = w.value(col, redcap.ValueText(r[col.name])).Level(0, 1, j)
+			if row[j].IsNull() {
+				row[j] = pq.NullValue().Level(0, 0, j)
+			}
+		}
+		batch[i] = row
+	}
+	if _, err := w.pw.WriteRows(batch); err != nil {
+		return fmt.Errorf("writing parquet rows: %w", err)
+	}
+	if err := w.pw.Flush(); err != nil {
+		return fmt.Errorf("writing parquet row group: %w", err)
+	}
+	return nil
+}
+
+// Close writes the file footer. A writer that was never given rows writes
+// an empty file with every dictionary column.
+func (w *Writer) Close() error {
+	if w.pw == nil {
+		names := []string{w.dict.RecordIDField}
+		for _, form := range w.dict.Forms() {
+			for _, col := range w.dict.FormColumns(form) {
+				if col != w.dict.RecordIDField {
+					names = append(names, col)
+				}
+			}
+		}
+		w.start(names)
+	}
+	if err := w.pw.Close(); err != nil {
+		return fmt.Errorf("closing parquet file: %w", err)
+	}
+	return nil
+}
+
+// start builds the schema for the given columns and opens the writer.
+// Parquet groups order their fields by name, so columns are sorted.
+func (w *Writer) start(names []string) {
+	sort.Strings(names)
+	group := make(pq.Group, len(names))
+	opts := []pq.WriterOption{pq.Compression(&pq.Snappy)}
+	choices := make(map[string]bool)
+
+	for _, name := range names {
+		col := w.column(name)
+		w.columns = append(w.columns, col)
+		group[name] = pq.Optional(node(col))
+
+		if f, ok := w.dict.Field(name); ok {
+			if label := w.dict.ColumnLabel(name); label != "" {
+				opts = append(opts, pq.KeyValueMetadata("redcap.label."+name, label))
+			}
+			if col.kind == kindCategory && len(f.Choices) > 0 && !choices[f.Field_name] {
+				choices[f.Field_name] = true
+				opts = append(opts, pq.KeyValueMetadata("redcap.choices."+f.Field_name, choiceJSON(f)))
+			}
+		} else if col.kind == kindCategory {
+			opts = append(opts, pq.KeyValueMetadata("redcap.choices."+name, formStatusJSON))
+		}
+	}
+
+	opts = append(opts, pq.NewSchema("redcap", group))
+	w.pw = pq.NewWriter(w.out, opts...)
+}
+
+// column types one export column.
+func (w *Writer) column(name string) column {
+	col := column{name: name}
+	switch w.dict.ColumnType(name) {
+	case redcap.ColumnInteger:
+		col.kind = kindInt
+	case redcap.ColumnNumber:
+		col.kind = kindDouble
+		if f, ok := w.dict.Field(name); ok {
+			if n, ok := decimalPlaces(f.ValidationType()); ok {
+				col.kind, col.scale = kindDecimal, n
+			}
+		}
+	case redcap.ColumnDate:
+		col.kind = kindDate
+	case redcap.ColumnDatetime:
+		col.kind = kindTimestamp
+	case redcap.ColumnTime:
+		col.kind = kindTime
+	case redcap.ColumnBoolean:
+		col.kind = kindBool
+	case redcap.ColumnCategory:
+		col.kind = kindCategory
+	}
+	return col
+}
+
+// decimalPlaces reads the scale of number_2dp and number_2dp_comma_decimal.
+func decimalPlaces(vt string) (int, bool) {
+	rest, ok := strings.CutPrefix(vt, "number_")
+	if !ok {
+		return 0, false
+	}
+	digits, _, ok := strings.Cut(rest, "dp")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil
+}
+
+func node(col column) pq.Node {
+	switch col.kind {
+	case kindCategory:
+		return pq.Encoded(pq.String(), &pq.RLEDictionary)
+	case kindInt:
+		return pq.Int(64)
+	case kindDouble:
+		return pq.Leaf(pq.DoubleType)
+	case kindDecimal:
+		return pq.Decimal(col.scale, 18, pq.Int64Type)
+	case kindDate:
+		return pq.Date()
+	case kindTimestamp:
+		// REDCap datetimes are wall-clock times without a zone
+		return pq.TimestampAdjusted(pq.Millisecond, false)
+	case kindTime:
+		return pq.Time(pq.Millisecond)
+	case kindBool:
+		return pq.Leaf(pq.BooleanType)
+	}
+	return pq.String()
+}
+
+// value converts an exported value. Empty and unparsable values are null.
+func (w *Writer) value(col column, v string) pq.Value {
+	if v == "" {
+		return pq.NullValue()
+	}
+	switch col.kind {
+	case kindString, kindCategory:
+		return pq.ByteArrayValue([]byte(v))
+	case kindInt:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return pq.Int64Value(n)
+		}
+	case kindDouble:
+		if n, err := parseNumber(v); err == nil {
+			return pq.DoubleValue(n)
+		}
+	case kindDecimal:
+		if n, err := parseNumber(v); err == nil {
+			return pq.Int64Value(int64(math.Round(n * math.Pow10(col.scale))))
+		}
+	case kindDate:
+		if t, err := time.Parse("2006-01-02", v); err == nil {
+			return pq.Int32Value(int32(t.Unix() / 86400))
+		}
+	case kindTimestamp:
+		if t, ok := redcap.ParseDatetime(v); ok {
+			return pq.Int64Value(t.UnixMilli())
+		}
+	case kindTime:
+		if t, err := time.Parse("15:04", v); err == nil {
+			return pq.Int32Value(int32(t.Hour()*3600000 + t.Minute()*60000))
+		}
+	case kindBool:
+		// Raw exports send 0/1; label exports Checked/Unchecked or Yes/No
+		switch v {
+		case "1", "Checked", "Yes", "True":
+			return pq.BooleanValue(true)
+		case "0", "Unchecked", "No", "False":
+			return pq.BooleanValue(false)
+		}
+	}
+	w.Invalid[col.name]++
+	return pq.NullValue()
+}
+
+func parseNumber(v string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+}
+
+// choiceJSON encodes a field's choices as {"code": "label"}.
+func choiceJSON(f *redcap.Field) string {
+	m := make(map[string]string, len(f.Choices))
+	for _, c := range f.Choices {
+		m[c.Code] = c.Label
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// formStatusJSON labels the codes of form status columns.
+const formStatusJSON = `{"0":"Incomplete","1":"Unverified","2":"Complete"}`
@@ -0,0 +1,81 @@
+package parquet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cjodo/go-cap"
+	pq "github.com/parquet-go/parquet-go"
+)
+
+func TestWriterTypedColumns(t *testing.T) {
+	dict := redcap.NewDictionary([]redcap.Field{
+		{Field_name: "record_id", Form_name: "demo", Field_type: "text", Field_label: "Record ID"},
+		{Field_name: "age", Form_name: "demo", Field_type: "text", Field_label: "Age", Text_validation_type_or_show_slider_number: "integer"},
+		{Field_name: "dob", Form_name: "demo", Field_type: "text", Field_label: "Birth date", Text_validation_type_or_show_slider_number: "date_ymd"},
+		{Field_name: "arm", Form_name: "demo", Field_type: "radio", Field_label: "Arm", Choices: []redcap.FieldChoice{{ID: 1, Code: "1", Label: "Drug"}, {ID: 2, Code: "2", Label: "Placebo"}}},
+	})
+	row := func(id, age, dob, arm string) map[string]any {
+		return map[string]any{"record_id": id, "age": age, "dob": dob, "arm": arm, "demo_complete": "2"}
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, dict)
+	if err := w.Write([]map[string]any{row("1", "41", "1983-02-01", "1"), row("2", "forty", "", "2")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]map[string]any{row("3", "", "2001-12-31", "1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Invalid) != 1 || w.Invalid["age"] != 1 {
+		t.Errorf("Invalid = %v, want one unparsable age", w.Invalid)
+	}
+
+	f, err := pq.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.RowGroups()); n != 2 {
+		t.Errorf("%d row groups, want one per batch", n)
+	}
+	if got, _ := f.Lookup("redcap.choices.arm"); got != `{"1":"Drug","2":"Placebo"}` {
+		t.Errorf("arm choices = %s", got)
+	}
+	if got, _ := f.Lookup("redcap.choices.demo_complete"); got != formStatusJSON {
+		t.Errorf("form status choices = %s", got)
+	}
+
+	// Columns are sorted by name
+	names := []string{"age", "arm", "demo_complete", "dob", "record_id"}
+	for i, cc := range f.Metadata().RowGroups[0].Columns {
+		dictionary := cc.MetaData.DictionaryPageOffset != 0
+		if want := names[i] == "arm" || names[i] == "demo_complete"; dictionary != want {
+			t.Errorf("column %s dictionary-encoded = %v, want %v", names[i], dictionary, want)
+		}
+	}
+
+	rows := make([]pq.Row, 2)
+	n, _ := f.RowGroups()[0].Rows().ReadRows(rows)
+	if n != 2 {
+		t.Fatalf("read %d rows, want 2", n)
+	}
+	first, second := rows[0], rows[1]
+	if got := first[0].Int64(); got != 41 {
+		t.Errorf("age = %d, want 41", got)
+	}
+	if !second[0].IsNull() {
+		t.Errorf("unparsable age = %v, want null", second[0])
+	}
+	if got := first[1].String(); got != "1" {
+		t.Errorf("arm = %q, want the raw code", got)
+	}
+	if got := first[3].Int32(); got != 4779 {
+		t.Errorf("dob = %d days, want 4779", got)
+	}
+	if !second[3].IsNull() {
+		t.Errorf("empty dob = %v, want null", second[3])
+	}
+}
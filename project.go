@@ -41,6 +41,18 @@ func (c *Client) Ping(ctx context.Context) error {
 	return err
 }
 
+// ping sends the Ping request once, bypassing retries and the circuit
+// breaker. The breaker uses it to probe a server it considers down.
+func (c *Client) ping(ctx context.Context) error {
+	if err := c.rateLimiter.Wait(ctx); err != nil {
+		return err
+	}
+	_, _, err := c.doRequest(ctx, "project", map[string]string{
+		"format": "json",
+	}, nil)
+	return err
+}
+
 // ExportProject returns project information.
 func (c *Client) ExportProject(ctx context.Context) (map[string]interface{}, error) {
 	body, err := c.Request(ctx, "project", map[string]string{
@@ -2,12 +2,24 @@ package redcap
 
 import (
 	"context"
+	"sync"
+	"time"
+
 	"golang.org/x/time/rate"
 )
 
 const (
 	DefaultRPS   = 10
 	DefaultBurst = 10
+
+	// DefaultMinRPS is the floor the adaptive limiter never drops below.
+	DefaultMinRPS = 0.5
+	// DefaultDecreaseFactor is the multiplicative decrease applied on a 429.
+	DefaultDecreaseFactor = 0.5
+	// DefaultIncreaseStep is the additive increase (in rps) applied after
+	// DefaultRecoveryThreshold consecutive successes.
+	DefaultIncreaseStep      = 1.0
+	DefaultRecoveryThreshold = 20
 )
 
 // RateLimiter defines the contract.
@@ -18,24 +30,125 @@ type RateLimiter interface {
 	GetRate() float64
 }
 
+// AdaptiveRateLimiter is a RateLimiter that reacts to server feedback.
+// Client.Request reports every successful call and every 429 to it.
+type AdaptiveRateLimiter interface {
+	RateLimiter
+	// OnSuccess records a successful request.
+	OnSuccess()
+	// OnThrottle records a 429. retryAfter is the server-provided delay,
+	// or zero when the response carried no Retry-After header.
+	OnThrottle(retryAfter time.Duration)
+	// State returns a snapshot of the limiter.
+	State() LimiterState
+}
+
+// LimiterState is a point-in-time view of an adaptive rate limiter.
+type LimiterState struct {
+	Rate         float64   // current requests per second
+	MinRate      float64   // floor for multiplicative decrease
+	MaxRate      float64   // configured maximum; recovery stops here
+	Burst        int       // token bucket size
+	Successes    int       // consecutive successes since the last change
+	Throttles    int       // total 429s observed
+	BlockedUntil time.Time // Wait blocks until this time (Retry-After)
+}
+
+// LimiterOption configures the default rate limiter.
+type LimiterOption func(*limiter)
+
+// WithMinRate sets the floor the rate never drops below.
+func WithMinRate(rps float64) LimiterOption {
+	return func(l *limiter) {
+		l.minRate = rps
+	}
+}
+
+// WithDecreaseFactor sets the multiplicative decrease applied on a 429.
+func WithDecreaseFactor(f float64) LimiterOption {
+	return func(l *limiter) {
+		l.decrease = f
+	}
+}
+
+// WithRecovery sets the additive increase step and how many consecutive
+// successes are required before each step.
+func WithRecovery(step float64, threshold int) LimiterOption {
+	return func(l *limiter) {
+		l.increase = step
+		l.threshold = threshold
+	}
+}
+
 type limiter struct {
 	r *rate.Limiter
+
+	mu           sync.Mutex
+	maxRate      float64
+	minRate      float64
+	decrease     float64
+	increase     float64
+	threshold    int
+	successes    int
+	throttles    int
+	blockedUntil time.Time
 }
 
 // NewRateLimiterWithDefaultOpts returns the interface, not a pointer to it.
 func NewRateLimiterWithDefaultOpts() RateLimiter {
-	return &limiter{
-		r: rate.NewLimiter(rate.Limit(DefaultRPS), DefaultBurst),
+	return NewRateLimiter(DefaultRPS, DefaultBurst)
+}
+
+// NewRateLimiter returns an AIMD rate limiter capped at rps. On a 429 the
+// rate is multiplied by the decrease factor (never below the floor); after
+// a run of consecutive successes it climbs back toward rps additively.
+func NewRateLimiter(rps float64, burst int, opts ...LimiterOption) AdaptiveRateLimiter {
+	l := &limiter{
+		r:         rate.NewLimiter(rate.Limit(rps), burst),
+		maxRate:   rps,
+		minRate:   DefaultMinRPS,
+		decrease:  DefaultDecreaseFactor,
+		increase:  DefaultIncreaseStep,
+		threshold: DefaultRecoveryThreshold,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.minRate > l.maxRate {
+		l.minRate = l.maxRate
 	}
+	return l
 }
 
-// Wait matches the interface signature exactly.
+// Wait matches the interface signature exactly. It first honors any
+// Retry-After pause, then waits for a token.
 func (l *limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	until := l.blockedUntil
+	l.mu.Unlock()
+
+	if d := time.Until(until); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
 	return l.r.Wait(ctx)
 }
 
-// SetRate converts the float64 to rate.Limit internally.
+// SetRate converts the float64 to rate.Limit internally. It also becomes
+// the new maximum the limiter recovers toward.
 func (l *limiter) SetRate(rps float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxRate = rps
+	if l.minRate > rps {
+		l.minRate = rps
+	}
+	l.successes = 0
 	l.r.SetLimit(rate.Limit(rps))
 }
 
@@ -43,3 +156,51 @@ func (l *limiter) SetRate(rps float64) {
 func (l *limiter) GetRate() float64 {
 	return float64(l.r.Limit())
 }
+
+// OnSuccess implements AdaptiveRateLimiter.
+func (l *limiter) OnSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cur := float64(l.r.Limit())
+	if cur >= l.maxRate {
+		l.successes = 0
+		return
+	}
+	l.successes++
+	if l.successes < l.threshold {
+		return
+	}
+	l.successes = 0
+	l.r.SetLimit(rate.Limit(min(cur+l.increase, l.maxRate)))
+}
+
+// OnThrottle implements AdaptiveRateLimiter.
+func (l *limiter) OnThrottle(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.throttles++
+	l.successes = 0
+	l.r.SetLimit(rate.Limit(max(float64(l.r.Limit())*l.decrease, l.minRate)))
+	if retryAfter > 0 {
+		if until := time.Now().Add(retryAfter); until.After(l.blockedUntil) {
+			l.blockedUntil = until
+		}
+	}
+}
+
+// State implements AdaptiveRateLimiter.
+func (l *limiter) State() LimiterState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterState{
+		Rate:         float64(l.r.Limit()),
+		MinRate:      l.minRate,
+		MaxRate:      l.maxRate,
+		Burst:        l.r.Burst(),
+		Successes:    l.successes,
+		Throttles:    l.throttles,
+		BlockedUntil: l.blockedUntil,
+	}
+}
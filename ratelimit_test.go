@@ -0,0 +1,70 @@
+package redcap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterAIMD(t *testing.T) {
+	l := NewRateLimiter(10, 10, WithMinRate(2), WithRecovery(3, 2))
+
+	for _, want := range []float64{5, 2.5, 2, 2} {
+		l.OnThrottle(0)
+		if got := l.GetRate(); got != want {
+			t.Fatalf("rate after throttle = %v, want %v", got, want)
+		}
+	}
+
+	// Each step needs two consecutive successes, and stops at the maximum
+	for _, want := range []float64{2, 5, 5, 8, 8, 10, 10, 10} {
+		l.OnSuccess()
+		if got := l.GetRate(); got != want {
+			t.Fatalf("rate after success = %v, want %v", got, want)
+		}
+	}
+	if s := l.State(); s.Throttles != 4 || s.MaxRate != 10 || s.MinRate != 2 {
+		t.Errorf("state = %+v", s)
+	}
+}
+
+func TestLimiterThrottleResetsRecovery(t *testing.T) {
+	l := NewRateLimiter(10, 10, WithRecovery(1, 2))
+	l.OnThrottle(0)
+	l.OnSuccess()
+	l.OnThrottle(0)
+	l.OnSuccess()
+	if got := l.GetRate(); got != 2.5 {
+		t.Errorf("rate = %v, want 2.5: a throttle must reset the success run", got)
+	}
+}
+
+func TestLimiterRetryAfterBlocksWait(t *testing.T) {
+	l := NewRateLimiter(1000, 1000)
+	l.OnThrottle(time.Second)
+	if until := l.State().BlockedUntil; time.Until(until) < 900*time.Millisecond {
+		t.Fatalf("BlockedUntil = %v, want about a second ahead", until)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait during Retry-After = %v, want deadline exceeded", err)
+	}
+
+	// A shorter Retry-After never shortens the pause
+	before := l.State().BlockedUntil
+	l.OnThrottle(time.Millisecond)
+	if got := l.State().BlockedUntil; !got.Equal(before) {
+		t.Errorf("BlockedUntil moved from %v to %v", before, got)
+	}
+}
+
+func TestLimiterSetRate(t *testing.T) {
+	l := NewRateLimiter(10, 10, WithMinRate(5))
+	l.SetRate(3)
+	if s := l.State(); s.Rate != 3 || s.MaxRate != 3 || s.MinRate != 3 {
+		t.Errorf("state after SetRate(3) = %+v", s)
+	}
+}
@@ -1,14 +1,46 @@
 package redcap
 
+import "encoding/json"
+
 type Record struct {
 	ID string
 	// FieldName->Value
 	Fields     map[string]any
 	EventName  string
 	Repetition FormRepetition
+	// DataAccessGroup is the unique name of the record's DAG, exported
+	// with ExportDataAccessGroups(true). On import, a non-empty value
+	// assigns the record to that DAG.
+	DataAccessGroup string
 }
 
 type FormRepetition struct {
 	FormName          string
 	CustomRecordLabel string
+	// Instance is the repeat instance, starting at 1, of a repeating
+	// instrument or event. Zero is not a repeat instance.
+	Instance int
+}
+
+// MarshalJSON encodes the record as a flat REDCap row, the shape the
+// record import endpoint expects.
+func (r Record) MarshalJSON() ([]byte, error) {
+	row := make(map[string]any, len(r.Fields)+5)
+	for k, v := range r.Fields {
+		row[k] = v
+	}
+	row[RecordIDField] = r.ID
+	if r.EventName != "" {
+		row["redcap_event_name"] = r.EventName
+	}
+	if r.Repetition.FormName != "" {
+		row["redcap_repeat_instrument"] = r.Repetition.FormName
+	}
+	if r.Repetition.Instance > 0 {
+		row["redcap_repeat_instance"] = r.Repetition.Instance
+	}
+	if r.DataAccessGroup != "" {
+		row["redcap_data_access_group"] = r.DataAccessGroup
+	}
+	return json.Marshal(row)
 }
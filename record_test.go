@@ -0,0 +1,51 @@
+package redcap
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRecordMarshalJSON(t *testing.T) {
+	r := Record{
+		ID:              "7",
+		Fields:          map[string]any{"weight": "70"},
+		EventName:       "visit_1_arm_1",
+		Repetition:      FormRepetition{FormName: "meds", Instance: 2},
+		DataAccessGroup: "north",
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var row map[string]any
+	if err := json.Unmarshal(b, &row); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"record_id":                "7",
+		"weight":                   "70",
+		"redcap_event_name":        "visit_1_arm_1",
+		"redcap_repeat_instrument": "meds",
+		"redcap_repeat_instance":   float64(2),
+		"redcap_data_access_group": "north",
+	}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("row = %v, want %v", row, want)
+	}
+
+	got := recordsFromRows([]map[string]any{row})[0]
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("round trip = %+v, want %+v", got, r)
+	}
+}
+
+func TestRecordMarshalJSONNotRepeating(t *testing.T) {
+	b, err := json.Marshal(Record{ID: "1", Fields: map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != `{"record_id":"1"}` {
+		t.Errorf("json = %s", got)
+	}
+}
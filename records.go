@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 )
 
 // ExportRecords returns records from the project.
@@ -27,8 +28,13 @@ func (c *Client) ExportRecords(ctx context.Context, opts ...ExportOption) ([]Rec
 		return nil, fmt.Errorf("unmarshaling records: %w", err)
 	}
 
-	result := make([]Record, len(records))
-	for i, r := range records {
+	return recordsFromRows(records), nil
+}
+
+// recordsFromRows converts flat JSON export rows to Records.
+func recordsFromRows(rows []map[string]any) []Record {
+	result := make([]Record, len(rows))
+	for i, r := range rows {
 		record := Record{
 			Fields: make(map[string]any),
 		}
@@ -38,14 +44,19 @@ func (c *Client) ExportRecords(ctx context.Context, opts ...ExportOption) ([]Rec
 				record.ID = fmt.Sprintf("%v", v)
 			case "redcap_event_name":
 				record.EventName = fmt.Sprintf("%v", v)
+			case "redcap_data_access_group":
+				record.DataAccessGroup = fmt.Sprintf("%v", v)
+			case "redcap_repeat_instrument":
+				record.Repetition.FormName = fmt.Sprintf("%v", v)
+			case "redcap_repeat_instance":
+				record.Repetition.Instance, _ = strconv.Atoi(ValueText(v))
 			default:
 				record.Fields[k] = v
 			}
 		}
 		result[i] = record
 	}
-
-	return result, nil
+	return result
 }
 
 // ExportRecordsRaw returns raw format (CSV/JSON) for records.
@@ -63,3 +74,65 @@ func (c *Client) ExportRecordsRaw(ctx context.Context, opts ...ExportOption) ([]
 
 // RecordIDField is the default field name for record IDs
 const RecordIDField = "record_id"
+
+// ExportRecordBatches exports flat JSON records in batches of size
+// records, calling fn with the rows of each batch, so that large projects
+// can be processed in bounded memory. Record names are fetched first
+// (honoring opts), then each batch is exported with opts. All rows of a
+// record are in the same batch.
+func (c *Client) ExportRecordBatches(ctx context.Context, size int, fn func(rows []map[string]any) error, opts ...ExportOption) error {
+	if size < 1 {
+		return fmt.Errorf("batch size must be positive, got %d", size)
+	}
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("exporting metadata: %w", err)
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("project has no fields")
+	}
+	idField := fields[0].Field_name
+
+	params := map[string]string{
+		"content": "record",
+		"format":  "json",
+		"type":    "flat",
+	}
+	for _, opt := range opts {
+		opt(params)
+	}
+	params["format"] = "json"
+
+	// The name pass only needs the record ID column
+	idParams := make(map[string]string, len(params))
+	for k, v := range params {
+		idParams[k] = v
+	}
+	idParams["fields"] = idField
+	delete(idParams, "forms")
+	body, err := c.Request(ctx, "", idParams)
+	if err != nil {
+		return err
+	}
+	var idRows []map[string]any
+	if err := json.Unmarshal(body, &idRows); err != nil {
+		return fmt.Errorf("unmarshaling records: %w", err)
+	}
+	ids := recordIDs(idRows, idField)
+
+	for start := 0; start < len(ids); start += size {
+		params["records"] = commaJoin(ids[start:min(start+size, len(ids))])
+		body, err := c.Request(ctx, "", params)
+		if err != nil {
+			return err
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(body, &rows); err != nil {
+			return fmt.Errorf("unmarshaling records: %w", err)
+		}
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConcurrency is how many projects a Registry works on at once.
+const DefaultConcurrency = 4
+
+// Profile describes one REDCap project: where it lives, how to
+// authenticate and how hard its host may be driven.
+type Profile struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+	// TokenFrom names an external token source, used when Token is empty.
+	TokenFrom *TokenSpec `json:"token_from,omitempty"`
+	// TokenSource overrides both Token and TokenFrom.
+	TokenSource TokenSource `json:"-"`
+	// RPS and Burst set the rate limit for the profile's host. Projects on
+	// the same host share one limiter; the first profile registered for a
+	// host decides its limit.
+	RPS   float64 `json:"rps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// host holds what is shared between projects on one REDCap instance.
+type host struct {
+	limiter    RateLimiter
+	httpClient *http.Client
+}
+
+// Registry manages clients for many named projects. Projects on the same
+// REDCap host share a rate limiter and an HTTP transport, so fanning out
+// across projects does not multiply the load on the server.
+type Registry struct {
+	opts        []Option
+	concurrency int
+	passphrase  func() ([]byte, error)
+
+	mu       sync.RWMutex
+	profiles map[string]Profile
+	clients  map[string]*Client
+	hosts    map[string]*host
+}
+
+// NewRegistry returns an empty registry. opts are applied to every client
+// it creates, after the shared limiter and HTTP client.
+func NewRegistry(opts ...Option) *Registry {
+	return &Registry{
+		opts:        opts,
+		concurrency: DefaultConcurrency,
+		profiles:    make(map[string]Profile),
+		clients:     make(map[string]*Client),
+		hosts:       make(map[string]*host),
+	}
+}
+
+// LoadRegistry reads a JSON array of profiles from path.
+func LoadRegistry(path string, opts ...Option) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading profiles: %w", err)
+	}
+
+	var profiles []Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("unmarshaling profiles: %w", err)
+	}
+
+	r := NewRegistry(opts...)
+	for _, p := range profiles {
+		if err := r.Add(p); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// SetConcurrency sets how many projects Each works on at once.
+func (r *Registry) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.concurrency = n
+}
+
+// SetPassphrase sets how the passphrase for encrypted token stores
+// referenced by profiles is obtained.
+func (r *Registry) SetPassphrase(fn func() ([]byte, error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.passphrase = fn
+}
+
+// Add registers a profile, replacing any existing one with the same name.
+func (r *Registry) Add(p Profile) error {
+	if p.Name == "" {
+		return fmt.Errorf("profile has no name")
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("profile %s: invalid url %q", p.Name, p.URL)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.hosts[u.Host]
+	if !ok {
+		rps, burst := p.RPS, p.Burst
+		if rps <= 0 {
+			rps = DefaultRPS
+		}
+		if burst <= 0 {
+			burst = DefaultBurst
+		}
+		h = &host{
+			limiter: NewRateLimiter(rps, burst),
+			httpClient: &http.Client{
+				Timeout:   30 * time.Second,
+				Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			},
+		}
+		r.hosts[u.Host] = h
+	}
+
+	opts := []Option{
+		WithRateLimiter(h.limiter),
+		WithHTTPClient(h.httpClient),
+	}
+	ts := p.TokenSource
+	if ts == nil && p.Token == "" && p.TokenFrom != nil {
+		if ts, err = p.TokenFrom.Source(p.Name, r.passphrase); err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+	}
+	if ts != nil {
+		opts = append(opts, WithTokenSource(ts))
+	}
+	opts = append(opts, r.opts...)
+	c, err := NewClient(p.URL, p.Token, opts...)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+
+	r.profiles[p.Name] = p
+	r.clients[p.Name] = c
+	return nil
+}
+
+// Remove drops a profile. The host's shared limiter is kept.
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.profiles, name)
+	delete(r.clients, name)
+}
+
+// Client returns the client for a named project.
+func (r *Registry) Client(name string) (*Client, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown project %q", name)
+	}
+	return c, nil
+}
+
+// Profile returns the profile for a named project.
+func (r *Registry) Profile(name string) (Profile, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.profiles[name]
+	return p, ok
+}
+
+// Names returns the registered project names in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.profiles))
+	for name := range r.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProjectErrors maps project names to the error each one failed with.
+type ProjectErrors map[string]error
+
+func (e ProjectErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e[name].Error()
+	}
+	return fmt.Sprintf("%d project(s) failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Each runs fn for the named projects, or for every project if names is
+// empty, at most SetConcurrency at a time. It returns ProjectErrors for
+// the projects that failed, or nil if none did.
+func (r *Registry) Each(ctx context.Context, names []string, fn func(ctx context.Context, name string, c *Client) error) error {
+	if len(names) == 0 {
+		names = r.Names()
+	}
+	r.mu.RLock()
+	concurrency := r.concurrency
+	r.mu.RUnlock()
+
+	var (
+		mu   sync.Mutex
+		errs = make(ProjectErrors)
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, concurrency)
+	)
+	for _, name := range names {
+		c, err := r.Client(name)
+		if err != nil {
+			mu.Lock()
+			errs[name] = err
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				mu.Lock()
+				errs[name] = ctx.Err()
+				mu.Unlock()
+				return
+			}
+			defer func() { <-sem }()
+
+			if err := fn(ctx, name, c); err != nil {
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Collect runs fn across projects like Each and gathers the results of the
+// projects that succeeded.
+func Collect[T any](ctx context.Context, r *Registry, names []string, fn func(ctx context.Context, c *Client) (T, error)) (map[string]T, error) {
+	var mu sync.Mutex
+	results := make(map[string]T)
+	err := r.Each(ctx, names, func(ctx context.Context, name string, c *Client) error {
+		v, err := fn(ctx, c)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		results[name] = v
+		mu.Unlock()
+		return nil
+	})
+	return results, err
+}
+
+// ExportMetadata exports the data dictionary of every project.
+func (r *Registry) ExportMetadata(ctx context.Context) (map[string][]Field, error) {
+	return Collect(ctx, r, nil, func(ctx context.Context, c *Client) ([]Field, error) {
+		return c.ExportMetadata(ctx)
+	})
+}
+
+// ExportProject exports the project information of every project.
+func (r *Registry) ExportProject(ctx context.Context) (map[string]map[string]interface{}, error) {
+	return Collect(ctx, r, nil, func(ctx context.Context, c *Client) (map[string]interface{}, error) {
+		return c.ExportProject(ctx)
+	})
+}
+
+// Ping checks connectivity to every project.
+func (r *Registry) Ping(ctx context.Context) error {
+	return r.Each(ctx, nil, func(ctx context.Context, _ string, c *Client) error {
+		return c.Ping(ctx)
+	})
+}
@@ -0,0 +1,166 @@
+package redcap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistrySharesPerHost(t *testing.T) {
+	srvA := httptest.NewServer(http.NotFoundHandler())
+	defer srvA.Close()
+	srvB := httptest.NewServer(http.NotFoundHandler())
+	defer srvB.Close()
+
+	r := NewRegistry()
+	for _, p := range []Profile{
+		{Name: "a1", URL: srvA.URL + "/api/", Token: testToken, RPS: 3, Burst: 3},
+		{Name: "a2", URL: srvA.URL + "/api/", Token: testToken, RPS: 50},
+		{Name: "b", URL: srvB.URL + "/api/", Token: testToken},
+	} {
+		if err := r.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := func(name string) *Client {
+		c, err := r.Client(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	a1, a2, b := client("a1"), client("a2"), client("b")
+
+	if a1.rateLimiter != a2.rateLimiter || a1.httpClient != a2.httpClient {
+		t.Error("projects on one host do not share a limiter and HTTP client")
+	}
+	if a1.rateLimiter == b.rateLimiter || a1.httpClient == b.httpClient {
+		t.Error("projects on different hosts share a limiter or HTTP client")
+	}
+	if a1.httpClient.Transport == http.DefaultTransport {
+		t.Error("host uses the default transport")
+	}
+	// The first profile registered for a host sets its limit
+	if state, _ := a2.RateLimiterState(); state.Rate != 3 {
+		t.Errorf("a2 rate = %v, want 3 from a1", state.Rate)
+	}
+	if state, _ := b.RateLimiterState(); state.Rate != DefaultRPS {
+		t.Errorf("b rate = %v, want %v", state.Rate, float64(DefaultRPS))
+	}
+
+	r.Remove("a1")
+	if _, err := r.Client("a1"); err == nil {
+		t.Error("removed project still has a client")
+	}
+	if got := strings.Join(r.Names(), ","); got != "a2,b" {
+		t.Errorf("Names = %s", got)
+	}
+}
+
+func TestRegistryAddInvalid(t *testing.T) {
+	r := NewRegistry()
+	for _, p := range []Profile{
+		{URL: "https://redcap.example.edu/api/"},
+		{Name: "x", URL: "not a url"},
+	} {
+		if err := r.Add(p); err == nil {
+			t.Errorf("Add(%+v) succeeded", p)
+		}
+	}
+}
+
+func TestRegistryEach(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"p1", "p2", "p3", "p4", "p5"} {
+		if err := r.Add(Profile{Name: name, URL: "https://redcap.example.edu/api/", Token: testToken}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.SetConcurrency(2)
+
+	var running, peak atomic.Int32
+	boom := errors.New("boom")
+	err := r.Each(context.Background(), nil, func(ctx context.Context, name string, c *Client) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if name == "p2" || name == "p4" {
+			return boom
+		}
+		return nil
+	})
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d projects ran at once, want at most 2", p)
+	}
+
+	var perr ProjectErrors
+	if !errors.As(err, &perr) {
+		t.Fatalf("err = %v, want ProjectErrors", err)
+	}
+	if len(perr) != 2 || perr["p2"] != boom || perr["p4"] != boom {
+		t.Errorf("errors = %v", perr)
+	}
+	if want := "2 project(s) failed: p2: boom; p4: boom"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	if err := r.Each(context.Background(), []string{"p1"}, func(context.Context, string, *Client) error { return nil }); err != nil {
+		t.Errorf("Each with no failures = %v, want nil", err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"ok", "bad"} {
+		if err := r.Add(Profile{Name: name, URL: "https://redcap.example.edu/api/", Token: testToken}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, _ := r.Client("bad")
+
+	got, err := Collect(context.Background(), r, []string{"ok", "bad", "missing"}, func(ctx context.Context, client *Client) (int, error) {
+		if client == c {
+			return 0, errors.New("no access")
+		}
+		return 42, nil
+	})
+	if len(got) != 1 || got["ok"] != 42 {
+		t.Errorf("results = %v, want only ok", got)
+	}
+	var perr ProjectErrors
+	if !errors.As(err, &perr) || len(perr) != 2 || perr["bad"] == nil || perr["missing"] == nil {
+		t.Fatalf("err = %v, want failures for bad and missing", err)
+	}
+	if !strings.Contains(perr["missing"].Error(), "unknown project") {
+		t.Errorf("missing: %v", perr["missing"])
+	}
+}
+
+func TestRegistrySetConcurrencyDuringEach(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Add(Profile{Name: "p", URL: "https://redcap.example.edu/api/", Token: testToken}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			r.SetConcurrency(i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		r.Each(context.Background(), nil, func(context.Context, string, *Client) error { return nil })
+	}
+	<-done
+}
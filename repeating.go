@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 )
 
 // RepeatingForm represents a repeating form or event.
@@ -31,10 +32,44 @@ func (c *Client) ExportRepeatingFormsEvents(ctx context.Context) ([]RepeatingFor
 
 // FormEventMapping represents form-event mappings.
 type FormEventMapping struct {
+	// ArmNum is the arm of the event.
+	ArmNum          int    `json:"arm_num"`
 	FormName        string `json:"form_name"`
 	UniqueEventName string `json:"unique_event_name"`
 }
 
+// UnmarshalJSON decodes a mapping from REDCap's export, which names the
+// instrument form, or form_name in older clients' files.
+func (m *FormEventMapping) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ArmNum          jsonText `json:"arm_num"`
+		Form            jsonText `json:"form"`
+		FormName        jsonText `json:"form_name"`
+		UniqueEventName jsonText `json:"unique_event_name"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = FormEventMapping{
+		FormName:        string(raw.Form),
+		UniqueEventName: string(raw.UniqueEventName),
+	}
+	if m.FormName == "" {
+		m.FormName = string(raw.FormName)
+	}
+	m.ArmNum, _ = strconv.Atoi(string(raw.ArmNum))
+	return nil
+}
+
+// MarshalJSON encodes the mapping in REDCap's import shape.
+func (m FormEventMapping) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"arm_num":           m.ArmNum,
+		"unique_event_name": m.UniqueEventName,
+		"form":              m.FormName,
+	})
+}
+
 // ExportFormEventMapping returns form-event mappings.
 func (c *Client) ExportFormEventMapping(ctx context.Context) ([]FormEventMapping, error) {
 	body, err := c.Request(ctx, "formEventMapping", map[string]string{
@@ -51,3 +86,14 @@ func (c *Client) ExportFormEventMapping(ctx context.Context) ([]FormEventMapping
 
 	return mappings, nil
 }
+
+// ImportFormEventMapping designates instruments for events and returns
+// the number of mappings imported. Existing mappings left out may be
+// removed, so send the complete set.
+func (c *Client) ImportFormEventMapping(ctx context.Context, mappings []FormEventMapping) (int, error) {
+	data, err := json.Marshal(mappings)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling form-event mappings: %w", err)
+	}
+	return c.importJSON(ctx, "formEventMapping", data, map[string]string{"action": "import"})
+}
@@ -0,0 +1,26 @@
+package redcap
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestImportFormEventMappingSendsAction(t *testing.T) {
+	var got []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.FormValue("content")+":"+r.FormValue("action"))
+		w.Write([]byte("1"))
+	})
+	mappings := []FormEventMapping{{ArmNum: 1, FormName: "demo", UniqueEventName: "baseline_arm_1"}}
+	n, err := c.ImportFormEventMapping(context.Background(), mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("imported %d mappings, want 1", n)
+	}
+	if len(got) != 1 || got[0] != "formEventMapping:import" {
+		t.Errorf("requests = %v, want [formEventMapping:import]", got)
+	}
+}
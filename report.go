@@ -0,0 +1,112 @@
+package redcap
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ExportReport returns the rows of a report defined in the REDCap UI,
+// with the report's fields and filters applied. opts may set rawOrLabel
+// and exportCheckboxLabel; record, field and filter options do not apply
+// to reports.
+func (c *Client) ExportReport(ctx context.Context, reportID int, opts ...ExportOption) ([]Record, error) {
+	body, err := c.ExportReportRaw(ctx, reportID, append(opts, ExportFormat("json"))...)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]any
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("unmarshaling report: %w", err)
+	}
+
+	return recordsFromRows(rows), nil
+}
+
+// ExportReportRaw returns a report in the format set by ExportFormat
+// (REDCap's default is XML).
+func (c *Client) ExportReportRaw(ctx context.Context, reportID int, opts ...ExportOption) ([]byte, error) {
+	params := map[string]string{
+		"content":   "report",
+		"report_id": strconv.Itoa(reportID),
+	}
+
+	for _, opt := range opts {
+		opt(params)
+	}
+
+	return c.Request(ctx, "", params)
+}
+
+// ExportReportCSV returns a report's rows as text, keyed by column name.
+// The report is exported as CSV, so ExportRawOrLabelHeaders("label")
+// is allowed: label headers are mapped back to column names with
+// dict.HeaderColumns. dict may be nil when headers are raw.
+func (c *Client) ExportReportCSV(ctx context.Context, reportID int, dict *Dictionary, opts ...ExportOption) ([]map[string]string, error) {
+	body, err := c.ExportReportRaw(ctx, reportID, append(opts, ExportFormat("csv"))...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(bytes.NewReader(body))
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing report: %w", err)
+	}
+	if dict != nil {
+		header = dict.HeaderColumns(header)
+	}
+
+	var rows []map[string]string
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing report: %w", err)
+		}
+		row := make(map[string]string, len(header))
+		for i, col := range header {
+			row[col] = rec[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ExportReportTyped returns a report's rows keyed by column name, with
+// values converted by dict.TypedValue. A value that does not parse as its
+// column's type, such as text left in a number field, stays a string, as
+// in the Excel writer; the Parquet writer writes null and counts it in
+// Invalid instead. dict is required.
+func (c *Client) ExportReportTyped(ctx context.Context, reportID int, dict *Dictionary, opts ...ExportOption) ([]map[string]any, error) {
+	if dict == nil {
+		return nil, errors.New("typed report export needs a data dictionary")
+	}
+	rows, err := c.ExportReportCSV(ctx, reportID, dict, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		t := make(map[string]any, len(row))
+		for col, v := range row {
+			if t[col], err = dict.TypedValue(col, v); err != nil {
+				t[col] = v
+			}
+		}
+		typed[i] = t
+	}
+	return typed, nil
+}
@@ -0,0 +1,40 @@
+package redcap
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestExportReportTyped(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("content") != "report" || r.FormValue("format") != "csv" {
+			t.Errorf("content %q format %q", r.FormValue("content"), r.FormValue("format"))
+		}
+		w.Write([]byte("Record ID,Age years,Weight,Complete?\n1,41,70.5,2\n2,unknown,,0\n"))
+	})
+
+	rows, err := c.ExportReportTyped(context.Background(), 7, testDictionary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if rows[0]["age"] != int64(41) || rows[0]["weight"] != 70.5 || rows[0]["visit_complete"] != "2" {
+		t.Errorf("row 1 = %v", rows[0])
+	}
+	// A value that does not parse stays text rather than failing the report
+	if rows[1]["age"] != "unknown" || rows[1]["weight"] != nil {
+		t.Errorf("row 2 = %v", rows[1])
+	}
+}
+
+func TestExportReportTypedNeedsDictionary(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request sent without a dictionary")
+	})
+	if _, err := c.ExportReportTyped(context.Background(), 7, nil); err == nil {
+		t.Fatal("ExportReportTyped with a nil dictionary succeeded")
+	}
+}
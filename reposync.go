@@ -0,0 +1,471 @@
+package redcap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// RepositoryStateFile is the default name of the sync state file, kept in
+// the synced directory and never uploaded.
+const RepositoryStateFile = ".cap-repo.json"
+
+// RepositoryState records the repository file each local file was last
+// synced with. Repository files never change under the same doc ID, so a
+// matching doc ID and checksum means a file can be skipped without
+// downloading it.
+type RepositoryState struct {
+	// Files is keyed by slash-separated path relative to the directory.
+	Files map[string]RepositoryFileState `json:"files"`
+}
+
+// RepositoryFileState is the last synced version of one file.
+type RepositoryFileState struct {
+	DocID  int    `json:"doc_id"`
+	SHA256 string `json:"sha256"`
+}
+
+// LoadRepositoryState reads a state file. A missing file is an empty
+// state.
+func LoadRepositoryState(path string) (*RepositoryState, error) {
+	s := &RepositoryState{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("reading repository state: %w", err)
+	default:
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("parsing repository state %s: %w", path, err)
+		}
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]RepositoryFileState)
+	}
+	return s, nil
+}
+
+// Save writes the state file.
+func (s *RepositoryState) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling repository state: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("writing repository state: %w", err)
+	}
+	return nil
+}
+
+// SyncChange is one change made, or planned in a dry run, by a
+// RepositorySync.
+type SyncChange struct {
+	// Action is "upload", "download", "mkdir", "delete remote",
+	// "delete local" or "ignore" for a repository name that is not a
+	// safe local file name.
+	Action string `json:"action"`
+	Path   string `json:"path"`
+}
+
+// RepositorySyncReport lists the changes of a sync.
+type RepositorySyncReport struct {
+	Changes []SyncChange `json:"changes"`
+	// Unchanged is the number of files skipped because their checksums
+	// matched.
+	Unchanged int `json:"unchanged"`
+}
+
+// RepositorySync mirrors a local directory and a File Repository folder,
+// recursively, in either direction. Files are compared by SHA-256;
+// unchanged files are skipped, using the state file to avoid downloads.
+type RepositorySync struct {
+	Client *Client
+	// Dir is the local directory.
+	Dir string
+	// Folder is the repository folder ID; 0 is the top level.
+	Folder int
+	// StatePath is the state file; empty means RepositoryStateFile in
+	// Dir.
+	StatePath string
+	// Delete removes files missing from the source side, including the
+	// files of folders missing from it. The API cannot delete repository
+	// folders, so on push they are emptied and left in place.
+	Delete bool
+	// DryRun reports the changes without making them.
+	DryRun bool
+
+	state  *RepositoryState
+	report *RepositorySyncReport
+}
+
+func (s *RepositorySync) statePath() string {
+	if s.StatePath != "" {
+		return s.StatePath
+	}
+	return filepath.Join(s.Dir, RepositoryStateFile)
+}
+
+// run loads the state, calls fn and saves the state, also after an
+// error, so that files already synced are skipped next time.
+func (s *RepositorySync) run(fn func() error) (*RepositorySyncReport, error) {
+	state, err := LoadRepositoryState(s.statePath())
+	if err != nil {
+		return nil, err
+	}
+	s.state = state
+	s.report = &RepositorySyncReport{Changes: []SyncChange{}}
+
+	err = fn()
+	if !s.DryRun {
+		if serr := s.state.Save(s.statePath()); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return s.report, err
+}
+
+func (s *RepositorySync) change(action, p string) {
+	s.report.Changes = append(s.report.Changes, SyncChange{Action: action, Path: p})
+}
+
+// Push uploads new and changed local files to the repository, replacing
+// older versions.
+func (s *RepositorySync) Push(ctx context.Context) (*RepositorySyncReport, error) {
+	return s.run(func() error {
+		return s.push(ctx, s.Folder, "")
+	})
+}
+
+// Pull downloads new and changed repository files into the directory.
+func (s *RepositorySync) Pull(ctx context.Context) (*RepositorySyncReport, error) {
+	return s.run(func() error {
+		if !s.DryRun {
+			if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+				return err
+			}
+		}
+		return s.pull(ctx, s.Folder, "")
+	})
+}
+
+// repoFolder indexes a repository listing by name. Files of the same
+// name are kept newest (highest doc ID) first.
+type repoFolder struct {
+	folders map[string]int
+	files   map[string][]int
+}
+
+func (c *Client) listRepoFolder(ctx context.Context, folder int) (*repoFolder, error) {
+	f := &repoFolder{folders: make(map[string]int), files: make(map[string][]int)}
+	// Folders planned in a dry run do not exist yet
+	if folder < 0 {
+		return f, nil
+	}
+	items, err := c.ListRepository(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range items {
+		if it.IsFolder() {
+			f.folders[it.Name] = it.FolderID
+		} else {
+			f.files[it.Name] = append(f.files[it.Name], it.DocID)
+		}
+	}
+	for _, docs := range f.files {
+		sort.Sort(sort.Reverse(sort.IntSlice(docs)))
+	}
+	return f, nil
+}
+
+func (s *RepositorySync) push(ctx context.Context, folder int, rel string) error {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+	remote, err := s.Client.listRepoFolder(ctx, folder)
+	if err != nil {
+		return fmt.Errorf("listing %s: %w", displayPath(rel), err)
+	}
+
+	local := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		p := path.Join(rel, name)
+		if rel == "" && s.StatePath == "" && name == RepositoryStateFile {
+			continue
+		}
+		if e.IsDir() {
+			local[name+"/"] = true
+			id, ok := remote.folders[name]
+			if !ok {
+				s.change("mkdir", p+"/")
+				id = -1
+				if !s.DryRun {
+					if id, err = s.Client.CreateRepositoryFolder(ctx, name, folder); err != nil {
+						return fmt.Errorf("creating folder %s: %w", p, err)
+					}
+				}
+			}
+			if err := s.push(ctx, id, p); err != nil {
+				return err
+			}
+			continue
+		}
+		if !e.Type().IsRegular() {
+			continue
+		}
+		local[name] = true
+		if err := s.pushFile(ctx, folder, p, remote.files[name]); err != nil {
+			return err
+		}
+	}
+
+	if !s.Delete {
+		return nil
+	}
+	return s.deleteRemote(ctx, rel, remote, local)
+}
+
+// deleteRemote deletes the files of a listed repository folder whose
+// names are not in keep, and empties its subfolders not in keep, named
+// with a trailing slash. An empty keep empties the folder.
+func (s *RepositorySync) deleteRemote(ctx context.Context, rel string, remote *repoFolder, keep map[string]bool) error {
+	names := make([]string, 0, len(remote.folders))
+	for name := range remote.folders {
+		if !keep[name+"/"] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := path.Join(rel, name)
+		sub, err := s.Client.listRepoFolder(ctx, remote.folders[name])
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", p, err)
+		}
+		if err := s.deleteRemote(ctx, p, sub, nil); err != nil {
+			return err
+		}
+	}
+
+	names = names[:0]
+	for name := range remote.files {
+		if !keep[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := path.Join(rel, name)
+		s.change("delete remote", p)
+		if s.DryRun {
+			continue
+		}
+		for _, doc := range remote.files[name] {
+			if err := s.Client.DeleteRepositoryFile(ctx, doc); err != nil {
+				return fmt.Errorf("deleting %s: %w", p, err)
+			}
+		}
+		delete(s.state.Files, p)
+	}
+	return nil
+}
+
+// pushFile uploads one file unless the newest repository file of the
+// same name has the same checksum. Older versions are deleted after an
+// upload.
+func (s *RepositorySync) pushFile(ctx context.Context, folder int, p string, docs []int) error {
+	data, err := os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(p)))
+	if err != nil {
+		return err
+	}
+	sum := checksum(data)
+
+	if len(docs) > 0 {
+		st, ok := s.state.Files[p]
+		if ok && st.DocID == docs[0] && st.SHA256 == sum {
+			s.report.Unchanged++
+			return nil
+		}
+		_, remote, err := s.Client.ExportRepositoryFile(ctx, docs[0])
+		if err != nil {
+			return fmt.Errorf("downloading %s: %w", p, err)
+		}
+		if checksum(remote) == sum {
+			s.state.Files[p] = RepositoryFileState{DocID: docs[0], SHA256: sum}
+			s.report.Unchanged++
+			return nil
+		}
+	}
+
+	s.change("upload", p)
+	if s.DryRun {
+		return nil
+	}
+	name := path.Base(p)
+	if err := s.Client.ImportRepositoryFile(ctx, folder, name, data); err != nil {
+		return fmt.Errorf("uploading %s: %w", p, err)
+	}
+	for _, doc := range docs {
+		if err := s.Client.DeleteRepositoryFile(ctx, doc); err != nil {
+			return fmt.Errorf("replacing %s: %w", p, err)
+		}
+	}
+
+	// The import does not return the new doc ID
+	after, err := s.Client.listRepoFolder(ctx, folder)
+	if err != nil {
+		return fmt.Errorf("listing after uploading %s: %w", p, err)
+	}
+	if ids := after.files[name]; len(ids) > 0 {
+		s.state.Files[p] = RepositoryFileState{DocID: ids[0], SHA256: sum}
+	}
+	return nil
+}
+
+func (s *RepositorySync) pull(ctx context.Context, folder int, rel string) error {
+	remote, err := s.Client.listRepoFolder(ctx, folder)
+	if err != nil {
+		return fmt.Errorf("listing %s: %w", displayPath(rel), err)
+	}
+	dir := filepath.Join(s.Dir, filepath.FromSlash(rel))
+
+	keep := make(map[string]bool)
+	names := make([]string, 0, len(remote.folders))
+	for name := range remote.folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := path.Join(rel, name)
+		if !safeName(name) {
+			s.change("ignore", p+"/")
+			continue
+		}
+		keep[name] = true
+		if _, err := os.Stat(filepath.Join(dir, name)); errors.Is(err, os.ErrNotExist) {
+			s.change("mkdir", p+"/")
+			if !s.DryRun {
+				if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+					return err
+				}
+			}
+		}
+		if err := s.pull(ctx, remote.folders[name], p); err != nil {
+			return err
+		}
+	}
+
+	names = names[:0]
+	for name := range remote.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := path.Join(rel, name)
+		if !safeName(name) {
+			s.change("ignore", p)
+			continue
+		}
+		keep[name] = true
+		if err := s.pullFile(ctx, p, remote.files[name][0]); err != nil {
+			return err
+		}
+	}
+
+	if !s.Delete {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) && s.DryRun {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if keep[name] || (rel == "" && s.StatePath == "" && name == RepositoryStateFile) {
+			continue
+		}
+		p := path.Join(rel, name)
+		if e.IsDir() {
+			p += "/"
+		}
+		s.change("delete local", p)
+		if s.DryRun {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		for f := range s.state.Files {
+			if f == p || (e.IsDir() && len(f) > len(p) && f[:len(p)] == p) {
+				delete(s.state.Files, f)
+			}
+		}
+	}
+	return nil
+}
+
+// pullFile downloads one file unless the local copy matches it.
+func (s *RepositorySync) pullFile(ctx context.Context, p string, doc int) error {
+	local := filepath.Join(s.Dir, filepath.FromSlash(p))
+	localSum := ""
+	if data, err := os.ReadFile(local); err == nil {
+		localSum = checksum(data)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if st, ok := s.state.Files[p]; ok && st.DocID == doc && st.SHA256 == localSum {
+		s.report.Unchanged++
+		return nil
+	}
+	_, data, err := s.Client.ExportRepositoryFile(ctx, doc)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", p, err)
+	}
+	sum := checksum(data)
+	if sum == localSum {
+		s.report.Unchanged++
+	} else {
+		s.change("download", p)
+		if s.DryRun {
+			return nil
+		}
+		if err := writeFileAtomic(local, data); err != nil {
+			return fmt.Errorf("writing %s: %w", p, err)
+		}
+	}
+	if !s.DryRun {
+		s.state.Files[p] = RepositoryFileState{DocID: doc, SHA256: sum}
+	}
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// safeName reports whether a repository name can be used as one local
+// path element.
+func safeName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name && path.Base(name) == name
+}
+
+func displayPath(rel string) string {
+	if rel == "" {
+		return "repository"
+	}
+	return rel
+}
@@ -0,0 +1,243 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeRepo is an in-memory File Repository.
+type fakeRepo struct {
+	mu      sync.Mutex
+	next    int
+	folders map[int]fakeRepoItem
+	docs    map[int]fakeRepoItem
+	exports int
+}
+
+type fakeRepoItem struct {
+	parent int
+	name   string
+	data   []byte
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{next: 100, folders: make(map[int]fakeRepoItem), docs: make(map[int]fakeRepoItem)}
+}
+
+func (f *fakeRepo) mkdir(parent int, name string) int {
+	f.next++
+	f.folders[f.next] = fakeRepoItem{parent: parent, name: name}
+	return f.next
+}
+
+func (f *fakeRepo) put(folder int, name, data string) int {
+	f.next++
+	f.docs[f.next] = fakeRepoItem{parent: folder, name: name, data: []byte(data)}
+	return f.next
+}
+
+// files lists the repository files by path.
+func (f *fakeRepo) files() map[string]string {
+	dir := func(id int) string {
+		var p string
+		for id != 0 {
+			p = f.folders[id].name + "/" + p
+			id = f.folders[id].parent
+		}
+		return p
+	}
+	out := make(map[string]string)
+	for _, d := range f.docs {
+		out[dir(d.parent)+d.name] = string(d.data)
+	}
+	return out
+}
+
+func (f *fakeRepo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	folder, _ := strconv.Atoi(r.FormValue("folder_id"))
+	doc, _ := strconv.Atoi(r.FormValue("doc_id"))
+
+	switch r.FormValue("action") {
+	case "list":
+		items := []map[string]any{}
+		for id, it := range f.folders {
+			if it.parent == folder {
+				items = append(items, map[string]any{"folder_id": id, "name": it.name})
+			}
+		}
+		for id, it := range f.docs {
+			if it.parent == folder {
+				items = append(items, map[string]any{"doc_id": strconv.Itoa(id), "name": it.name})
+			}
+		}
+		json.NewEncoder(w).Encode(items)
+	case "createFolder":
+		json.NewEncoder(w).Encode([]map[string]any{{"folder_id": f.mkdir(folder, r.FormValue("name"))}})
+	case "export":
+		it, ok := f.docs[doc]
+		if !ok {
+			http.Error(w, `{"error":"no such file"}`, http.StatusBadRequest)
+			return
+		}
+		f.exports++
+		w.Header().Set("Content-Type", fmt.Sprintf("application/octet-stream; name=%q", it.name))
+		w.Write(it.data)
+	case "import":
+		file, hdr, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, `{"error":"no file"}`, http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		f.put(folder, hdr.Filename, string(data))
+	case "delete":
+		delete(f.docs, doc)
+	default:
+		http.Error(w, `{"error":"unsupported request"}`, http.StatusBadRequest)
+	}
+}
+
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for p, data := range files {
+		full := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func changes(r *RepositorySyncReport) []string {
+	var out []string
+	for _, c := range r.Changes {
+		out = append(out, c.Action+" "+c.Path)
+	}
+	return out
+}
+
+func TestRepositorySyncPush(t *testing.T) {
+	repo := newFakeRepo()
+	c := newTestClient(t, repo.ServeHTTP)
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "a", "sops/b.txt": "b"})
+	s := &RepositorySync{Client: c, Dir: dir}
+
+	report, err := s.Push(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"upload a.txt", "mkdir sops/", "upload sops/b.txt"}
+	if got := changes(report); !slices.Equal(got, want) {
+		t.Errorf("first push = %v, want %v", got, want)
+	}
+	if got := repo.files(); len(got) != 2 || got["sops/b.txt"] != "b" {
+		t.Errorf("repository = %v", got)
+	}
+
+	// The state file saves downloading unchanged files to compare them
+	repo.exports = 0
+	report, err = s.Push(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 0 || report.Unchanged != 2 || repo.exports != 0 {
+		t.Errorf("second push: changes %v, unchanged %d, exports %d", changes(report), report.Unchanged, repo.exports)
+	}
+
+	// A changed file replaces the older copy
+	writeTree(t, dir, map[string]string{"a.txt": "a2"})
+	if _, err := s.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.files(); got["a.txt"] != "a2" || len(repo.docs) != 2 {
+		t.Errorf("after change: %v, %d docs", got, len(repo.docs))
+	}
+}
+
+func TestRepositorySyncPushDelete(t *testing.T) {
+	repo := newFakeRepo()
+	repo.put(0, "keep.txt", "k")
+	repo.put(0, "stale.txt", "s")
+	old := repo.mkdir(0, "old")
+	repo.put(old, "b.txt", "b")
+	repo.put(repo.mkdir(old, "deep"), "c.txt", "c")
+	c := newTestClient(t, repo.ServeHTTP)
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"keep.txt": "k"})
+
+	s := &RepositorySync{Client: c, Dir: dir, Delete: true, DryRun: true}
+	report, err := s.Push(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"delete remote old/deep/c.txt", "delete remote old/b.txt", "delete remote stale.txt"}
+	if got := changes(report); !slices.Equal(got, want) {
+		t.Errorf("dry run = %v, want %v", got, want)
+	}
+	if len(repo.docs) != 4 {
+		t.Fatalf("dry run deleted files: %v", repo.files())
+	}
+
+	s.DryRun = false
+	if _, err := s.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.files(); len(got) != 1 || got["keep.txt"] != "k" {
+		t.Errorf("repository = %v, want only keep.txt", got)
+	}
+	if len(repo.folders) != 2 {
+		t.Errorf("folders = %v, want old and old/deep left in place", repo.folders)
+	}
+}
+
+func TestRepositorySyncPull(t *testing.T) {
+	repo := newFakeRepo()
+	repo.put(0, "a.txt", "a")
+	repo.put(0, "..", "unsafe")
+	repo.put(repo.mkdir(0, "sops"), "b.txt", "b")
+	c := newTestClient(t, repo.ServeHTTP)
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"extra.txt": "x", "gone/d.txt": "d"})
+
+	s := &RepositorySync{Client: c, Dir: dir, Delete: true}
+	report, err := s.Pull(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"mkdir sops/", "download sops/b.txt", "ignore ..", "download a.txt",
+		"delete local extra.txt", "delete local gone/",
+	}
+	if got := changes(report); !slices.Equal(got, want) {
+		t.Errorf("pull = %v, want %v", got, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "sops", "b.txt")); err != nil || string(data) != "b" {
+		t.Errorf("sops/b.txt = %q, %v", data, err)
+	}
+	for _, p := range []string{"extra.txt", "gone"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); !os.IsNotExist(err) {
+			t.Errorf("%s was not deleted", p)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, RepositoryStateFile)); err != nil {
+		t.Errorf("state file: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package redcap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMaxResponseSize caps how much of a response body is read.
+	DefaultMaxResponseSize = 256 << 20
+	// previewSize is how much of an unexpected body an error keeps.
+	previewSize = 512
+)
+
+var (
+	ErrResponseTooLarge  = errors.New("redcap: response exceeds size limit")
+	ErrUnexpectedContent = errors.New("redcap: unexpected response content")
+)
+
+// ResponseError is returned when a response body is too large, or is an
+// HTML page where REDCap JSON was expected (a login, maintenance or proxy
+// error page, or the wrong URL). It is not retried.
+type ResponseError struct {
+	Kind        error // ErrResponseTooLarge or ErrUnexpectedContent
+	StatusCode  int
+	ContentType string
+	Limit       int64  // the size limit in effect, for ErrResponseTooLarge
+	Title       string // the HTML <title>, if any
+	Preview     string // the start of the body
+}
+
+func (e *ResponseError) Error() string {
+	switch {
+	case e.Kind == ErrResponseTooLarge:
+		return fmt.Sprintf("redcap: response exceeds %d bytes (%d): %s", e.Limit, e.StatusCode, e.Preview)
+	case e.Title != "":
+		return fmt.Sprintf("redcap: expected JSON, got HTML page %q (%d)", e.Title, e.StatusCode)
+	}
+	return fmt.Sprintf("redcap: expected JSON, got %s (%d): %s", e.ContentType, e.StatusCode, e.Preview)
+}
+
+func (e *ResponseError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// WithMaxResponseSize caps the size of every response body the client
+// reads. A value of zero or less removes the cap.
+func WithMaxResponseSize(n int64) Option {
+	return func(c *Client) error {
+		c.maxResponseSize = n
+		return nil
+	}
+}
+
+type maxResponseSizeKey struct{}
+
+// ContextWithMaxResponseSize overrides the client's response size limit
+// for calls made with the returned context.
+func ContextWithMaxResponseSize(ctx context.Context, n int64) context.Context {
+	return context.WithValue(ctx, maxResponseSizeKey{}, n)
+}
+
+func (c *Client) responseLimit(ctx context.Context) int64 {
+	if n, ok := ctx.Value(maxResponseSizeKey{}).(int64); ok {
+		return n
+	}
+	return c.maxResponseSize
+}
+
+// readBody reads the response body, refusing to buffer more than limit
+// bytes.
+func readBody(resp *http.Response, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, &ResponseError{
+			Kind:        ErrResponseTooLarge,
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Limit:       limit,
+			Preview:     preview(body),
+		}
+	}
+	return body, nil
+}
+
+// expectsJSON reports whether the request asked REDCap for JSON. File
+// exports are binary whatever the format parameter says.
+func expectsJSON(content string, params map[string]string) bool {
+	if content == "" {
+		content = params["content"]
+	}
+	return content != "file" && params["format"] == "json"
+}
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// checkHTML returns a ResponseError if body is an HTML page.
+func checkHTML(resp *http.Response, body []byte) error {
+	ct := resp.Header.Get("Content-Type")
+	head := bytes.ToLower(bytes.TrimSpace(body[:min(len(body), 256)]))
+	isHTML := bytes.HasPrefix(head, []byte("<!doctype html")) ||
+		bytes.HasPrefix(head, []byte("<html")) ||
+		(strings.HasPrefix(ct, "text/html") && bytes.HasPrefix(head, []byte("<")))
+	if !isHTML {
+		return nil
+	}
+
+	e := &ResponseError{
+		Kind:        ErrUnexpectedContent,
+		StatusCode:  resp.StatusCode,
+		ContentType: ct,
+		Preview:     preview(body),
+	}
+	if m := titleRe.FindSubmatch(body); m != nil {
+		e.Title = strings.Join(strings.Fields(string(m[1])), " ")
+	}
+	return e
+}
+
+// preview returns the start of body, cut on a rune boundary.
+func preview(body []byte) string {
+	if len(body) <= previewSize {
+		return string(body)
+	}
+	cut := previewSize
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return string(body[:cut]) + "..."
+}
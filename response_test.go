@@ -0,0 +1,116 @@
+package redcap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestResponseTooLarge(t *testing.T) {
+	body := `[{"record_id":"1","notes":"` + strings.Repeat("x", 100) + `"}]`
+	var calls atomic.Int32
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+	params := map[string]string{"content": "record", "format": "json"}
+
+	c := newTestClient(t, h, WithMaxResponseSize(64))
+	got, err := c.Request(context.Background(), "", params)
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("err = %v, want ErrResponseTooLarge", err)
+	}
+	if got != nil {
+		t.Errorf("returned %d bytes of a truncated body", len(got))
+	}
+	if respErr.Limit != 64 || respErr.StatusCode != http.StatusOK {
+		t.Errorf("limit %d, status %d", respErr.Limit, respErr.StatusCode)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d requests, want 1: too-large responses are not retried", n)
+	}
+
+	// A body exactly at the limit is read whole
+	c = newTestClient(t, h, WithMaxResponseSize(int64(len(body))))
+	if got, err := c.Request(context.Background(), "", params); err != nil || string(got) != body {
+		t.Errorf("at the limit: %q, %v", got, err)
+	}
+}
+
+func TestContextWithMaxResponseSize(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}, WithMaxResponseSize(10))
+	params := map[string]string{"content": "version"}
+
+	if _, err := c.Request(context.Background(), "", params); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("client limit: err = %v", err)
+	}
+	ctx := ContextWithMaxResponseSize(context.Background(), 1000)
+	if got, err := c.Request(ctx, "", params); err != nil || len(got) != 100 {
+		t.Errorf("raised limit: %d bytes, %v", len(got), err)
+	}
+	ctx = ContextWithMaxResponseSize(context.Background(), 0)
+	if _, err := c.Request(ctx, "", params); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+	ctx = ContextWithMaxResponseSize(context.Background(), 50)
+	if _, err := c.Request(ctx, "", params); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("lowered limit: err = %v", err)
+	}
+}
+
+func TestHTMLPageOnJSONRequest(t *testing.T) {
+	login := `<!DOCTYPE html>
+<html><head><title>
+  REDCap | Log In
+</title></head><body><form>...</form></body></html>`
+
+	tests := []struct {
+		name    string
+		ct      string
+		body    string
+		status  int
+		params  map[string]string
+		wantErr bool
+	}{
+		{"login page", "text/html; charset=UTF-8", login, http.StatusOK, map[string]string{"content": "record", "format": "json"}, true},
+		{"html without doctype", "text/plain", "<html><body>Maintenance</body></html>", http.StatusOK, map[string]string{"content": "project", "format": "json"}, true},
+		{"proxy error", "text/html", "<h1>Bad Gateway</h1>", http.StatusBadGateway, map[string]string{"content": "record", "format": "json"}, true},
+		{"json", "application/json", `[{"record_id":"1"}]`, http.StatusOK, map[string]string{"content": "record", "format": "json"}, false},
+		{"csv export", "text/html", login, http.StatusOK, map[string]string{"content": "record", "format": "csv"}, false},
+		{"file export", "text/html", login, http.StatusOK, map[string]string{"content": "file", "format": "json"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.ct)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}, WithMaxRetries(0))
+			_, err := c.Request(context.Background(), "", tt.params)
+			if got := errors.Is(err, ErrUnexpectedContent); got != tt.wantErr {
+				t.Fatalf("err = %v, want ErrUnexpectedContent %v", err, tt.wantErr)
+			}
+			if tt.name == "login page" {
+				var respErr *ResponseError
+				if !errors.As(err, &respErr) || respErr.Title != "REDCap | Log In" {
+					t.Errorf("err = %#v, want the page title", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPreviewCutsOnRune(t *testing.T) {
+	body := []byte(strings.Repeat("a", previewSize-1) + "é and more")
+	got := preview(body)
+	if got != strings.Repeat("a", previewSize-1)+"..." {
+		t.Errorf("preview ends %q", got[len(got)-8:])
+	}
+}
@@ -0,0 +1,226 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RetryRequest describes a failed attempt handed to a RetryPolicy.
+type RetryRequest struct {
+	Content string            // API content, e.g. "record" or "file"
+	Action  string            // API action; "export" when none was sent
+	Params  map[string]string // request parameters, excluding the token
+	Attempt int               // the attempt that just failed, starting at 1
+	Err     error             // the error from that attempt
+	// BodySent reports whether the request body was fully written to the
+	// server. If false, the server cannot have acted on the request.
+	BodySent bool
+}
+
+// RetryPolicy decides whether a failed request may be retried.
+type RetryPolicy interface {
+	ShouldRetry(ctx context.Context, req *RetryRequest) bool
+}
+
+// RetryPolicyFunc adapts a function to the RetryPolicy interface.
+type RetryPolicyFunc func(ctx context.Context, req *RetryRequest) bool
+
+// ShouldRetry implements RetryPolicy.
+func (f RetryPolicyFunc) ShouldRetry(ctx context.Context, req *RetryRequest) bool {
+	return f(ctx, req)
+}
+
+// WithRetryPolicy sets the policy consulted before each retry.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) error {
+		c.retryPolicy = p
+		return nil
+	}
+}
+
+// IsTransient reports whether err is worth retrying at all: rate limits,
+// server errors and network failures are; REDCap rejections, unexpected
+// responses and context cancellation are not.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var redcapErr *Error
+	if errors.As(err, &redcapErr) {
+		return redcapErr.IsRetryable()
+	}
+	var respErr *ResponseError
+	return !errors.As(err, &respErr)
+}
+
+// DefaultRetryPolicy retries transient errors, except where repeating a
+// request that already reached the server could change data twice:
+// auto-numbered record imports (a retry creates duplicate records) and
+// deletes. Those are only retried when the body was never sent, or when
+// the server answered 429 and so did not process the request.
+type DefaultRetryPolicy struct{}
+
+// ShouldRetry implements RetryPolicy.
+func (DefaultRetryPolicy) ShouldRetry(ctx context.Context, req *RetryRequest) bool {
+	if !IsTransient(req.Err) {
+		return false
+	}
+	if !req.BodySent || isRateLimited(req.Err) {
+		return true
+	}
+	return IsIdempotent(req)
+}
+
+// IsIdempotent reports whether repeating the request is harmless.
+func IsIdempotent(req *RetryRequest) bool {
+	switch req.Action {
+	case "delete", "createFolder":
+		return false
+	case "import":
+		switch req.Content {
+		case "record":
+			b, _ := strconv.ParseBool(req.Params["forceAutoNumber"])
+			return !b
+		// Repository files of the same name are kept side by side
+		case "fileRepository":
+			return false
+		// Groups, roles and events without a unique name are created anew
+		case "event":
+			return req.Params["override"] == "1" || !createsNamed(req.Params["data"], "unique_event_name")
+		case "dag":
+			return !createsNamed(req.Params["data"], "unique_group_name")
+		case "userRole":
+			return !createsNamed(req.Params["data"], "unique_role_name")
+		}
+	}
+	return true
+}
+
+// createsNamed reports whether a JSON import payload has an entry with an
+// empty or missing key, which REDCap treats as a new item.
+func createsNamed(data, key string) bool {
+	var rows []map[string]any
+	if err := json.Unmarshal([]byte(data), &rows); err != nil {
+		return true
+	}
+	for _, row := range rows {
+		if v, _ := row[key].(string); v == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isRateLimited(err error) bool {
+	var redcapErr *Error
+	return errors.As(err, &redcapErr) && redcapErr.Code == ErrCodeRateLimit
+}
+
+// VerifyFunc inspects the server state after a failed non-idempotent
+// request and reports whether it is safe to send it again.
+type VerifyFunc func(ctx context.Context, req *RetryRequest) (bool, error)
+
+// VerifyBeforeRetry wraps a policy so that requests it declines only
+// because they are not idempotent are retried when verify confirms the
+// first attempt did not take effect. A verify error declines the retry.
+func VerifyBeforeRetry(p RetryPolicy, verify VerifyFunc) RetryPolicy {
+	return RetryPolicyFunc(func(ctx context.Context, req *RetryRequest) bool {
+		if p.ShouldRetry(ctx, req) {
+			return true
+		}
+		if !IsTransient(req.Err) || IsIdempotent(req) {
+			return false
+		}
+		ok, err := verify(ctx, req)
+		return err == nil && ok
+	})
+}
+
+// VerifyRecordsAbsent returns a VerifyFunc for record imports and deletes.
+// An import is retried only if none of its records exist yet; a delete
+// only if at least one of its records still exists. Auto-numbered imports
+// carry no usable record names and are never retried. Record names are
+// read from the project's record ID field, looked up in the data
+// dictionary.
+func VerifyRecordsAbsent(c *Client) VerifyFunc {
+	return func(ctx context.Context, req *RetryRequest) (bool, error) {
+		if req.Content != "record" || req.Action != "import" && req.Action != "delete" {
+			return false, nil
+		}
+		if b, _ := strconv.ParseBool(req.Params["forceAutoNumber"]); b && req.Action == "import" {
+			return false, nil
+		}
+
+		fields, err := c.ExportMetadata(ctx)
+		if err != nil {
+			return false, err
+		}
+		idField := NewDictionary(fields).RecordIDField
+		if idField == "" {
+			return false, nil
+		}
+
+		var ids []string
+		if req.Action == "import" {
+			ids = importedRecordIDs(req.Params["data"], idField)
+		} else {
+			ids = deletedRecordIDs(req.Params)
+		}
+		if len(ids) == 0 {
+			return false, nil
+		}
+
+		existing, err := c.ExportRecords(ctx,
+			ExportRecordsFilter(ids),
+			ExportFields([]string{idField}),
+		)
+		if err != nil {
+			return false, err
+		}
+
+		if req.Action == "import" {
+			return len(existing) == 0, nil
+		}
+		return len(existing) > 0, nil
+	}
+}
+
+// importedRecordIDs extracts record names from a flat JSON import payload.
+func importedRecordIDs(data, idField string) []string {
+	var rows []map[string]any
+	if err := json.Unmarshal([]byte(data), &rows); err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, row := range rows {
+		v, ok := row[idField]
+		if !ok {
+			continue
+		}
+		id := strings.TrimSpace(fmt.Sprintf("%v", v))
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// deletedRecordIDs collects the records[n] parameters of a delete request.
+func deletedRecordIDs(params map[string]string) []string {
+	var ids []string
+	for k, v := range params {
+		if strings.HasPrefix(k, "records[") && v != "" {
+			ids = append(ids, v)
+		}
+	}
+	if v := params["records"]; v != "" {
+		ids = append(ids, strings.Split(v, ",")...)
+	}
+	return ids
+}
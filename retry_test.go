@@ -0,0 +1,201 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		params  map[string]string
+		want    bool
+	}{
+		{"export", "record", nil, true},
+		{"record import", "record", map[string]string{"action": "import", "data": `[{"record_id":"1"}]`}, true},
+		{"auto-numbered import", "record", map[string]string{"action": "import", "forceAutoNumber": "true"}, false},
+		{"record delete", "record", map[string]string{"action": "delete"}, false},
+		{"file delete", "file", map[string]string{"action": "delete"}, false},
+		{"metadata import", "metadata", map[string]string{"action": "import"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRetryRequest(tt.content, tt.params, 1, errors.New("boom"), true)
+			if got := IsIdempotent(req); got != tt.want {
+				t.Errorf("IsIdempotent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	serverErr := &Error{Code: ErrCodeServerError, StatusCode: 500}
+	rateErr := &Error{Code: ErrCodeRateLimit, StatusCode: 429}
+	invalid := &Error{Code: ErrCodeInvalidRequest, StatusCode: 400}
+	autoNumber := map[string]string{"action": "import", "forceAutoNumber": "1"}
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		err    error
+		sent   bool
+		want   bool
+	}{
+		{"transient export", nil, serverErr, true, true},
+		{"rejected request", nil, invalid, true, false},
+		{"canceled", nil, context.Canceled, false, false},
+		{"auto-number after body sent", autoNumber, serverErr, true, false},
+		{"auto-number before body sent", autoNumber, errors.New("dial tcp: refused"), false, true},
+		{"auto-number rate limited", autoNumber, rateErr, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRetryRequest("record", tt.params, 1, tt.err, tt.sent)
+			if got := (DefaultRetryPolicy{}).ShouldRetry(context.Background(), req); got != tt.want {
+				t.Errorf("ShouldRetry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportRecordsAutoNumberNotRetried(t *testing.T) {
+	for _, auto := range []bool{false, true} {
+		var calls atomic.Int32
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.FormValue("action") != "import" {
+				t.Errorf("action = %q, want import", r.FormValue("action"))
+			}
+			calls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+
+		_, err := c.ImportRecords(context.Background(), []Record{{ID: "1"}}, ImportForceAutoNumber(auto))
+		if err == nil {
+			t.Fatal("import against a failing server succeeded")
+		}
+		want := int32(DefaultMaxRetries + 1)
+		if auto {
+			want = 1
+		}
+		if n := calls.Load(); n != want {
+			t.Errorf("forceAutoNumber=%v: %d attempts, want %d", auto, n, want)
+		}
+	}
+}
+
+func TestVerifyBeforeRetry(t *testing.T) {
+	autoNumber := newRetryRequest("record", map[string]string{"action": "import", "forceAutoNumber": "1"}, 1, &Error{Code: ErrCodeServerError}, true)
+	var verified int
+	p := VerifyBeforeRetry(DefaultRetryPolicy{}, func(ctx context.Context, req *RetryRequest) (bool, error) {
+		verified++
+		return true, nil
+	})
+	if !p.ShouldRetry(context.Background(), autoNumber) || verified != 1 {
+		t.Errorf("verified retry not allowed (verify called %d times)", verified)
+	}
+
+	export := newRetryRequest("record", nil, 1, &Error{Code: ErrCodeServerError}, true)
+	if !p.ShouldRetry(context.Background(), export) || verified != 1 {
+		t.Error("idempotent request should retry without verifying")
+	}
+}
+
+func TestCreatesNamed(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{`[{"data_access_group_name":"North","unique_group_name":"north"}]`, false},
+		{`[{"data_access_group_name":"North","unique_group_name":"north"},{"data_access_group_name":"South","unique_group_name":""}]`, true},
+		{`[{"data_access_group_name":"South"}]`, true},
+		{`[{"data_access_group_name":"South","unique_group_name":null}]`, true},
+		{`[]`, false},
+		{`not json`, true},
+	}
+	for _, tt := range tests {
+		if got := createsNamed(tt.data, "unique_group_name"); got != tt.want {
+			t.Errorf("createsNamed(%s) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestIsIdempotentNamedImports(t *testing.T) {
+	named := func(key, name string) string {
+		return `[{"` + key + `":"` + name + `"}]`
+	}
+	tests := []struct {
+		name    string
+		content string
+		params  map[string]string
+		want    bool
+	}{
+		{"DAG update", "dag", map[string]string{"action": "import", "data": named("unique_group_name", "north")}, true},
+		{"DAG create", "dag", map[string]string{"action": "import", "data": named("unique_group_name", "")}, false},
+		{"role update", "userRole", map[string]string{"action": "import", "data": named("unique_role_name", "U-1")}, true},
+		{"role create", "userRole", map[string]string{"action": "import", "data": named("unique_role_name", "")}, false},
+		{"event create", "event", map[string]string{"action": "import", "data": named("unique_event_name", "")}, false},
+		{"event override", "event", map[string]string{"action": "import", "override": "1", "data": named("unique_event_name", "")}, true},
+		{"repository upload", "fileRepository", map[string]string{"action": "import"}, false},
+		{"repository folder", "fileRepository", map[string]string{"action": "createFolder"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRetryRequest(tt.content, tt.params, 1, errors.New("boom"), true)
+			if got := IsIdempotent(req); got != tt.want {
+				t.Errorf("IsIdempotent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRecordsAbsentUsesRecordIDField(t *testing.T) {
+	existing := map[string]bool{"S-2": true}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("content") {
+		case "metadata":
+			w.Write([]byte(`[{"field_name":"study_id","form_name":"demo","field_type":"text"}]`))
+		case "record":
+			if got := r.FormValue("fields"); got != "study_id" {
+				t.Errorf("fields = %q, want study_id", got)
+			}
+			rows := []map[string]string{}
+			for _, id := range strings.Split(r.FormValue("records"), ",") {
+				if existing[id] {
+					rows = append(rows, map[string]string{"study_id": id})
+				}
+			}
+			json.NewEncoder(w).Encode(rows)
+		}
+	})
+	verify := VerifyRecordsAbsent(c)
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   bool
+	}{
+		{"new record", map[string]string{"action": "import", "data": `[{"study_id":"S-1"}]`}, true},
+		{"existing record", map[string]string{"action": "import", "data": `[{"study_id":"S-2"}]`}, false},
+		{"default field name", map[string]string{"action": "import", "data": `[{"record_id":"S-1"}]`}, false},
+		{"deleted", map[string]string{"action": "delete", "records[0]": "S-1"}, false},
+		{"not deleted", map[string]string{"action": "delete", "records[0]": "S-2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRetryRequest("record", tt.params, 1, errors.New("boom"), true)
+			got, err := verify(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
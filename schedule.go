@@ -0,0 +1,305 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventWindow is an event's schedule: its day offset from the anchor
+// date and the days allowed before and after, parsed from the Event.
+type EventWindow struct {
+	Event     string  `json:"event"`
+	Label     string  `json:"label"`
+	ArmNum    int     `json:"arm_num"`
+	DayOffset float64 `json:"day_offset"`
+	OffsetMin float64 `json:"offset_min"`
+	OffsetMax float64 `json:"offset_max"`
+}
+
+// Window parses the event's offsets. Empty offsets are 0.
+func (e Event) Window() (EventWindow, error) {
+	w := EventWindow{Event: e.UniqueEventName, Label: e.Name, ArmNum: e.ArmNum}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *float64
+	}{
+		{"day_offset", e.DayOffset, &w.DayOffset},
+		{"offset_min", e.OffsetMin, &w.OffsetMin},
+		{"offset_max", e.OffsetMax, &w.OffsetMax},
+	} {
+		v := strings.TrimSpace(f.value)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return w, fmt.Errorf("event %s: invalid %s %q", e.UniqueEventName, f.name, f.value)
+		}
+		*f.dst = n
+	}
+	if w.OffsetMin < 0 || w.OffsetMax < 0 {
+		return w, fmt.Errorf("event %s: negative window", e.UniqueEventName)
+	}
+	return w, nil
+}
+
+// VisitStatus classifies a scheduled visit.
+type VisitStatus string
+
+const (
+	VisitOnTime VisitStatus = "on_time"
+	VisitEarly  VisitStatus = "early"
+	VisitLate   VisitStatus = "late"
+	// VisitMissing has no data and its window has closed.
+	VisitMissing VisitStatus = "missing"
+	// VisitDue has no data and its window is open.
+	VisitDue VisitStatus = "due"
+	// VisitUpcoming has no data and its window has not opened.
+	VisitUpcoming VisitStatus = "upcoming"
+	// VisitCollected has data but no visit date to judge it by.
+	VisitCollected VisitStatus = "collected"
+)
+
+// ScheduledVisit is one event of a record's visit calendar. Dates are
+// days, at midnight UTC.
+type ScheduledVisit struct {
+	Record      string      `json:"record"`
+	Event       string      `json:"event"`
+	Label       string      `json:"label"`
+	Target      time.Time   `json:"target"`
+	WindowStart time.Time   `json:"window_start"`
+	WindowEnd   time.Time   `json:"window_end"`
+	Actual      time.Time   `json:"actual,omitzero"`
+	Status      VisitStatus `json:"status"`
+	// DaysFromTarget is Actual minus Target, in days, when Actual is set.
+	DaysFromTarget int `json:"days_from_target,omitempty"`
+}
+
+// ScheduleOptions configures a visit schedule.
+type ScheduleOptions struct {
+	// AnchorField is the date field holding each record's day 0, such as
+	// an enrollment or randomization date.
+	AnchorField string
+	// AnchorEvent is the event AnchorField is read from. Empty means the
+	// first event with a value.
+	AnchorEvent string
+	// DateField is a date field recorded on each event, such as
+	// visit_date, used to classify collected visits. Without it,
+	// collected visits are VisitCollected.
+	DateField string
+	// Records limits the schedule to these records.
+	Records []string
+	// Now is the date missing, due and upcoming visits are judged
+	// against; zero means today.
+	Now time.Time
+}
+
+// scheduleDate is the layout of date values in a raw record export.
+const scheduleDate = "2006-01-02"
+
+// BuildSchedule computes each record's visit calendar from the project's
+// events and flat record export rows, which must include the record ID
+// column, redcap_event_name, opts.AnchorField and opts.DateField. A
+// record follows the events of its arm; records without an anchor date
+// are left out. Visits are in record order, then by target date.
+func BuildSchedule(events []Event, rows []map[string]any, idField string, opts ScheduleOptions) ([]ScheduledVisit, error) {
+	if opts.AnchorField == "" {
+		return nil, errors.New("schedule needs an anchor field")
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	windows := make(map[string]EventWindow, len(events))
+	var order []EventWindow
+	for _, e := range events {
+		w, err := e.Window()
+		if err != nil {
+			return nil, err
+		}
+		windows[w.Event] = w
+		order = append(order, w)
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].DayOffset < order[j].DayOffset })
+
+	type recordRows struct {
+		arm    int
+		anchor time.Time
+		events map[string]map[string]any
+	}
+	var ids []string
+	byRecord := make(map[string]*recordRows)
+	for _, row := range rows {
+		id := fmt.Sprint(row[idField])
+		r := byRecord[id]
+		if r == nil {
+			r = &recordRows{events: make(map[string]map[string]any)}
+			byRecord[id] = r
+			ids = append(ids, id)
+		}
+		ev, _ := row["redcap_event_name"].(string)
+		w, ok := windows[ev]
+		if !ok {
+			continue
+		}
+		if r.arm == 0 {
+			r.arm = w.ArmNum
+		}
+		// Repeat instances share their event's schedule; the first row
+		// with a date wins
+		if prev, ok := r.events[ev]; !ok || ValueText(prev[opts.DateField]) == "" {
+			r.events[ev] = row
+		}
+		if r.anchor.IsZero() && (opts.AnchorEvent == "" || opts.AnchorEvent == ev) {
+			v := ValueText(row[opts.AnchorField])
+			if v == "" {
+				continue
+			}
+			t, err := parseScheduleDate(v)
+			if err != nil {
+				return nil, fmt.Errorf("record %s: %s: %w", id, opts.AnchorField, err)
+			}
+			r.anchor = t
+		}
+	}
+
+	var visits []ScheduledVisit
+	for _, id := range ids {
+		r := byRecord[id]
+		if r.anchor.IsZero() {
+			continue
+		}
+		for _, w := range order {
+			if w.ArmNum != r.arm {
+				continue
+			}
+			v := ScheduledVisit{
+				Record:      id,
+				Event:       w.Event,
+				Label:       w.Label,
+				Target:      addDays(r.anchor, w.DayOffset),
+				WindowStart: addDays(r.anchor, w.DayOffset-w.OffsetMin),
+				WindowEnd:   addDays(r.anchor, w.DayOffset+w.OffsetMax),
+			}
+			row, collected := r.events[w.Event]
+			if collected && opts.DateField != "" {
+				if d := ValueText(row[opts.DateField]); d != "" {
+					t, err := parseScheduleDate(d)
+					if err != nil {
+						return nil, fmt.Errorf("record %s, event %s: %s: %w", id, w.Event, opts.DateField, err)
+					}
+					v.Actual = t
+				} else {
+					collected = false
+				}
+			}
+			v.Status = visitStatus(v, collected, today)
+			if !v.Actual.IsZero() {
+				v.DaysFromTarget = int(math.Round(v.Actual.Sub(v.Target).Hours() / 24))
+			}
+			visits = append(visits, v)
+		}
+	}
+	return visits, nil
+}
+
+func visitStatus(v ScheduledVisit, collected bool, today time.Time) VisitStatus {
+	switch {
+	case !v.Actual.IsZero() && v.Actual.Before(v.WindowStart):
+		return VisitEarly
+	case !v.Actual.IsZero() && v.Actual.After(v.WindowEnd):
+		return VisitLate
+	case !v.Actual.IsZero():
+		return VisitOnTime
+	case collected:
+		return VisitCollected
+	case today.After(v.WindowEnd):
+		return VisitMissing
+	case today.Before(v.WindowStart):
+		return VisitUpcoming
+	}
+	return VisitDue
+}
+
+// addDays adds a possibly fractional number of days, rounding to whole
+// days since visits are scheduled by date.
+func addDays(t time.Time, days float64) time.Time {
+	return t.AddDate(0, 0, int(math.Round(days)))
+}
+
+// parseScheduleDate reads the date part of a date or datetime value.
+func parseScheduleDate(v string) (time.Time, error) {
+	if len(v) > len(scheduleDate) {
+		v = v[:len(scheduleDate)]
+	}
+	t, err := time.Parse(scheduleDate, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", v)
+	}
+	return t, nil
+}
+
+// ExportSchedule computes each record's visit calendar from the
+// project's events and the anchor and visit date fields. See
+// BuildSchedule.
+func (c *Client) ExportSchedule(ctx context.Context, opts ScheduleOptions) ([]ScheduledVisit, error) {
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting metadata: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("project has no fields")
+	}
+	dict := NewDictionary(fields)
+	for _, name := range []string{opts.AnchorField, opts.DateField} {
+		if name == "" {
+			continue
+		}
+		if t := dict.ColumnType(name); t != ColumnDate && t != ColumnDatetime {
+			return nil, fmt.Errorf("%s is not a date field", name)
+		}
+	}
+	idField := fields[0].Field_name
+
+	events, err := c.ExportEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, errors.New("project has no events; schedules need a longitudinal project")
+	}
+
+	list := []string{idField, opts.AnchorField}
+	if opts.DateField != "" {
+		list = append(list, opts.DateField)
+	}
+	params := map[string]string{
+		"content": "record",
+		"format":  "json",
+		"type":    "flat",
+		"fields":  commaJoin(list),
+	}
+	if len(opts.Records) > 0 {
+		params["records"] = commaJoin(opts.Records)
+	}
+	body, err := c.Request(ctx, "", params)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("unmarshaling records: %w", err)
+	}
+
+	return BuildSchedule(events, rows, idField, opts)
+}
@@ -0,0 +1,148 @@
+package redcap
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scheduleEvents() []Event {
+	return []Event{
+		{Name: "Week 4", ArmNum: 1, DayOffset: "28", OffsetMin: "3", OffsetMax: "3", UniqueEventName: "week_4_arm_1"},
+		{Name: "Baseline", ArmNum: 1, DayOffset: "0", UniqueEventName: "baseline_arm_1"},
+		{Name: "Week 1", ArmNum: 1, DayOffset: "7", OffsetMin: "2", OffsetMax: "2", UniqueEventName: "week_1_arm_1"},
+		{Name: "Baseline", ArmNum: 2, DayOffset: "0", UniqueEventName: "baseline_arm_2"},
+	}
+}
+
+func day(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestBuildSchedule(t *testing.T) {
+	rows := []map[string]any{
+		{"record_id": "1", "redcap_event_name": "baseline_arm_1", "enrolled": "2024-01-01", "visit_date": "2024-01-01"},
+		// Of repeat instances, the first with a date counts
+		{"record_id": "1", "redcap_event_name": "week_1_arm_1", "redcap_repeat_instance": float64(1), "visit_date": ""},
+		{"record_id": "1", "redcap_event_name": "week_1_arm_1", "redcap_repeat_instance": float64(2), "visit_date": "2024-01-05"},
+		{"record_id": "2", "redcap_event_name": "baseline_arm_1", "enrolled": "2024-02-05", "visit_date": "2024-02-05 10:30"},
+		{"record_id": "3", "redcap_event_name": "baseline_arm_2", "enrolled": "2024-01-01", "visit_date": "2024-01-09"},
+		{"record_id": "4", "redcap_event_name": "baseline_arm_1", "enrolled": "", "visit_date": ""},
+	}
+	visits, err := BuildSchedule(scheduleEvents(), rows, "record_id", ScheduleOptions{
+		AnchorField: "enrolled",
+		DateField:   "visit_date",
+		Now:         time.Date(2024, 2, 10, 15, 0, 0, 0, time.Local),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		record, event string
+		target        string
+		status        VisitStatus
+		days          int
+	}{
+		{"1", "baseline_arm_1", "2024-01-01", VisitOnTime, 0},
+		{"1", "week_1_arm_1", "2024-01-08", VisitEarly, -3},
+		{"1", "week_4_arm_1", "2024-01-29", VisitMissing, 0},
+		{"2", "baseline_arm_1", "2024-02-05", VisitOnTime, 0},
+		{"2", "week_1_arm_1", "2024-02-12", VisitDue, 0},
+		{"2", "week_4_arm_1", "2024-03-04", VisitUpcoming, 0},
+		{"3", "baseline_arm_2", "2024-01-01", VisitLate, 8},
+	}
+	if len(visits) != len(want) {
+		t.Fatalf("got %d visits, want %d: %+v", len(visits), len(want), visits)
+	}
+	for i, w := range want {
+		v := visits[i]
+		if v.Record != w.record || v.Event != w.event || !v.Target.Equal(day(w.target)) || v.Status != w.status || v.DaysFromTarget != w.days {
+			t.Errorf("visit %d = %s %s %s %s %+d, want %s %s %s %s %+d", i+1,
+				v.Record, v.Event, v.Target.Format("2006-01-02"), v.Status, v.DaysFromTarget,
+				w.record, w.event, w.target, w.status, w.days)
+		}
+	}
+	if v := visits[2]; !v.WindowStart.Equal(day("2024-01-26")) || !v.WindowEnd.Equal(day("2024-02-01")) {
+		t.Errorf("week 4 window = %v to %v", v.WindowStart, v.WindowEnd)
+	}
+}
+
+func TestBuildScheduleWithoutDateField(t *testing.T) {
+	rows := []map[string]any{
+		{"record_id": "1", "redcap_event_name": "week_1_arm_1", "enrolled": ""},
+		{"record_id": "1", "redcap_event_name": "baseline_arm_1", "enrolled": "2024-01-01"},
+	}
+	visits, err := BuildSchedule(scheduleEvents(), rows, "record_id", ScheduleOptions{
+		AnchorField: "enrolled",
+		AnchorEvent: "baseline_arm_1",
+		Now:         day("2024-01-08"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []VisitStatus
+	for _, v := range visits {
+		got = append(got, v.Status)
+	}
+	want := []VisitStatus{VisitCollected, VisitCollected, VisitUpcoming}
+	if !slices.Equal(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+}
+
+func TestBuildScheduleErrors(t *testing.T) {
+	rows := []map[string]any{
+		{"record_id": "1", "redcap_event_name": "baseline_arm_1", "enrolled": "01/02/2024"},
+	}
+	tests := []struct {
+		name   string
+		events []Event
+		opts   ScheduleOptions
+		want   string
+	}{
+		{"no anchor field", scheduleEvents(), ScheduleOptions{}, "anchor field"},
+		{"bad anchor date", scheduleEvents(), ScheduleOptions{AnchorField: "enrolled"}, `record 1: enrolled: invalid date "01/02/2024"`},
+		{"bad offset", []Event{{UniqueEventName: "e", DayOffset: "soon"}}, ScheduleOptions{AnchorField: "enrolled"}, "invalid day_offset"},
+		{"negative window", []Event{{UniqueEventName: "e", OffsetMin: "-1"}}, ScheduleOptions{AnchorField: "enrolled"}, "negative window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := BuildSchedule(tt.events, rows, "record_id", tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisitStatus(t *testing.T) {
+	v := ScheduledVisit{Target: day("2024-03-10"), WindowStart: day("2024-03-08"), WindowEnd: day("2024-03-12")}
+	tests := []struct {
+		actual    string
+		collected bool
+		today     string
+		want      VisitStatus
+	}{
+		{"2024-03-08", true, "2024-04-01", VisitOnTime},
+		{"2024-03-12", true, "2024-04-01", VisitOnTime},
+		{"2024-03-07", true, "2024-04-01", VisitEarly},
+		{"2024-03-13", true, "2024-04-01", VisitLate},
+		{"", true, "2024-04-01", VisitCollected},
+		{"", false, "2024-03-13", VisitMissing},
+		{"", false, "2024-03-12", VisitDue},
+		{"", false, "2024-03-08", VisitDue},
+		{"", false, "2024-03-07", VisitUpcoming},
+	}
+	for _, tt := range tests {
+		v.Actual = time.Time{}
+		if tt.actual != "" {
+			v.Actual = day(tt.actual)
+		}
+		if got := visitStatus(v, tt.collected, day(tt.today)); got != tt.want {
+			t.Errorf("visitStatus(actual %q, collected %v, today %s) = %s, want %s", tt.actual, tt.collected, tt.today, got, tt.want)
+		}
+	}
+}
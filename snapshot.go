@@ -0,0 +1,784 @@
+package redcap
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SnapshotFormat identifies a snapshot archive and SnapshotVersion is the
+// layout version written by Snapshot. Restore refuses newer versions.
+const (
+	SnapshotFormat  = "go-cap-snapshot"
+	SnapshotVersion = 1
+)
+
+// Archive entries. Each holds the raw JSON export of one endpoint, so a
+// snapshot keeps every attribute REDCap returns, modeled here or not.
+const (
+	snapManifest    = "manifest.json"
+	snapProject     = "project.json"
+	snapMetadata    = "metadata.json"
+	snapInstruments = "instruments.json"
+	snapArms        = "arms.json"
+	snapEvents      = "events.json"
+	snapMapping     = "form_event_mapping.json"
+	snapRepeating   = "repeating_forms_events.json"
+	snapDAGs        = "dags.json"
+	snapUsers       = "users.json"
+	// Records are written in batches as records/00001.json and so on
+	snapRecordDir = "records/"
+)
+
+var (
+	// ErrSnapshotCorrupt means an archive entry is missing or does not
+	// match its manifest checksum.
+	ErrSnapshotCorrupt = errors.New("snapshot is corrupt")
+	// ErrSnapshotVersion means the archive is not a snapshot or was
+	// written by a newer version.
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+	// ErrProjectNotEmpty means Restore found records in the target project.
+	ErrProjectNotEmpty = errors.New("target project is not empty")
+	// ErrRestoreMismatch means the restored project does not match the
+	// snapshot.
+	ErrRestoreMismatch = errors.New("restored project does not match snapshot")
+)
+
+// SnapshotManifest describes a snapshot archive.
+type SnapshotManifest struct {
+	Format        string          `json:"format"`
+	Version       int             `json:"version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	SourceURL     string          `json:"source_url"`
+	ProjectID     string          `json:"project_id"`
+	ProjectTitle  string          `json:"project_title"`
+	REDCapVersion string          `json:"redcap_version"`
+	Longitudinal  bool            `json:"longitudinal"`
+	Repeating     bool            `json:"repeating"`
+	Records       int             `json:"records"`
+	Entries       []SnapshotEntry `json:"entries"`
+	Files         []SnapshotFile  `json:"files"`
+}
+
+// SnapshotEntry is one archive member and its checksum. Count is the
+// number of items in a JSON array entry.
+type SnapshotEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Count  int    `json:"count,omitempty"`
+}
+
+// SnapshotFile locates a file-upload value in the archive. Instance is 0
+// outside repeating forms and events.
+type SnapshotFile struct {
+	Record   string `json:"record"`
+	Event    string `json:"event,omitempty"`
+	Field    string `json:"field"`
+	Instance int    `json:"instance,omitempty"`
+	Name     string `json:"name"`
+	Entry    string `json:"entry"`
+}
+
+// SnapshotOptions controls what Snapshot captures.
+type SnapshotOptions struct {
+	// SkipFiles leaves out file-upload and signature field contents.
+	SkipFiles bool
+	// SkipUsers leaves out user rights.
+	SkipUsers bool
+	// BatchSize is how many records each records entry holds; 0 means
+	// 500. Only one batch and its files are held in memory at a time.
+	BatchSize int
+}
+
+// Snapshot writes a point-in-time backup of the project to w as a zip
+// archive: project settings, data dictionary, instruments, arms, events,
+// form-event mapping, repeating forms, DAGs, users, all records and the
+// files in file-upload fields, with a manifest of SHA-256 checksums.
+// Records are exported in batches, each written with its files before
+// the next is fetched.
+func (c *Client) Snapshot(ctx context.Context, w io.Writer, opts SnapshotOptions) (*SnapshotManifest, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	sw := &snapshotWriter{zw: zip.NewWriter(w)}
+	m := &SnapshotManifest{
+		Format:    SnapshotFormat,
+		Version:   SnapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		SourceURL: c.baseURL,
+		Entries:   []SnapshotEntry{},
+		Files:     []SnapshotFile{},
+	}
+
+	project, err := c.Request(ctx, "project", map[string]string{"format": "json"})
+	if err != nil {
+		return nil, fmt.Errorf("exporting project: %w", err)
+	}
+	var info []map[string]any
+	if err := json.Unmarshal(project, &info); err != nil {
+		return nil, fmt.Errorf("unmarshaling project: %w", err)
+	}
+	if len(info) == 0 {
+		return nil, errors.New("no project data returned")
+	}
+	m.ProjectID = fmt.Sprint(info[0]["project_id"])
+	m.ProjectTitle = fmt.Sprint(info[0]["project_title"])
+	m.Longitudinal = truthy(info[0]["is_longitudinal"])
+	m.Repeating = truthy(info[0]["has_repeating_instruments_or_events"])
+	if m.REDCapVersion, err = c.ExportVersion(ctx); err != nil {
+		return nil, fmt.Errorf("exporting version: %w", err)
+	}
+	if err := sw.add(snapProject, project, m); err != nil {
+		return nil, err
+	}
+
+	// Arms, events and mappings exist only in longitudinal projects, and
+	// REDCap answers the endpoints with an error otherwise
+	sections := []struct {
+		entry, content string
+		skip           bool
+	}{
+		{snapMetadata, "metadata", false},
+		{snapInstruments, "instrument", false},
+		{snapArms, "arm", !m.Longitudinal},
+		{snapEvents, "event", !m.Longitudinal},
+		{snapMapping, "formEventMapping", !m.Longitudinal},
+		{snapRepeating, "repeatingFormsEvents", !m.Repeating},
+		{snapDAGs, "dag", false},
+		{snapUsers, "user", opts.SkipUsers},
+	}
+	for _, s := range sections {
+		if s.skip {
+			continue
+		}
+		body, err := c.Request(ctx, s.content, map[string]string{"format": "json"})
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", s.content, err)
+		}
+		if err := sw.add(s.entry, body, m); err != nil {
+			return nil, err
+		}
+	}
+
+	var fields []Field
+	if err := json.Unmarshal(sw.data[snapMetadata], &fields); err != nil {
+		return nil, fmt.Errorf("unmarshaling metadata: %w", err)
+	}
+	dict := NewDictionary(fields)
+	var batches int
+	err = c.ExportRecordBatches(ctx, opts.BatchSize, func(rows []map[string]any) error {
+		body, err := json.Marshal(rows)
+		if err != nil {
+			return fmt.Errorf("marshaling records: %w", err)
+		}
+		batches++
+		if err := sw.add(fmt.Sprintf("%s%05d.json", snapRecordDir, batches), body, m); err != nil {
+			return err
+		}
+		m.Records += len(recordIDs(rows, dict.RecordIDField))
+		if opts.SkipFiles {
+			return nil
+		}
+		return c.snapshotFiles(ctx, sw, m, dict, rows)
+	}, ExportRawOrLabel("raw"), ExportDataAccessGroups(true))
+	if err != nil {
+		return nil, fmt.Errorf("exporting records: %w", err)
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling manifest: %w", err)
+	}
+	if err := sw.write(snapManifest, manifest); err != nil {
+		return nil, err
+	}
+	if err := sw.zw.Close(); err != nil {
+		return nil, fmt.Errorf("writing snapshot: %w", err)
+	}
+	return m, nil
+}
+
+// snapshotFiles downloads every non-empty file-upload value in rows.
+func (c *Client) snapshotFiles(ctx context.Context, sw *snapshotWriter, m *SnapshotManifest, dict *Dictionary, rows []map[string]any) error {
+	var fileFields []string
+	for _, f := range dict.Fields {
+		if f.Field_type == "file" {
+			fileFields = append(fileFields, f.Field_name)
+		}
+	}
+
+	for _, ref := range fileValues(rows, dict.RecordIDField, fileFields) {
+		sf := SnapshotFile{
+			Record:   ref.Record,
+			Event:    ref.Event,
+			Field:    ref.Field,
+			Instance: ref.Instance,
+		}
+		resp, err := c.exportFile(ctx, sf.Record, sf.Field, sf.Event, sf.Instance)
+		if err != nil {
+			return fmt.Errorf("exporting file %s of record %s: %w", sf.Field, sf.Record, err)
+		}
+		sf.Name = fileName(resp.header)
+		sf.Entry = fmt.Sprintf("files/%05d", len(m.Files)+1)
+		if err := sw.add(sf.Entry, resp.body, m); err != nil {
+			return err
+		}
+		m.Files = append(m.Files, sf)
+	}
+	return nil
+}
+
+// snapshotWriter adds checksummed entries to a snapshot archive. It keeps
+// the JSON entries it has written for later steps to read back, except
+// record batches.
+type snapshotWriter struct {
+	zw   *zip.Writer
+	data map[string][]byte
+}
+
+func (sw *snapshotWriter) add(name string, data []byte, m *SnapshotManifest) error {
+	sum := sha256.Sum256(data)
+	e := SnapshotEntry{
+		Name:   name,
+		Size:   int64(len(data)),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	if path.Ext(name) == ".json" {
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) == nil {
+			e.Count = len(items)
+		}
+		if !strings.HasPrefix(name, snapRecordDir) {
+			if sw.data == nil {
+				sw.data = make(map[string][]byte)
+			}
+			sw.data[name] = data
+		}
+	}
+	m.Entries = append(m.Entries, e)
+	return sw.write(name, data)
+}
+
+func (sw *snapshotWriter) write(name string, data []byte) error {
+	f, err := sw.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("writing snapshot entry %s: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("writing snapshot entry %s: %w", name, err)
+	}
+	return nil
+}
+
+// SnapshotArchive is an opened snapshot. Entries are checked against the
+// manifest as they are read.
+type SnapshotArchive struct {
+	Manifest SnapshotManifest
+
+	zr      *zip.Reader
+	entries map[string]SnapshotEntry
+	closer  io.Closer
+}
+
+// OpenSnapshot opens a snapshot file written by Snapshot.
+func OpenSnapshot(name string) (*SnapshotArchive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s, err := ReadSnapshot(f, st.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.closer = f
+	return s, nil
+}
+
+// ReadSnapshot reads a snapshot archive of the given size.
+func ReadSnapshot(r io.ReaderAt, size int64) (*SnapshotArchive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotVersion, err)
+	}
+	s := &SnapshotArchive{zr: zr, entries: make(map[string]SnapshotEntry)}
+
+	data, err := s.readRaw(snapManifest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no manifest", ErrSnapshotVersion)
+	}
+	if err := json.Unmarshal(data, &s.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	if s.Manifest.Format != SnapshotFormat {
+		return nil, fmt.Errorf("%w: not a snapshot archive", ErrSnapshotVersion)
+	}
+	if s.Manifest.Version > SnapshotVersion {
+		return nil, fmt.Errorf("%w: version %d is newer than %d", ErrSnapshotVersion, s.Manifest.Version, SnapshotVersion)
+	}
+	for _, e := range s.Manifest.Entries {
+		s.entries[e.Name] = e
+	}
+	return s, nil
+}
+
+// Close closes a snapshot opened with OpenSnapshot.
+func (s *SnapshotArchive) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// Has reports whether the snapshot contains the named entry.
+func (s *SnapshotArchive) Has(name string) bool {
+	_, ok := s.entries[name]
+	return ok
+}
+
+// Entry returns the contents of a manifest entry after checking its size
+// and checksum.
+func (s *SnapshotArchive) Entry(name string) ([]byte, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not in the manifest", ErrSnapshotCorrupt, name)
+	}
+	data, err := s.readRaw(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrSnapshotCorrupt, name, err)
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != e.Size || hex.EncodeToString(sum[:]) != e.SHA256 {
+		return nil, fmt.Errorf("%w: %s fails its checksum", ErrSnapshotCorrupt, name)
+	}
+	return data, nil
+}
+
+// Verify checks every entry against the manifest.
+func (s *SnapshotArchive) Verify() error {
+	for _, e := range s.Manifest.Entries {
+		if _, err := s.Entry(e.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SnapshotArchive) readRaw(name string) ([]byte, error) {
+	f, err := s.zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// RestoreOptions controls Restore.
+type RestoreOptions struct {
+	// Force restores into a project that already has records. Existing
+	// records with the same names take the snapshot's values.
+	Force bool
+	// Users restores user rights. Off by default because usernames rarely
+	// carry over between REDCap servers.
+	Users bool
+	// SkipFiles leaves file-upload fields empty.
+	SkipFiles bool
+	// BatchSize is the number of records per import call; 0 means 500.
+	BatchSize int
+}
+
+// RestoreReport lists what Restore imported and any differences found
+// when the restored project was compared with the snapshot.
+type RestoreReport struct {
+	Steps      []RestoreStep `json:"steps"`
+	Mismatches []string      `json:"mismatches"`
+}
+
+// RestoreStep is one phase of a restore and the number of items REDCap
+// reported importing.
+type RestoreStep struct {
+	Name    string `json:"name"`
+	Count   int    `json:"count"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// projectSettings are the project attributes the API accepts on import.
+var projectSettings = []string{
+	"project_title", "project_language", "purpose", "purpose_other",
+	"project_notes", "custom_record_label", "secondary_unique_field",
+	"is_longitudinal", "surveys_enabled", "scheduling_enabled",
+	"record_autonumbering_enabled", "randomization_enabled",
+	"project_irb_number", "project_grant_number", "project_pi_firstname",
+	"project_pi_lastname", "display_today_now_button",
+	"bypass_branching_erase_field_prompt",
+}
+
+// Restore replays a snapshot into the project, which should be newly
+// created and empty. The data dictionary goes first, then project
+// settings, arms, events, form-event mapping, repeating forms, DAGs,
+// users if requested, records in batches and files. Afterwards the
+// project is exported again and compared with the snapshot; differences
+// are listed in the report and returned as ErrRestoreMismatch.
+func (c *Client) Restore(ctx context.Context, s *SnapshotArchive, opts RestoreOptions) (*RestoreReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	// With every entry verified up front, later reads cannot fail
+	if err := s.Verify(); err != nil {
+		return nil, err
+	}
+	report := &RestoreReport{Steps: []RestoreStep{}, Mismatches: []string{}}
+
+	if !opts.Force {
+		n, err := c.countRecords(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("checking target project: %w", err)
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("%w: it has %d records", ErrProjectNotEmpty, n)
+		}
+	}
+
+	metadata, _ := s.Entry(snapMetadata)
+	n, err := c.importJSON(ctx, "metadata", metadata, nil)
+	if err != nil {
+		return report, fmt.Errorf("restoring metadata: %w", err)
+	}
+	report.Steps = append(report.Steps, RestoreStep{Name: "metadata", Count: n})
+
+	settings, err := restoreSettings(s)
+	if err != nil {
+		return report, err
+	}
+	if _, err := c.importJSON(ctx, "project_settings", settings, nil); err != nil {
+		return report, fmt.Errorf("restoring project settings: %w", err)
+	}
+	report.Steps = append(report.Steps, RestoreStep{Name: "project settings", Count: 1})
+
+	// Arms and events replace the defaults of a new project
+	steps := []struct {
+		name, entry, content string
+		params               map[string]string
+	}{
+		{"arms", snapArms, "arm", map[string]string{"action": "import", "override": "1"}},
+		{"events", snapEvents, "event", map[string]string{"action": "import", "override": "1"}},
+		{"form-event mapping", snapMapping, "formEventMapping", map[string]string{"action": "import"}},
+		{"repeating forms", snapRepeating, "repeatingFormsEvents", nil},
+	}
+	for _, st := range steps {
+		if err := c.restoreEntry(ctx, s, report, st.name, st.entry, st.content, st.params); err != nil {
+			return report, err
+		}
+	}
+
+	// DAGs come before users, whose rights may name a DAG
+	if err := c.restoreDAGs(ctx, s, report); err != nil {
+		return report, err
+	}
+	if opts.Users {
+		if err := c.restoreEntry(ctx, s, report, "users", snapUsers, "user", nil); err != nil {
+			return report, err
+		}
+	} else {
+		report.Steps = append(report.Steps, RestoreStep{Name: "users", Skipped: true})
+	}
+
+	if err := c.restoreRecords(ctx, s, opts.BatchSize, report); err != nil {
+		return report, err
+	}
+
+	if opts.SkipFiles {
+		report.Steps = append(report.Steps, RestoreStep{Name: "files", Skipped: true})
+	} else {
+		for _, f := range s.Manifest.Files {
+			data, _ := s.Entry(f.Entry)
+			fopts := []ImportOption{ImportFileName(f.Name)}
+			if f.Instance > 0 {
+				fopts = append(fopts, ImportRepeatInstance(f.Instance))
+			}
+			if err := c.ImportFile(ctx, f.Record, f.Field, f.Event, data, fopts...); err != nil {
+				return report, fmt.Errorf("restoring file %s of record %s: %w", f.Field, f.Record, err)
+			}
+		}
+		report.Steps = append(report.Steps, RestoreStep{Name: "files", Count: len(s.Manifest.Files)})
+	}
+
+	if err := c.verifyRestore(ctx, s, opts, report); err != nil {
+		return report, err
+	}
+	if len(report.Mismatches) > 0 {
+		return report, fmt.Errorf("%w: %d differences", ErrRestoreMismatch, len(report.Mismatches))
+	}
+	return report, nil
+}
+
+// restoreEntry imports one JSON entry as is. Entries the snapshot does
+// not have are skipped; empty ones are not sent.
+func (c *Client) restoreEntry(ctx context.Context, s *SnapshotArchive, report *RestoreReport, name, entry, content string, params map[string]string) error {
+	if !s.Has(entry) {
+		report.Steps = append(report.Steps, RestoreStep{Name: name, Skipped: true})
+		return nil
+	}
+	if s.entries[entry].Count == 0 {
+		report.Steps = append(report.Steps, RestoreStep{Name: name})
+		return nil
+	}
+	data, _ := s.Entry(entry)
+	n, err := c.importJSON(ctx, content, data, params)
+	if err != nil {
+		return fmt.Errorf("restoring %s: %w", name, err)
+	}
+	report.Steps = append(report.Steps, RestoreStep{Name: name, Count: n})
+	return nil
+}
+
+// restoreSettings picks the importable attributes from the snapshot's
+// project export.
+func restoreSettings(s *SnapshotArchive) ([]byte, error) {
+	data, _ := s.Entry(snapProject)
+	var info []map[string]any
+	if err := json.Unmarshal(data, &info); err != nil || len(info) == 0 {
+		return nil, fmt.Errorf("%w: unreadable %s", ErrSnapshotCorrupt, snapProject)
+	}
+	settings := make(map[string]any)
+	for _, k := range projectSettings {
+		if v, ok := info[0][k]; ok && v != nil {
+			settings[k] = v
+		}
+	}
+	return json.Marshal(settings)
+}
+
+// restoreDAGs creates the snapshot's DAGs. Unique names are derived from
+// group names, so they come out as they were in the source project.
+func (c *Client) restoreDAGs(ctx context.Context, s *SnapshotArchive, report *RestoreReport) error {
+	if !s.Has(snapDAGs) {
+		report.Steps = append(report.Steps, RestoreStep{Name: "DAGs", Skipped: true})
+		return nil
+	}
+	data, _ := s.Entry(snapDAGs)
+	var dags []DAG
+	if err := json.Unmarshal(data, &dags); err != nil {
+		return fmt.Errorf("%w: unreadable %s", ErrSnapshotCorrupt, snapDAGs)
+	}
+	if len(dags) == 0 {
+		report.Steps = append(report.Steps, RestoreStep{Name: "DAGs"})
+		return nil
+	}
+
+	for i := range dags {
+		dags[i].UniqueGroupName = ""
+	}
+	n, err := c.ImportDAGs(ctx, dags)
+	if err != nil {
+		return fmt.Errorf("restoring DAGs: %w", err)
+	}
+	report.Steps = append(report.Steps, RestoreStep{Name: "DAGs", Count: n})
+	return nil
+}
+
+// recordEntries lists the record batch entries in order.
+func (s *SnapshotArchive) recordEntries() []string {
+	var names []string
+	for _, e := range s.Manifest.Entries {
+		if strings.HasPrefix(e.Name, snapRecordDir) {
+			names = append(names, e.Name)
+		}
+	}
+	return names
+}
+
+// restoreRecords imports the snapshot's records one entry at a time,
+// keeping all rows of a record in the same batch. Calculated, file and
+// descriptive fields are left out; REDCap does not accept them on import.
+func (c *Client) restoreRecords(ctx context.Context, s *SnapshotArchive, batchSize int, report *RestoreReport) error {
+	dict, err := s.dictionary()
+	if err != nil {
+		return err
+	}
+	var total, done int
+	for _, entry := range s.recordEntries() {
+		data, _ := s.Entry(entry)
+		var rows []map[string]any
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return fmt.Errorf("%w: unreadable %s", ErrSnapshotCorrupt, entry)
+		}
+		n, err := c.restoreRecordBatches(ctx, dict, rows, batchSize, done)
+		total += n
+		if err != nil {
+			return err
+		}
+		done += len(recordIDs(rows, dict.RecordIDField))
+	}
+	report.Steps = append(report.Steps, RestoreStep{Name: "records", Count: total})
+	return nil
+}
+
+// restoreRecordBatches imports rows in batches of whole records and
+// returns the number imported. offset numbers the records in errors.
+func (c *Client) restoreRecordBatches(ctx context.Context, dict *Dictionary, rows []map[string]any, batchSize, offset int) (int, error) {
+	ids := recordIDs(rows, dict.RecordIDField)
+	byRecord := make(map[string][]map[string]any, len(ids))
+	for _, row := range rows {
+		for _, f := range dict.Fields {
+			switch f.Field_type {
+			case "calc", "file", "descriptive":
+				delete(row, f.Field_name)
+			}
+		}
+		id := fmt.Sprint(row[dict.RecordIDField])
+		byRecord[id] = append(byRecord[id], row)
+	}
+
+	var total int
+	for start := 0; start < len(ids); start += batchSize {
+		end := min(start+batchSize, len(ids))
+		var batch []map[string]any
+		for _, id := range ids[start:end] {
+			batch = append(batch, byRecord[id]...)
+		}
+		body, err := json.Marshal(batch)
+		if err != nil {
+			return total, fmt.Errorf("marshaling records: %w", err)
+		}
+		res, err := c.ImportRecordsRaw(ctx, body, ImportOverwriteBehavior("overwrite"))
+		if err != nil {
+			return total, fmt.Errorf("restoring records %d-%d: %w", offset+start+1, offset+end, err)
+		}
+		total += res.Count
+	}
+	return total, nil
+}
+
+// verifyRestore exports the restored project and compares it with the
+// snapshot.
+func (c *Client) verifyRestore(ctx context.Context, s *SnapshotArchive, opts RestoreOptions, report *RestoreReport) error {
+	mismatch := func(format string, args ...any) {
+		report.Mismatches = append(report.Mismatches, fmt.Sprintf(format, args...))
+	}
+
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("verifying metadata: %w", err)
+	}
+	if want := s.entries[snapMetadata].Count; len(fields) != want {
+		mismatch("metadata has %d fields, snapshot has %d", len(fields), want)
+	}
+
+	if s.Manifest.Longitudinal {
+		events, err := c.ExportEvents(ctx)
+		if err != nil {
+			return fmt.Errorf("verifying events: %w", err)
+		}
+		if want := s.entries[snapEvents].Count; len(events) != want {
+			mismatch("project has %d events, snapshot has %d", len(events), want)
+		}
+	}
+
+	dict := NewDictionary(fields)
+	var records, files int
+	err = c.ExportRecordBatches(ctx, opts.BatchSize, func(rows []map[string]any) error {
+		records += len(recordIDs(rows, dict.RecordIDField))
+		for _, row := range rows {
+			for _, f := range dict.Fields {
+				if v, _ := row[f.Field_name].(string); f.Field_type == "file" && v != "" {
+					files++
+				}
+			}
+		}
+		return nil
+	}, ExportRawOrLabel("raw"))
+	if err != nil {
+		return fmt.Errorf("verifying records: %w", err)
+	}
+	if records != s.Manifest.Records {
+		mismatch("project has %d records, snapshot has %d", records, s.Manifest.Records)
+	}
+
+	if !opts.SkipFiles {
+		if files != len(s.Manifest.Files) {
+			mismatch("project has %d files, snapshot has %d", files, len(s.Manifest.Files))
+		}
+	}
+	return nil
+}
+
+// countRecords returns the number of records in the project.
+func (c *Client) countRecords(ctx context.Context) (int, error) {
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	idField := fields[0].Field_name
+	body, err := c.ExportRecordsRaw(ctx, ExportFormat("json"), ExportFields([]string{idField}))
+	if err != nil {
+		return 0, err
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return 0, fmt.Errorf("unmarshaling records: %w", err)
+	}
+	return len(recordIDs(rows, idField)), nil
+}
+
+// dictionary returns the snapshot's data dictionary.
+func (s *SnapshotArchive) dictionary() (*Dictionary, error) {
+	data, _ := s.Entry(snapMetadata)
+	var fields []Field
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) == 0 {
+		return nil, fmt.Errorf("%w: unreadable %s", ErrSnapshotCorrupt, snapMetadata)
+	}
+	return NewDictionary(fields), nil
+}
+
+// recordIDs returns the distinct record names in rows in first-seen order.
+func recordIDs(rows []map[string]any, idField string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		id := fmt.Sprint(row[idField])
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// truthy reads a project flag, which REDCap sends as 0/1, "0"/"1" or a
+// boolean depending on version.
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
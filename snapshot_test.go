@@ -0,0 +1,208 @@
+package redcap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeFile is a file-upload value held by fakeProject.
+type fakeFile struct {
+	name string
+	data []byte
+}
+
+// fakeProject is an in-memory classic REDCap project serving the
+// endpoints Snapshot, Restore and FileDownloader use.
+type fakeProject struct {
+	mu       sync.Mutex
+	fields   []Field
+	records  []map[string]any
+	files    map[string]fakeFile // by record/field
+	requests map[string]int      // by content/action
+}
+
+func newFakeProject() *fakeProject {
+	return &fakeProject{
+		fields: []Field{
+			{Field_name: "record_id", Form_name: "demo", Field_type: "text"},
+			{Field_name: "name", Form_name: "demo", Field_type: "text"},
+			{Field_name: "scan", Form_name: "demo", Field_type: "file"},
+		},
+		files:    make(map[string]fakeFile),
+		requests: make(map[string]int),
+	}
+}
+
+// addRecord adds a record, with a scan file when scan is not empty.
+func (p *fakeProject) addRecord(id, name, scan string) {
+	row := map[string]any{"record_id": id, "name": name, "scan": ""}
+	if scan != "" {
+		row["scan"] = scan + ".txt"
+		p.files[id+"/scan"] = fakeFile{name: scan + ".txt", data: []byte("contents of " + scan)}
+	}
+	p.records = append(p.records, row)
+}
+
+func (p *fakeProject) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Some imports, such as metadata, send data without an action
+	content, action := r.FormValue("content"), r.FormValue("action")
+	data := []byte(r.FormValue("data"))
+	switch {
+	case action != "":
+	case len(data) > 0:
+		action = "import"
+	default:
+		action = "export"
+	}
+	p.requests[content+"/"+action]++
+	reply := func(v any) {
+		json.NewEncoder(w).Encode(v)
+	}
+
+	switch content + "/" + action {
+	case "project/export":
+		reply([]map[string]any{{"project_id": 7, "project_title": "Test", "is_longitudinal": 0, "has_repeating_instruments_or_events": 0}})
+	case "version/export":
+		w.Write([]byte("14.0.0"))
+	case "metadata/export":
+		reply(p.fields)
+	case "instrument/export":
+		reply([]map[string]string{{"instrument_name": "demo", "instrument_label": "Demo"}})
+	case "dag/export", "user/export":
+		reply([]any{})
+	case "metadata/import":
+		var fields []Field
+		json.Unmarshal(data, &fields)
+		p.fields = fields
+		reply(len(fields))
+	case "project_settings/import":
+		w.Write([]byte("1"))
+	case "record/export":
+		rows := []map[string]any{}
+		ids := strings.Split(r.FormValue("records"), ",")
+		fields := strings.Split(r.FormValue("fields"), ",")
+		for _, row := range p.records {
+			if r.FormValue("records") != "" && !slices.Contains(ids, row["record_id"].(string)) {
+				continue
+			}
+			out := make(map[string]any)
+			for k, v := range row {
+				if r.FormValue("fields") == "" || slices.Contains(fields, k) {
+					out[k] = v
+				}
+			}
+			rows = append(rows, out)
+		}
+		reply(rows)
+	case "record/import":
+		var rows []map[string]any
+		if err := json.Unmarshal(data, &rows); err != nil {
+			http.Error(w, `{"error":"bad data"}`, http.StatusBadRequest)
+			return
+		}
+		for _, row := range rows {
+			row["scan"] = ""
+			p.records = append(p.records, row)
+		}
+		reply(map[string]int{"count": len(rows)})
+	case "file/export":
+		f, ok := p.files[r.FormValue("record")+"/"+r.FormValue("field")]
+		if !ok {
+			http.Error(w, `{"error":"There is no file to download for this record"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", fmt.Sprintf("text/plain; name=%q", f.name))
+		w.Write(f.data)
+	case "file/import":
+		file, hdr, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, `{"error":"no file"}`, http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(file)
+		record, field := r.FormValue("record"), r.FormValue("field")
+		p.files[record+"/"+field] = fakeFile{name: hdr.Filename, data: b}
+		for _, row := range p.records {
+			if row["record_id"] == record {
+				row[field] = hdr.Filename
+			}
+		}
+	default:
+		http.Error(w, `{"error":"unsupported request"}`, http.StatusBadRequest)
+	}
+}
+
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	src := newFakeProject()
+	for i := 1; i <= 5; i++ {
+		scan := ""
+		if i%2 == 1 {
+			scan = fmt.Sprintf("scan%d", i)
+		}
+		src.addRecord(fmt.Sprint(i), fmt.Sprintf("name %d", i), scan)
+	}
+	c := newTestClient(t, src.ServeHTTP)
+
+	var buf bytes.Buffer
+	m, err := c.Snapshot(context.Background(), &buf, SnapshotOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != SnapshotVersion || m.Records != 5 || len(m.Files) != 3 {
+		t.Fatalf("manifest: version %d, %d records, %d files; want %d, 5, 3", m.Version, m.Records, len(m.Files), SnapshotVersion)
+	}
+	// Each batch is followed by its own files
+	var order []string
+	for _, e := range m.Entries {
+		if strings.HasPrefix(e.Name, snapRecordDir) || strings.HasPrefix(e.Name, "files/") {
+			order = append(order, e.Name)
+		}
+	}
+	want := []string{
+		"records/00001.json", "files/00001",
+		"records/00002.json", "files/00002",
+		"records/00003.json", "files/00003",
+	}
+	if !slices.Equal(order, want) {
+		t.Errorf("entries = %v, want %v", order, want)
+	}
+
+	s, err := ReadSnapshot(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newFakeProject()
+	dst.fields = nil
+	report, err := newTestClient(t, dst.ServeHTTP).Restore(context.Background(), s, RestoreOptions{BatchSize: 1})
+	if err != nil {
+		t.Fatalf("Restore: %v (mismatches %v)", err, report.Mismatches)
+	}
+	if len(dst.records) != 5 || len(dst.files) != 3 {
+		t.Errorf("restored %d records and %d files, want 5 and 3", len(dst.records), len(dst.files))
+	}
+	if got := dst.requests["record/import"]; got != 5 {
+		t.Errorf("record imports = %d, want 5 with batch size 1", got)
+	}
+	if f := dst.files["3/scan"]; f.name != "scan3.txt" || string(f.data) != "contents of scan3" {
+		t.Errorf("file 3/scan = %q %q", f.name, f.data)
+	}
+}
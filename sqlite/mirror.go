@@ -0,0 +1,409 @@
+// Package sqlite mirrors a REDCap project into a local SQLite database so
+// it can be queried with SQL without going back to the API.
+//
+// Each instrument becomes a table named after it, with one row per record,
+// event and repeat instance and one column per exported field, typed from
+// the field's validation. All values are also kept in long form in _data,
+// which is the easier table for checkbox and repeating data. The data
+// dictionary, choices, instruments and project attributes are stored in
+// _metadata, _choices, _instruments and _project.
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjodo/go-cap"
+
+	// Pure-Go driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// Mirror is a local SQLite copy of one REDCap project.
+type Mirror struct {
+	db *sql.DB
+}
+
+// Open opens or creates a mirror database.
+func Open(path string) (*Mirror, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	// One connection: SQLite serializes writers anyway, and pragmas are
+	// per connection
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		`PRAGMA journal_mode = WAL`,
+		`PRAGMA foreign_keys = ON`,
+		`CREATE TABLE IF NOT EXISTS _sync (key TEXT PRIMARY KEY, value TEXT)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("initializing %s: %w", path, err)
+		}
+	}
+	return &Mirror{db: db}, nil
+}
+
+// DB returns the underlying database for queries.
+func (m *Mirror) DB() *sql.DB {
+	return m.db
+}
+
+// Close closes the database.
+func (m *Mirror) Close() error {
+	return m.db.Close()
+}
+
+// Options controls Sync.
+type Options struct {
+	// Full rebuilds the mirror instead of refreshing changed records.
+	Full bool
+	// Overlap is subtracted from the previous sync time; 0 means
+	// redcap.DefaultOverlap.
+	Overlap time.Duration
+	// Location is the REDCap server's time zone; nil means time.Local.
+	Location *time.Location
+	// BatchSize is how many records each export call of a full sync
+	// holds; 0 means 500.
+	BatchSize int
+}
+
+// Result describes one Sync.
+type Result struct {
+	// Full is set when the mirror was rebuilt: on the first sync, with
+	// Options.Full, or because the data dictionary changed.
+	Full bool `json:"full"`
+	// Since is the start of the refreshed date range, zero when Full.
+	Since time.Time `json:"since"`
+	// Mark is the server time of this sync.
+	Mark time.Time `json:"mark"`
+	// Records is the number of records exported.
+	Records int `json:"records"`
+	// Tables lists the instrument tables.
+	Tables []string `json:"tables"`
+}
+
+// Keys in the _sync table.
+const (
+	keyMark         = "mark"
+	keyMetadataHash = "metadata_sha256"
+	keyURL          = "source_url"
+)
+
+// Sync brings the mirror up to date. The first sync, and any sync after
+// the data dictionary changes, rebuilds every table; later ones export
+// only records changed since the previous sync and replace their rows.
+// Deleted records are only removed by a full sync.
+func (m *Mirror) Sync(ctx context.Context, c *redcap.Client, opts Options) (*Result, error) {
+	overlap := opts.Overlap
+	if overlap == 0 {
+		overlap = redcap.DefaultOverlap
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	fields, err := c.ExportMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting metadata: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("project has no fields")
+	}
+	dict := redcap.NewDictionary(fields)
+	hash, err := metadataHash(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Full: true, Tables: dict.Forms()}
+	state, err := m.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A changed dictionary or a different project means the tables no
+	// longer fit the data
+	if mark, ok := state[keyMark]; ok && !opts.Full && state[keyMetadataHash] == hash && state[keyURL] == c.BaseURL() {
+		t, err := time.Parse(time.RFC3339Nano, mark)
+		if err == nil {
+			res.Full = false
+			res.Since = t.Add(-overlap)
+		}
+	}
+
+	// A full sync streams every record in batches; an incremental one
+	// exports only the changed records, in one request
+	var rows []map[string]any
+	if res.Full {
+		res.Mark, err = c.ServerTime(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading server time: %w", err)
+		}
+	} else {
+		rows, res.Mark, err = c.ExportChangedRows(ctx, res.Since.In(loc), redcap.ExportRawOrLabel("raw"))
+		if err != nil {
+			return nil, fmt.Errorf("exporting records: %w", err)
+		}
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if res.Full {
+		project, err := c.ExportProject(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("exporting project: %w", err)
+		}
+		instruments, err := c.ExportInstruments(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("exporting instruments: %w", err)
+		}
+		if err := rebuild(ctx, tx, dict, project, instruments); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := newWriter(ctx, tx, dict)
+	if err != nil {
+		return nil, err
+	}
+	defer w.close()
+	if res.Full {
+		err := c.ExportRecordBatches(ctx, opts.BatchSize, func(rows []map[string]any) error {
+			res.Records += len(recordIDs(rows, dict.RecordIDField))
+			return w.insertRows(ctx, rows)
+		}, redcap.ExportRawOrLabel("raw"))
+		if err != nil {
+			return nil, fmt.Errorf("exporting records: %w", err)
+		}
+	} else {
+		ids := recordIDs(rows, dict.RecordIDField)
+		res.Records = len(ids)
+		for _, id := range ids {
+			if err := w.deleteRecord(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.insertRows(ctx, rows); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range map[string]string{
+		keyMark:         res.Mark.Format(time.RFC3339Nano),
+		keyMetadataHash: hash,
+		keyURL:          c.BaseURL(),
+	} {
+		if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO _sync (key, value) VALUES (?, ?)`, k, v); err != nil {
+			return nil, fmt.Errorf("updating sync state: %w", err)
+		}
+	}
+	w.close()
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing sync: %w", err)
+	}
+	return res, nil
+}
+
+// recordIDs returns the distinct record names in rows in first-seen order.
+func recordIDs(rows []map[string]any, idField string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, row := range rows {
+		id := redcap.ValueText(row[idField])
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// state reads the _sync table.
+func (m *Mirror) state(ctx context.Context) (map[string]string, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT key, value FROM _sync`)
+	if err != nil {
+		return nil, fmt.Errorf("reading sync state: %w", err)
+	}
+	defer rows.Close()
+	state := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, fmt.Errorf("reading sync state: %w", err)
+		}
+		state[k] = v
+	}
+	return state, rows.Err()
+}
+
+func metadataHash(fields []redcap.Field) (string, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("marshaling metadata: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// rebuild drops and recreates every table but _sync.
+func rebuild(ctx context.Context, tx *sql.Tx, dict *redcap.Dictionary, project map[string]any, instruments []redcap.Instrument) error {
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name != '_sync'`)
+	if err != nil {
+		return fmt.Errorf("listing tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("listing tables: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	for _, t := range tables {
+		if _, err := tx.ExecContext(ctx, `DROP TABLE `+quote(t)); err != nil {
+			return fmt.Errorf("dropping %s: %w", t, err)
+		}
+	}
+
+	stmts := []string{
+		`CREATE TABLE _project (key TEXT PRIMARY KEY, value TEXT)`,
+		`CREATE TABLE _instruments (instrument_name TEXT PRIMARY KEY, instrument_label TEXT)`,
+		`CREATE TABLE _metadata (
+			field_name TEXT PRIMARY KEY, form_name TEXT, field_order INTEGER,
+			field_type TEXT, column_type TEXT, field_label TEXT, field_note TEXT,
+			section_header TEXT, validation TEXT, validation_min TEXT,
+			validation_max TEXT, calculation TEXT, branching_logic TEXT,
+			required INTEGER, identifier INTEGER, field_annotation TEXT)`,
+		`CREATE TABLE _choices (field_name TEXT, code TEXT, label TEXT, PRIMARY KEY (field_name, code))`,
+		`CREATE TABLE _data (
+			record TEXT NOT NULL, redcap_event_name TEXT,
+			redcap_repeat_instrument TEXT, redcap_repeat_instance INTEGER,
+			field_name TEXT NOT NULL, value)`,
+		`CREATE INDEX _data_record ON _data (record)`,
+		`CREATE INDEX _data_field ON _data (field_name)`,
+	}
+	for _, form := range dict.Forms() {
+		stmts = append(stmts,
+			formTableSQL(dict, form),
+			fmt.Sprintf(`CREATE INDEX %s ON %s (%s)`,
+				quote(form+"_record"), quote(form), quote(dict.RecordIDField)),
+		)
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("creating tables: %w", err)
+		}
+	}
+
+	for k, v := range project {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO _project VALUES (?, ?)`, k, fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("storing project: %w", err)
+		}
+	}
+	for _, in := range instruments {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO _instruments VALUES (?, ?)`, in.Name, in.Label); err != nil {
+			return fmt.Errorf("storing instruments: %w", err)
+		}
+	}
+	for i, f := range dict.Fields {
+		_, err := tx.ExecContext(ctx, `INSERT INTO _metadata VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.Field_name, f.Form_name, i+1, f.Field_type, dict.ColumnType(f.Field_name).String(),
+			f.Field_label, f.Field_note, f.Section_header, f.ValidationType(),
+			f.Text_validation_min, f.Text_validation_max, f.Calculations,
+			f.Branching_logic, f.Required_field, f.Identifier == "y", f.Field_annotation)
+		if err != nil {
+			return fmt.Errorf("storing metadata: %w", err)
+		}
+		for _, ch := range f.Choices {
+			if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO _choices VALUES (?, ?, ?)`, f.Field_name, ch.Code, ch.Label); err != nil {
+				return fmt.Errorf("storing choices: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// formTableSQL returns the CREATE TABLE statement of an instrument table.
+func formTableSQL(dict *redcap.Dictionary, form string) string {
+	cols := []string{
+		quote(dict.RecordIDField) + " TEXT NOT NULL",
+		"redcap_event_name TEXT",
+		"redcap_repeat_instrument TEXT",
+		"redcap_repeat_instance INTEGER",
+	}
+	for _, col := range formColumns(dict, form) {
+		cols = append(cols, quote(col)+" "+sqlType(dict, col))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", quote(form), strings.Join(cols, ",\n\t"))
+}
+
+// formColumns returns an instrument's export columns without the record
+// ID field, which every table starts with.
+func formColumns(dict *redcap.Dictionary, form string) []string {
+	var cols []string
+	for _, col := range dict.FormColumns(form) {
+		if col != dict.RecordIDField {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// sqlType maps a column to a SQLite type. Dates and times are ISO 8601
+// text, which SQLite's date functions accept.
+func sqlType(dict *redcap.Dictionary, col string) string {
+	switch dict.ColumnType(col) {
+	case redcap.ColumnInteger, redcap.ColumnBoolean:
+		return "INTEGER"
+	case redcap.ColumnNumber:
+		return "REAL"
+	case redcap.ColumnCategory:
+		// Choice codes need not be numbers; form status always is
+		if strings.HasSuffix(col, "_complete") {
+			return "INTEGER"
+		}
+	}
+	return "TEXT"
+}
+
+// value converts an exported value for a column of the given type. Empty
+// values are NULL; values that do not parse are stored as text.
+func value(t redcap.ColumnType, v string) any {
+	if v == "" {
+		return nil
+	}
+	switch t {
+	case redcap.ColumnInteger, redcap.ColumnBoolean:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case redcap.ColumnNumber:
+		if n, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
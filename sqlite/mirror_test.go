@@ -0,0 +1,308 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjodo/go-cap"
+)
+
+// fakeProject is an in-memory classic project serving the endpoints Sync
+// uses. Record exports honor records, fields and dateRangeBegin.
+type fakeProject struct {
+	mu       sync.Mutex
+	now      time.Time // the server clock, sent as the Date header
+	fields   []redcap.Field
+	records  []map[string]any
+	modified map[string]time.Time // by record
+	begins   []string             // dateRangeBegin of each record export
+	batches  []string             // records of each filtered record export
+}
+
+func newFakeProject() *fakeProject {
+	return &fakeProject{
+		now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		fields: []redcap.Field{
+			{Field_name: "record_id", Form_name: "demo", Field_type: "text", Field_label: "Record ID"},
+			{Field_name: "name", Form_name: "demo", Field_type: "text", Field_label: "Name"},
+			{Field_name: "age", Form_name: "demo", Field_type: "text", Text_validation_type_or_show_slider_number: "integer"},
+			{Field_name: "race", Form_name: "demo", Field_type: "checkbox", Choices: []redcap.FieldChoice{{ID: 1, Code: "1", Label: "Asian"}, {ID: 2, Code: "2", Label: "White"}}},
+			{Field_name: "weight", Form_name: "visit", Field_type: "text", Text_validation_type_or_show_slider_number: "number"},
+		},
+		modified: make(map[string]time.Time),
+	}
+}
+
+// set adds or replaces a record, modified now. A record with a weight
+// has data on the visit form.
+func (p *fakeProject) set(id, name string, age int, weight string) {
+	row := map[string]any{
+		"record_id": id, "name": name, "age": fmt.Sprint(age),
+		"race___1": "1", "race___2": "0", "demo_complete": "2",
+		"weight": weight, "visit_complete": "0",
+	}
+	p.remove(id)
+	p.records = append(p.records, row)
+	p.modified[id] = p.now
+}
+
+func (p *fakeProject) remove(id string) {
+	p.records = slices.DeleteFunc(p.records, func(r map[string]any) bool { return r["record_id"] == id })
+}
+
+func (p *fakeProject) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w.Header().Set("Date", p.now.Format(http.TimeFormat))
+	reply := func(v any) { json.NewEncoder(w).Encode(v) }
+
+	switch r.FormValue("content") {
+	case "version":
+		w.Write([]byte("14.0.0"))
+	case "metadata":
+		reply(p.fields)
+	case "project":
+		reply([]map[string]any{{"project_id": 7, "project_title": "Test"}})
+	case "instrument":
+		reply([]map[string]string{{"instrument_name": "demo", "instrument_label": "Demo"}, {"instrument_name": "visit", "instrument_label": "Visit"}})
+	case "record":
+		begin := r.FormValue("dateRangeBegin")
+		p.begins = append(p.begins, begin)
+		var since time.Time
+		if begin != "" {
+			since, _ = time.Parse("2006-01-02 15:04:05", begin)
+		}
+		if r.FormValue("records") != "" {
+			p.batches = append(p.batches, r.FormValue("records"))
+		}
+		ids := strings.Split(r.FormValue("records"), ",")
+		fields := strings.Split(r.FormValue("fields"), ",")
+		rows := []map[string]any{}
+		for _, row := range p.records {
+			id := row["record_id"].(string)
+			if r.FormValue("records") != "" && !slices.Contains(ids, id) || p.modified[id].Before(since) {
+				continue
+			}
+			out := make(map[string]any)
+			for k, v := range row {
+				if r.FormValue("fields") == "" || slices.Contains(fields, k) {
+					out[k] = v
+				}
+			}
+			rows = append(rows, out)
+		}
+		reply(rows)
+	default:
+		http.Error(w, `{"error":"unsupported request"}`, http.StatusBadRequest)
+	}
+}
+
+func newTestClient(t *testing.T, h http.Handler) *redcap.Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := redcap.NewClient(srv.URL, "ABCDEF0123456789ABCDEF0123456789",
+		redcap.WithRetryDelay(time.Millisecond),
+		redcap.WithRateLimiter(redcap.NewRateLimiter(1000, 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func openMirror(t *testing.T) *Mirror {
+	t.Helper()
+	m, err := Open(filepath.Join(t.TempDir(), "study.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// query returns the rows of a query as text.
+func query(t *testing.T, m *Mirror, q string, args ...any) []string {
+	t.Helper()
+	rows, err := m.DB().Query(q, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	var out []string
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		parts := make([]string, len(vals))
+		for i, v := range vals {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			parts[i] = fmt.Sprint(v)
+		}
+		out = append(out, strings.Join(parts, "|"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSyncSchema(t *testing.T) {
+	p := newFakeProject()
+	p.set("1", "Ann", 41, "70.5")
+	m := openMirror(t)
+	if _, err := m.Sync(context.Background(), newTestClient(t, p), Options{Location: time.UTC}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := query(t, m, `SELECT name, type FROM pragma_table_info('demo')`)
+	want := []string{
+		"record_id|TEXT", "redcap_event_name|TEXT", "redcap_repeat_instrument|TEXT", "redcap_repeat_instance|INTEGER",
+		"name|TEXT", "age|INTEGER", "race___1|INTEGER", "race___2|INTEGER", "demo_complete|INTEGER",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("demo columns = %v, want %v", got, want)
+	}
+	if got := query(t, m, `SELECT type FROM pragma_table_info('visit') WHERE name = 'weight'`); !slices.Equal(got, []string{"REAL"}) {
+		t.Errorf("weight type = %v, want REAL", got)
+	}
+	tables := query(t, m, `SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name`)
+	for _, name := range []string{"_choices", "_data", "_instruments", "_metadata", "_project", "_sync", "demo", "visit"} {
+		if !slices.Contains(tables, name) {
+			t.Errorf("no table %s in %v", name, tables)
+		}
+	}
+	if got := query(t, m, `SELECT field_name, code, label FROM _choices ORDER BY code`); !slices.Equal(got, []string{"race|1|Asian", "race|2|White"}) {
+		t.Errorf("_choices = %v", got)
+	}
+	if got := query(t, m, `SELECT column_type FROM _metadata WHERE field_name = 'age'`); !slices.Equal(got, []string{"integer"}) {
+		t.Errorf("age column type = %v", got)
+	}
+}
+
+func TestSyncFullAndIncremental(t *testing.T) {
+	p := newFakeProject()
+	for i := 1; i <= 5; i++ {
+		weight := ""
+		if i%2 == 1 {
+			weight = fmt.Sprint(60 + i)
+		}
+		p.set(fmt.Sprint(i), fmt.Sprintf("name %d", i), 30+i, weight)
+	}
+	// Records were last changed well before the first sync
+	p.now = p.now.Add(2 * time.Hour)
+	c := newTestClient(t, p)
+	m := openMirror(t)
+	ctx := context.Background()
+	opts := Options{Location: time.UTC, BatchSize: 2}
+
+	res, err := m.Sync(ctx, c, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Full || res.Records != 5 || !slices.Equal(res.Tables, []string{"demo", "visit"}) {
+		t.Fatalf("first sync = %+v", res)
+	}
+	if d := p.now.Sub(res.Mark); d < 0 || d > time.Second {
+		t.Errorf("mark %v is not the server time %v", res.Mark, p.now)
+	}
+	// The full sync exports record names, then batches of two
+	if want := []string{"1,2", "3,4", "5"}; !slices.Equal(p.batches, want) {
+		t.Errorf("record batches = %v, want %v", p.batches, want)
+	}
+	if got := query(t, m, `SELECT record_id, name, age FROM demo ORDER BY record_id`); len(got) != 5 || got[0] != "1|name 1|31" {
+		t.Errorf("demo = %v", got)
+	}
+	// Only records with visit data have a visit row
+	if got := query(t, m, `SELECT record_id, weight FROM visit ORDER BY record_id`); !slices.Equal(got, []string{"1|61", "3|63", "5|65"}) {
+		t.Errorf("visit = %v", got)
+	}
+
+	// Record 2 changes, 6 is created and 3 is deleted on the server
+	p.mu.Lock()
+	p.now = p.now.Add(time.Hour)
+	p.set("2", "renamed", 32, "72")
+	p.set("6", "name 6", 36, "")
+	p.remove("3")
+	p.batches = nil
+	p.mu.Unlock()
+
+	mark := res.Mark
+	res, err = m.Sync(ctx, c, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Full || res.Records != 2 || !res.Since.Equal(mark.Add(-redcap.DefaultOverlap)) {
+		t.Fatalf("incremental sync = %+v, want records 2 since %v", res, mark.Add(-redcap.DefaultOverlap))
+	}
+	if got, want := p.begins[len(p.begins)-1], res.Since.Format("2006-01-02 15:04:05"); got != want {
+		t.Errorf("dateRangeBegin = %q, want %q", got, want)
+	}
+	if len(p.batches) != 0 {
+		t.Errorf("incremental sync exported batches %v", p.batches)
+	}
+	got := query(t, m, `SELECT record_id, name FROM demo ORDER BY record_id`)
+	if want := []string{"1|name 1", "2|renamed", "3|name 3", "4|name 4", "5|name 5", "6|name 6"}; !slices.Equal(got, want) {
+		t.Errorf("demo after upsert = %v, want %v", got, want)
+	}
+	if got := query(t, m, `SELECT record_id, weight FROM visit ORDER BY record_id`); !slices.Equal(got, []string{"1|61", "2|72", "3|63", "5|65"}) {
+		t.Errorf("visit after upsert = %v", got)
+	}
+	if got := query(t, m, `SELECT value FROM _data WHERE record = '2' AND field_name = 'name'`); !slices.Equal(got, []string{"renamed"}) {
+		t.Errorf("_data for record 2 = %v", got)
+	}
+
+	// Deleted records are removed by a full sync
+	opts.Full = true
+	if res, err = m.Sync(ctx, c, opts); err != nil || !res.Full || res.Records != 5 {
+		t.Fatalf("full sync = %+v, %v", res, err)
+	}
+	if got := query(t, m, `SELECT record_id FROM demo ORDER BY record_id`); !slices.Equal(got, []string{"1", "2", "4", "5", "6"}) {
+		t.Errorf("demo after full sync = %v", got)
+	}
+	if got := query(t, m, `SELECT COUNT(*) FROM _data WHERE record = '3'`); !slices.Equal(got, []string{"0"}) {
+		t.Errorf("_data rows of deleted record 3 = %v", got)
+	}
+}
+
+func TestSyncRebuildsOnDictionaryChange(t *testing.T) {
+	p := newFakeProject()
+	p.set("1", "Ann", 41, "")
+	c := newTestClient(t, p)
+	m := openMirror(t)
+	ctx := context.Background()
+
+	if _, err := m.Sync(ctx, c, Options{Location: time.UTC}); err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.fields = append(p.fields, redcap.Field{Field_name: "height", Form_name: "visit", Field_type: "text"})
+	p.mu.Unlock()
+
+	res, err := m.Sync(ctx, c, Options{Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Full {
+		t.Error("sync after a dictionary change was not full")
+	}
+	if got := query(t, m, `SELECT name FROM pragma_table_info('visit') WHERE name = 'height'`); len(got) != 1 {
+		t.Error("visit table has no height column")
+	}
+}
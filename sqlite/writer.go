@@ -0,0 +1,173 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/cjodo/go-cap"
+)
+
+// writer inserts flat export rows into the instrument tables and _data
+// with statements prepared once per sync.
+type writer struct {
+	dict    *redcap.Dictionary
+	forms   []formTable
+	data    *sql.Stmt
+	deletes []*sql.Stmt
+}
+
+type formTable struct {
+	name    string
+	columns []string
+	insert  *sql.Stmt
+}
+
+func newWriter(ctx context.Context, tx *sql.Tx, dict *redcap.Dictionary) (*writer, error) {
+	w := &writer{dict: dict}
+	prepare := func(query string) (*sql.Stmt, error) {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			w.close()
+			return nil, fmt.Errorf("preparing statement: %w", err)
+		}
+		return stmt, nil
+	}
+
+	var err error
+	if w.data, err = prepare(`INSERT INTO _data VALUES (?, ?, ?, ?, ?, ?)`); err != nil {
+		return nil, err
+	}
+	del, err := prepare(`DELETE FROM _data WHERE record = ?`)
+	if err != nil {
+		return nil, err
+	}
+	w.deletes = append(w.deletes, del)
+
+	for _, form := range dict.Forms() {
+		ft := formTable{name: form, columns: formColumns(dict, form)}
+		names := []string{quote(dict.RecordIDField), "redcap_event_name", "redcap_repeat_instrument", "redcap_repeat_instance"}
+		for _, col := range ft.columns {
+			names = append(names, quote(col))
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+		if ft.insert, err = prepare(fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`,
+			quote(form), strings.Join(names, ", "), marks)); err != nil {
+			return nil, err
+		}
+		del, err := prepare(fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, quote(form), quote(dict.RecordIDField)))
+		if err != nil {
+			return nil, err
+		}
+		w.deletes = append(w.deletes, del)
+		w.forms = append(w.forms, ft)
+	}
+	return w, nil
+}
+
+// close closes the prepared statements. It is safe to call twice.
+func (w *writer) close() {
+	if w.data != nil {
+		w.data.Close()
+		w.data = nil
+	}
+	for _, s := range w.deletes {
+		s.Close()
+	}
+	w.deletes = nil
+	for i := range w.forms {
+		if w.forms[i].insert != nil {
+			w.forms[i].insert.Close()
+			w.forms[i].insert = nil
+		}
+	}
+}
+
+// deleteRecord removes every row of a record.
+func (w *writer) deleteRecord(ctx context.Context, id string) error {
+	for _, s := range w.deletes {
+		if _, err := s.ExecContext(ctx, id); err != nil {
+			return fmt.Errorf("deleting record %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// insertRows stores the rows of an export.
+func (w *writer) insertRows(ctx context.Context, rows []map[string]any) error {
+	for _, row := range rows {
+		if err := w.insert(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert stores one export row. A row goes into an instrument table when
+// it is that instrument's repeat instance, or when it is not a repeat
+// instance and has data on the instrument.
+func (w *writer) insert(ctx context.Context, row map[string]any) error {
+	id := redcap.ValueText(row[w.dict.RecordIDField])
+	event := redcap.ValueText(row["redcap_event_name"])
+	repeatForm := redcap.ValueText(row["redcap_repeat_instrument"])
+	instance := value(redcap.ColumnInteger, redcap.ValueText(row["redcap_repeat_instance"]))
+
+	for _, ft := range w.forms {
+		if repeatForm != "" && repeatForm != ft.name {
+			continue
+		}
+		if repeatForm == "" && !w.dict.HasData(row, ft.columns) {
+			continue
+		}
+		args := []any{id, nullable(event), nullable(repeatForm), instance}
+		for _, col := range ft.columns {
+			args = append(args, value(w.dict.ColumnType(col), redcap.ValueText(row[col])))
+		}
+		if _, err := ft.insert.ExecContext(ctx, args...); err != nil {
+			return fmt.Errorf("inserting record %s into %s: %w", id, ft.name, err)
+		}
+	}
+
+	for col, v := range row {
+		s := redcap.ValueText(v)
+		if s == "" || col == w.dict.RecordIDField || w.dict.IsSpecialColumn(col) && !strings.HasSuffix(col, "_complete") {
+			continue
+		}
+		f, ok := w.dict.Field(col)
+		if !ok && !strings.HasSuffix(col, "_complete") {
+			continue
+		}
+		field, stored := col, value(w.dict.ColumnType(col), s)
+		// Checkboxes are stored as REDCap's EAV export does: one row per
+		// checked choice, holding the choice code
+		if ok && f.Field_type == "checkbox" {
+			if s != "1" {
+				continue
+			}
+			_, code, _ := redcap.SplitCheckbox(col)
+			field, stored = f.Field_name, choiceCode(f, code)
+		}
+		if _, err := w.data.ExecContext(ctx, id, nullable(event), nullable(repeatForm), instance, field, stored); err != nil {
+			return fmt.Errorf("inserting record %s into _data: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// choiceCode maps a checkbox column suffix back to the choice code.
+func choiceCode(f *redcap.Field, suffix string) string {
+	for _, c := range f.Choices {
+		if redcap.CheckboxColumn(f.Field_name, c.Code) == f.Field_name+"___"+suffix {
+			return c.Code
+		}
+	}
+	return suffix
+}
+
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,236 @@
+package redcap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// InvitationStatus is the state of a participant's survey invitation.
+type InvitationStatus int
+
+const (
+	InvitationNotSent InvitationStatus = iota
+	InvitationScheduled
+	InvitationSent
+)
+
+func (s InvitationStatus) String() string {
+	switch s {
+	case InvitationNotSent:
+		return "not sent"
+	case InvitationScheduled:
+		return "scheduled"
+	case InvitationSent:
+		return "sent"
+	}
+	return fmt.Sprintf("InvitationStatus(%d)", int(s))
+}
+
+// MarshalText encodes the status as its String form.
+func (s InvitationStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ResponseStatus is how far a participant got through a survey.
+type ResponseStatus int
+
+const (
+	ResponseNotStarted ResponseStatus = iota
+	ResponsePartial
+	ResponseComplete
+)
+
+func (s ResponseStatus) String() string {
+	switch s {
+	case ResponseNotStarted:
+		return "not started"
+	case ResponsePartial:
+		return "partial"
+	case ResponseComplete:
+		return "complete"
+	}
+	return fmt.Sprintf("ResponseStatus(%d)", int(s))
+}
+
+// MarshalText encodes the status as its String form.
+func (s ResponseStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SurveyParticipant is one entry of a survey's participant list.
+type SurveyParticipant struct {
+	Email string `json:"email"`
+	// EmailOccurrence numbers participants sharing an email address.
+	EmailOccurrence int    `json:"email_occurrence"`
+	Identifier      string `json:"identifier"`
+	// Record is empty for participants who have not responded to a
+	// public survey.
+	Record     string           `json:"record"`
+	Invitation InvitationStatus `json:"invitation"`
+	// InvitationSendTime is the server-local time the invitation was or
+	// will be sent, as REDCap formats it.
+	InvitationSendTime string         `json:"invitation_send_time"`
+	Response           ResponseStatus `json:"response"`
+	AccessCode         string         `json:"survey_access_code"`
+	Link               string         `json:"survey_link"`
+	QueueLink          string         `json:"survey_queue_link"`
+}
+
+// participantJSON is the shape of a participant in REDCap's participant
+// list export, which sends numbers as strings on some versions.
+type participantJSON struct {
+	Email              jsonText `json:"email"`
+	EmailOccurrence    jsonText `json:"email_occurrence"`
+	Identifier         jsonText `json:"identifier"`
+	Record             jsonText `json:"record"`
+	ScheduledStatus    jsonText `json:"invitation_scheduled_status"`
+	SentStatus         jsonText `json:"invitation_sent_status"`
+	InvitationSendTime jsonText `json:"invitation_send_time"`
+	ResponseStatus     jsonText `json:"response_status"`
+	AccessCode         jsonText `json:"survey_access_code"`
+	Link               jsonText `json:"survey_link"`
+	QueueLink          jsonText `json:"survey_queue_link"`
+}
+
+// UnmarshalJSON decodes a participant from REDCap's participant list,
+// folding the scheduled and sent flags into Invitation.
+func (p *SurveyParticipant) UnmarshalJSON(data []byte) error {
+	var raw participantJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*p = SurveyParticipant{
+		Email:              string(raw.Email),
+		Identifier:         string(raw.Identifier),
+		Record:             string(raw.Record),
+		InvitationSendTime: string(raw.InvitationSendTime),
+		AccessCode:         string(raw.AccessCode),
+		Link:               string(raw.Link),
+		QueueLink:          string(raw.QueueLink),
+	}
+	p.EmailOccurrence, _ = strconv.Atoi(string(raw.EmailOccurrence))
+	switch {
+	case raw.SentStatus == "1":
+		p.Invitation = InvitationSent
+	case raw.ScheduledStatus == "1":
+		p.Invitation = InvitationScheduled
+	}
+	if n, err := strconv.Atoi(string(raw.ResponseStatus)); err == nil {
+		p.Response = ResponseStatus(n)
+	}
+	return nil
+}
+
+// jsonText decodes a JSON string, number or null as text.
+type jsonText string
+
+func (t *jsonText) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*t = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*t = jsonText(s)
+		return nil
+	}
+	*t = jsonText(data)
+	return nil
+}
+
+// SurveyOption sets the event or repeat instance of a survey call, for
+// longitudinal projects and repeating surveys.
+type SurveyOption func(map[string]string)
+
+// SurveyEvent selects the unique event name of a longitudinal project.
+func SurveyEvent(event string) SurveyOption {
+	return func(p map[string]string) {
+		if event != "" {
+			p["event"] = event
+		}
+	}
+}
+
+// SurveyRepeatInstance selects the instance of a repeating survey. REDCap
+// uses instance 1 when it is not given.
+func SurveyRepeatInstance(n int) SurveyOption {
+	return func(p map[string]string) {
+		if n > 0 {
+			p["repeat_instance"] = strconv.Itoa(n)
+		}
+	}
+}
+
+// ExportSurveyLink returns the survey link of a record's instrument.
+func (c *Client) ExportSurveyLink(ctx context.Context, record, instrument string, opts ...SurveyOption) (string, error) {
+	return c.surveyText(ctx, "surveyLink", record, instrument, opts)
+}
+
+// ExportSurveyQueueLink returns the survey queue link of a record. The
+// project must have the survey queue enabled.
+func (c *Client) ExportSurveyQueueLink(ctx context.Context, record string) (string, error) {
+	return c.surveyText(ctx, "surveyQueueLink", record, "", nil)
+}
+
+// ExportSurveyReturnCode returns the code a participant needs to resume a
+// record's survey. The survey must have "Save & Return Later" enabled.
+func (c *Client) ExportSurveyReturnCode(ctx context.Context, record, instrument string, opts ...SurveyOption) (string, error) {
+	return c.surveyText(ctx, "surveyReturnCode", record, instrument, opts)
+}
+
+// ExportSurveyAccessCode returns the access code that opens a record's
+// survey from the survey access page.
+func (c *Client) ExportSurveyAccessCode(ctx context.Context, record, instrument string, opts ...SurveyOption) (string, error) {
+	return c.surveyText(ctx, "surveyAccessCode", record, instrument, opts)
+}
+
+// surveyText calls a survey endpoint that answers with plain text.
+func (c *Client) surveyText(ctx context.Context, content, record, instrument string, opts []SurveyOption) (string, error) {
+	params := map[string]string{
+		"record": record,
+	}
+	if instrument != "" {
+		params["instrument"] = instrument
+	}
+	for _, opt := range opts {
+		opt(params)
+	}
+
+	body, err := c.Request(ctx, content, params)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// ExportSurveyParticipants returns the participant list of a survey. The
+// event option is required for longitudinal projects.
+func (c *Client) ExportSurveyParticipants(ctx context.Context, instrument string, opts ...SurveyOption) ([]SurveyParticipant, error) {
+	params := map[string]string{
+		"format":     "json",
+		"instrument": instrument,
+	}
+	for _, opt := range opts {
+		opt(params)
+	}
+
+	body, err := c.Request(ctx, "participantList", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var participants []SurveyParticipant
+	if err := json.Unmarshal(body, &participants); err != nil {
+		return nil, fmt.Errorf("unmarshaling survey participants: %w", err)
+	}
+
+	return participants, nil
+}
@@ -0,0 +1,49 @@
+package redcap
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSurveyParticipantUnmarshal(t *testing.T) {
+	// Versions differ in sending statuses as numbers or strings
+	data := `[
+		{"email":"ann@example.edu","email_occurrence":1,"identifier":"A","record":"1",
+		 "invitation_scheduled_status":0,"invitation_sent_status":1,"invitation_send_time":"2024-05-01 09:00:00",
+		 "response_status":2,"survey_access_code":"KX7","survey_link":"https://redcap.example.edu/surveys/?s=KX7",
+		 "survey_queue_link":"https://redcap.example.edu/surveys/?sq=Q1"},
+		{"email":"bo@example.edu","email_occurrence":"2","identifier":"","record":"",
+		 "invitation_scheduled_status":"1","invitation_sent_status":"0","invitation_send_time":"2024-06-01 09:00:00",
+		 "response_status":"1","survey_access_code":"M3P","survey_link":"","survey_queue_link":null},
+		{"email":"","email_occurrence":null,"identifier":null,"record":null,
+		 "invitation_scheduled_status":"0","invitation_sent_status":0,"invitation_send_time":"",
+		 "response_status":"","survey_access_code":"","survey_link":"","survey_queue_link":""}
+	]`
+	var ps []SurveyParticipant
+	if err := json.Unmarshal([]byte(data), &ps); err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 3 {
+		t.Fatalf("%d participants, want 3", len(ps))
+	}
+
+	ann, bo, blank := ps[0], ps[1], ps[2]
+	if ann.Email != "ann@example.edu" || ann.EmailOccurrence != 1 || ann.Record != "1" || ann.AccessCode != "KX7" {
+		t.Errorf("participant = %+v", ann)
+	}
+	if ann.Invitation != InvitationSent || ann.Response != ResponseComplete {
+		t.Errorf("invitation %v, response %v; want sent, complete", ann.Invitation, ann.Response)
+	}
+	if ann.InvitationSendTime != "2024-05-01 09:00:00" || ann.QueueLink != "https://redcap.example.edu/surveys/?sq=Q1" {
+		t.Errorf("send time %q, queue link %q", ann.InvitationSendTime, ann.QueueLink)
+	}
+	if bo.EmailOccurrence != 2 || bo.Invitation != InvitationScheduled || bo.Response != ResponsePartial {
+		t.Errorf("email_occurrence %d, invitation %v, response %v", bo.EmailOccurrence, bo.Invitation, bo.Response)
+	}
+	if bo.QueueLink != "" {
+		t.Errorf("queue link = %q, want empty for null", bo.QueueLink)
+	}
+	if blank != (SurveyParticipant{}) {
+		t.Errorf("blank participant = %+v, want zero", blank)
+	}
+}
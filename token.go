@@ -0,0 +1,470 @@
+package redcap
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// TokenEnvVars are the environment variables EnvToken checks by default.
+var TokenEnvVars = []string{"REDCAP_TOKEN", "CAP_TOKEN"}
+
+var tokenRe = regexp.MustCompile(`^(?:[0-9A-Fa-f]{32}|[0-9A-Fa-f]{64})$`)
+
+// ValidateToken checks that tok looks like a REDCap API token: 32 hex
+// characters, or 64 for a super token.
+func ValidateToken(tok string) error {
+	if !tokenRe.MatchString(tok) {
+		return fmt.Errorf("%w: expected 32 or 64 hex characters, got %d characters", ErrInvalidToken, len(tok))
+	}
+	return nil
+}
+
+// TokenSource supplies the API token. The client asks for it on every
+// request, so a source that re-reads its backing store picks up rotated
+// tokens without restarting.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc adapts a function to the TokenSource interface.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token implements TokenSource.
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// WithTokenSource makes the client resolve its token from ts instead of
+// the token passed to NewClient.
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *Client) error {
+		c.tokenSource = ts
+		return nil
+	}
+}
+
+// StaticToken returns a TokenSource that always returns tok.
+func StaticToken(tok string) TokenSource {
+	return TokenSourceFunc(func(context.Context) (string, error) {
+		return tok, nil
+	})
+}
+
+// EnvToken reads the token from the first set environment variable in
+// names, or from TokenEnvVars if names is empty.
+func EnvToken(names ...string) TokenSource {
+	if len(names) == 0 {
+		names = TokenEnvVars
+	}
+	return TokenSourceFunc(func(context.Context) (string, error) {
+		for _, name := range names {
+			if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("no token in environment (%s)", strings.Join(names, ", "))
+	})
+}
+
+// FileToken reads the token from a file. The file must not be readable
+// or writable by group or others.
+func FileToken(path string) TokenSource {
+	return TokenSourceFunc(func(context.Context) (string, error) {
+		if err := checkPrivate(path); err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading token file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	})
+}
+
+// CommandToken runs a command, such as `pass show redcap/study1`, and
+// uses the first line of its output as the token.
+func CommandToken(name string, args ...string) TokenSource {
+	return TokenSourceFunc(func(ctx context.Context) (string, error) {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("running token command %s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+		}
+		line, _, _ := strings.Cut(string(out), "\n")
+		return strings.TrimSpace(line), nil
+	})
+}
+
+// CachedToken wraps a source so it is consulted at most once per ttl.
+// Use it for sources that are slow to query, such as CommandToken.
+func CachedToken(ts TokenSource, ttl time.Duration) TokenSource {
+	var (
+		mu      sync.Mutex
+		tok     string
+		fetched time.Time
+	)
+	return TokenSourceFunc(func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if tok != "" && time.Since(fetched) < ttl {
+			return tok, nil
+		}
+		t, err := ts.Token(ctx)
+		if err != nil {
+			return "", err
+		}
+		tok, fetched = t, time.Now()
+		return tok, nil
+	})
+}
+
+// resolveToken returns the token for the next request. A token passed to
+// NewClient is sent as is; one from a TokenSource is validated, since a
+// misconfigured file or command yields arbitrary text.
+func (c *Client) resolveToken(ctx context.Context) (string, error) {
+	if c.tokenSource == nil {
+		return c.token, nil
+	}
+	tok, err := c.tokenSource.Token(ctx)
+	if err != nil {
+		return "", &Error{
+			Code:    ErrCodeUnauthorized,
+			Message: "resolving token: " + err.Error(),
+			Kind:    ErrInvalidToken,
+			Err:     err,
+		}
+	}
+	if err := ValidateToken(tok); err != nil {
+		return "", &Error{
+			Code:    ErrCodeUnauthorized,
+			Message: err.Error(),
+			Kind:    ErrInvalidToken,
+			Err:     err,
+		}
+	}
+	return tok, nil
+}
+
+func checkPrivate(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s has mode %04o; it must not be accessible by group or others (chmod 600)", path, info.Mode().Perm())
+	}
+	return nil
+}
+
+// TokenStore is a local file of named tokens encrypted with a passphrase
+// (scrypt key derivation, NaCl secretbox).
+type TokenStore struct {
+	path string
+	key  [32]byte
+	file tokenStoreFile
+}
+
+type tokenStoreFile struct {
+	Version int               `json:"version"`
+	Salt    string            `json:"salt"`
+	Tokens  map[string]string `json:"tokens"`
+}
+
+// ErrWrongPassphrase is returned when a token store cannot be decrypted.
+var ErrWrongPassphrase = errors.New("redcap: wrong token store passphrase")
+
+// OpenTokenStore opens the store at path, creating an empty one in memory
+// if the file does not exist yet. Call Save to write it.
+func OpenTokenStore(path string, passphrase []byte) (*TokenStore, error) {
+	s, err := loadTokenStore(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unlock(passphrase); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadTokenStore reads the store at path, or creates an empty one in
+// memory, without deriving its key.
+func loadTokenStore(path string) (*TokenStore, error) {
+	s := &TokenStore{path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		s.file = tokenStoreFile{
+			Version: 1,
+			Salt:    base64.StdEncoding.EncodeToString(salt),
+			Tokens:  make(map[string]string),
+		}
+	case err != nil:
+		return nil, fmt.Errorf("reading token store: %w", err)
+	default:
+		if err := checkPrivate(path); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &s.file); err != nil {
+			return nil, fmt.Errorf("unmarshaling token store: %w", err)
+		}
+		if s.file.Tokens == nil {
+			s.file.Tokens = make(map[string]string)
+		}
+	}
+	return s, nil
+}
+
+// unlock derives the store's key from passphrase.
+func (s *TokenStore) unlock(passphrase []byte) error {
+	salt, err := base64.StdEncoding.DecodeString(s.file.Salt)
+	if err != nil {
+		return fmt.Errorf("decoding token store salt: %w", err)
+	}
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return err
+	}
+	copy(s.key[:], key)
+
+	// Fail early on a wrong passphrase rather than on first use
+	for name := range s.file.Tokens {
+		if _, err := s.Get(name); err != nil {
+			return err
+		}
+		break
+	}
+	return nil
+}
+
+// Get decrypts the named token.
+func (s *TokenStore) Get(name string) (string, error) {
+	enc, ok := s.file.Tokens[name]
+	if !ok {
+		return "", fmt.Errorf("no token %q in store", name)
+	}
+	box, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil || len(box) < 24 {
+		return "", fmt.Errorf("token %q is corrupt", name)
+	}
+	var nonce [24]byte
+	copy(nonce[:], box[:24])
+	plain, ok := secretbox.Open(nil, box[24:], &nonce, &s.key)
+	if !ok {
+		return "", ErrWrongPassphrase
+	}
+	return string(plain), nil
+}
+
+// Set encrypts and stores a token under name.
+func (s *TokenStore) Set(name, token string) error {
+	if err := ValidateToken(token); err != nil {
+		return err
+	}
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	box := secretbox.Seal(nonce[:], []byte(token), &nonce, &s.key)
+	s.file.Tokens[name] = base64.StdEncoding.EncodeToString(box)
+	return nil
+}
+
+// Delete removes the named token.
+func (s *TokenStore) Delete(name string) {
+	delete(s.file.Tokens, name)
+}
+
+// Names returns the names of the stored tokens.
+func (s *TokenStore) Names() []string {
+	names := make([]string, 0, len(s.file.Tokens))
+	for name := range s.file.Tokens {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Save writes the store to disk with mode 0600.
+func (s *TokenStore) Save() error {
+	data, err := json.MarshalIndent(s.file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling token store: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing token store: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// StoreToken returns a TokenSource that reads the named token from the
+// encrypted store at path on every call. The key is derived, asking
+// passphrase for the passphrase, on the first call and kept until the
+// store is re-created with a new salt, since derivation is deliberately
+// slow.
+func StoreToken(path, name string, passphrase func() ([]byte, error)) TokenSource {
+	var (
+		mu   sync.Mutex
+		salt string
+		key  [32]byte
+	)
+	return TokenSourceFunc(func(context.Context) (string, error) {
+		s, err := loadTokenStore(path)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if salt != "" && s.file.Salt == salt {
+			s.key = key
+			return s.Get(name)
+		}
+		pass, err := passphrase()
+		if err != nil {
+			return "", err
+		}
+		if err := s.unlock(pass); err != nil {
+			return "", err
+		}
+		salt, key = s.file.Salt, s.key
+		return s.Get(name)
+	})
+}
+
+// TokenSpec names where a profile's token comes from. Exactly one field
+// should be set; it is the serializable form of a TokenSource.
+type TokenSpec struct {
+	Env  string `json:"env,omitempty" yaml:"env,omitempty"`
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	// Command is split into arguments like a shell would, honoring single
+	// and double quotes and backslash escapes, but is not run by a shell:
+	// there are no pipes, variables or globs.
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	Store   string `json:"store,omitempty" yaml:"store,omitempty"`
+	// Key is the token's name within Store; it defaults to the profile name.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// Source builds the TokenSource described by the spec. passphrase is only
+// used for Store specs.
+func (s TokenSpec) Source(name string, passphrase func() ([]byte, error)) (TokenSource, error) {
+	switch {
+	case s.Env != "":
+		return EnvToken(s.Env), nil
+	case s.File != "":
+		return FileToken(expandHome(s.File)), nil
+	case s.Command != "":
+		argv, err := splitCommand(s.Command)
+		if err != nil {
+			return nil, fmt.Errorf("token command: %w", err)
+		}
+		if len(argv) == 0 {
+			return nil, errors.New("token command is blank")
+		}
+		return CachedToken(CommandToken(argv[0], argv[1:]...), 5*time.Minute), nil
+	case s.Store != "":
+		if passphrase == nil {
+			return nil, fmt.Errorf("token store %s needs a passphrase", s.Store)
+		}
+		key := s.Key
+		if key == "" {
+			key = name
+		}
+		return CachedToken(StoreToken(expandHome(s.Store), key, passphrase), 5*time.Minute), nil
+	}
+	return nil, errors.New("empty token spec")
+}
+
+// splitCommand splits a command line into arguments. Single quotes keep
+// everything literally; in double quotes and unquoted text a backslash
+// escapes the next character.
+func splitCommand(line string) ([]string, error) {
+	var (
+		argv    []string
+		arg     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				argv = append(argv, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", line)
+	}
+	if inArg {
+		argv = append(argv, arg.String())
+	}
+	return argv, nil
+}
+
+// PassphraseFromEnv returns a passphrase func reading the named variable.
+func PassphraseFromEnv(name string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("%s is not set", name)
+		}
+		return []byte(v), nil
+	}
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + string(os.PathSeparator) + rest
+		}
+	}
+	return path
+}
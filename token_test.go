@@ -0,0 +1,148 @@
+package redcap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"pass show redcap/study1", []string{"pass", "show", "redcap/study1"}},
+		{`  op read  "op://Vault/REDCap Study/token" `, []string{"op", "read", "op://Vault/REDCap Study/token"}},
+		{`sh -c 'echo "$T"'`, []string{"sh", "-c", `echo "$T"`}},
+		{`cat my\ token.txt`, []string{"cat", "my token.txt"}},
+		{`printf '' ""`, []string{"printf", "", ""}},
+		{"", nil},
+		{" \t ", nil},
+	}
+	for _, tt := range tests {
+		got, err := splitCommand(tt.in)
+		if err != nil {
+			t.Errorf("splitCommand(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`echo 'open`, `echo "open`, `echo \`} {
+		if _, err := splitCommand(bad); err == nil {
+			t.Errorf("splitCommand(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestTokenSpecSource(t *testing.T) {
+	if _, err := (TokenSpec{Command: "   "}).Source("p", nil); err == nil {
+		t.Error("blank command accepted")
+	}
+	if _, err := (TokenSpec{}).Source("p", nil); err == nil {
+		t.Error("empty spec accepted")
+	}
+	if _, err := (TokenSpec{Store: "tokens.enc"}).Source("p", nil); err == nil {
+		t.Error("store without a passphrase accepted")
+	}
+
+	src, err := TokenSpec{Command: `echo "  ABC 123  "`}.Source("p", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := src.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok != "ABC 123" {
+		t.Errorf("token = %q, want the quoted argument, trimmed", tok)
+	}
+
+	t.Setenv("CAP_TEST_TOKEN", "XYZ")
+	src, _ = TokenSpec{Env: "CAP_TEST_TOKEN"}.Source("p", nil)
+	if tok, err := src.Token(context.Background()); err != nil || tok != "XYZ" {
+		t.Errorf("env token = %q, %v", tok, err)
+	}
+}
+
+func TestPlainTokenNotValidated(t *testing.T) {
+	const tok = "legacy-token"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("token"); got != tok {
+			t.Errorf("token = %q, want %q", got, tok)
+		}
+		w.Write([]byte("14.0.0"))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Request(context.Background(), "version", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A token from a source is checked before it is sent
+	c, _ = NewClient(srv.URL, "", WithTokenSource(StaticToken(tok)))
+	if _, err := c.Request(context.Background(), "version", nil); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestStoreTokenDerivesKeyOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := OpenTokenStore(path, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("study1", testToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	var asked int
+	src := StoreToken(path, "study1", func() ([]byte, error) {
+		asked++
+		return []byte("secret"), nil
+	})
+	for range 3 {
+		if tok, err := src.Token(context.Background()); err != nil || tok != testToken {
+			t.Fatalf("token = %q, %v", tok, err)
+		}
+	}
+	if asked != 1 {
+		t.Errorf("passphrase asked %d times, want 1", asked)
+	}
+
+	// A rotated token is read with the kept key
+	rotated := strings.Repeat("B", 32)
+	if err := s.Set("study1", rotated); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := src.Token(context.Background()); err != nil || tok != rotated {
+		t.Errorf("rotated token = %q, %v", tok, err)
+	}
+
+	// A store re-created with a new salt asks again
+	os.Remove(path)
+	s, _ = OpenTokenStore(path, []byte("secret"))
+	s.Set("study1", testToken)
+	s.Save()
+	if _, err := src.Token(context.Background()); err != nil || asked != 2 {
+		t.Errorf("new store: asked %d times, %v", asked, err)
+	}
+}
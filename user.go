@@ -1,17 +1,394 @@
 package redcap
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// User is a project user and their rights, as exported by ExportUsers and
+// imported by ImportUsers.
 type User struct {
-	Username        string `json:"username"`
-	Email           string `json:"email"`
-	FirstName       string `json:"firstname"`
-	LastName        string `json:"lastname"`
-	RoleID          int    `json:"role_id"`
-	RoleLabel       string `json:"role_label"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	// RoleID and RoleLabel are set by REDCap versions that include the
+	// user's role in the user export; use ExportUserRoleMapping otherwise.
+	RoleID    int    `json:"role_id"`
+	RoleLabel string `json:"role_label"`
+	// DataAccessGroup is the unique name of the user's DAG, if any.
 	DataAccessGroup string `json:"data_access_group"`
-	Expiration      string `json:"expiration"`
-	LastLogin       string `json:"last_login"`
-	APIExport       bool   `json:"api_export"`
-	APIImport       bool   `json:"api_import"`
-	APIProject      bool   `json:"api_project"`
-	MobileApp       bool   `json:"mobile_app"`
+	// Expiration is the date the user's access ends, "2006-01-02", or
+	// empty for no expiration.
+	Expiration string `json:"expiration"`
+	LastLogin  string `json:"last_login"`
+	// APIProject is the API project-creation right of REDCap versions
+	// that export it. It is not sent on import.
+	APIProject bool `json:"api_project"`
+
+	Rights
+}
+
+// UserRole is a named set of rights that users can be assigned to.
+type UserRole struct {
+	// UniqueRoleName is REDCap's generated name, such as "U-527D39JXAC".
+	// Leave it empty to create a role on import.
+	UniqueRoleName string `json:"unique_role_name"`
+	RoleLabel      string `json:"role_label"`
+
+	Rights
+}
+
+// UserRoleMapping assigns a user to a role.
+type UserRoleMapping struct {
+	Username       string `json:"username"`
+	UniqueRoleName string `json:"unique_role_name"`
+}
+
+// FormRight is a user's data entry right on an instrument.
+type FormRight int
+
+const (
+	FormNoAccess FormRight = 0
+	FormViewEdit FormRight = 1
+	FormReadOnly FormRight = 2
+	// FormEditSurveyResponses is view and edit, including survey
+	// responses.
+	FormEditSurveyResponses FormRight = 3
+)
+
+func (r FormRight) String() string {
+	switch r {
+	case FormNoAccess:
+		return "no access"
+	case FormViewEdit:
+		return "view & edit"
+	case FormReadOnly:
+		return "read only"
+	case FormEditSurveyResponses:
+		return "edit survey responses"
+	}
+	return "FormRight(" + strconv.Itoa(int(r)) + ")"
+}
+
+// DataExportRight is a user's data export right, for the whole project or
+// per instrument.
+type DataExportRight int
+
+const (
+	DataExportNone DataExportRight = 0
+	DataExportFull DataExportRight = 1
+	// DataExportDeidentified removes identifiers, free text and dates.
+	DataExportDeidentified DataExportRight = 2
+	// DataExportRemoveIdentifiers removes fields marked as identifiers.
+	DataExportRemoveIdentifiers DataExportRight = 3
+)
+
+func (r DataExportRight) String() string {
+	switch r {
+	case DataExportNone:
+		return "no access"
+	case DataExportFull:
+		return "full data set"
+	case DataExportDeidentified:
+		return "de-identified"
+	case DataExportRemoveIdentifiers:
+		return "remove identifiers"
+	}
+	return "DataExportRight(" + strconv.Itoa(int(r)) + ")"
+}
+
+// Rights are the privileges shared by users and roles.
+type Rights struct {
+	Design                   bool
+	Alerts                   bool
+	UserRights               bool
+	DataAccessGroups         bool
+	Reports                  bool
+	StatsAndCharts           bool
+	ManageSurveyParticipants bool
+	Calendar                 bool
+	DataImportTool           bool
+	DataComparisonTool       bool
+	Logging                  bool
+	EmailLogging             bool
+	FileRepository           bool
+	DataQualityCreate        bool
+	DataQualityExecute       bool
+	APIExport                bool
+	APIImport                bool
+	APIModules               bool
+	MobileApp                bool
+	MobileAppDownloadData    bool
+	RecordCreate             bool
+	RecordRename             bool
+	RecordDelete             bool
+	LockRecordsCustomization bool
+	LockRecordsAllForms      bool
+	// LockRecords is 0 (none), 1 (lock/unlock) or 2 (lock/unlock with
+	// e-signature).
+	LockRecords int
+	// DataExport is the project-wide export right of REDCap versions
+	// before per-instrument export rights.
+	DataExport DataExportRight
+	// Forms holds the data entry right for each instrument.
+	Forms map[string]FormRight
+	// FormsExport holds the export right for each instrument.
+	FormsExport map[string]DataExportRight
+}
+
+// flags maps the API names of the boolean rights to their fields.
+func (r *Rights) flags() map[string]*bool {
+	return map[string]*bool{
+		"design":                     &r.Design,
+		"alerts":                     &r.Alerts,
+		"user_rights":                &r.UserRights,
+		"data_access_groups":         &r.DataAccessGroups,
+		"reports":                    &r.Reports,
+		"stats_and_charts":           &r.StatsAndCharts,
+		"manage_survey_participants": &r.ManageSurveyParticipants,
+		"calendar":                   &r.Calendar,
+		"data_import_tool":           &r.DataImportTool,
+		"data_comparison_tool":       &r.DataComparisonTool,
+		"logging":                    &r.Logging,
+		"email_logging":              &r.EmailLogging,
+		"file_repository":            &r.FileRepository,
+		"data_quality_create":        &r.DataQualityCreate,
+		"data_quality_execute":       &r.DataQualityExecute,
+		"api_export":                 &r.APIExport,
+		"api_import":                 &r.APIImport,
+		"api_modules":                &r.APIModules,
+		"mobile_app":                 &r.MobileApp,
+		"mobile_app_download_data":   &r.MobileAppDownloadData,
+		"record_create":              &r.RecordCreate,
+		"record_rename":              &r.RecordRename,
+		"record_delete":              &r.RecordDelete,
+		"lock_records_customization": &r.LockRecordsCustomization,
+		"lock_records_all_forms":     &r.LockRecordsAllForms,
+	}
+}
+
+// decode reads the rights from an exported user or role. REDCap sends
+// rights as numbers, or as strings on some versions.
+func (r *Rights) decode(raw map[string]json.RawMessage) error {
+	for name, p := range r.flags() {
+		if v, ok := raw[name]; ok {
+			var t jsonText
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			*p = t == "1" || t == "true"
+		}
+	}
+	var t jsonText
+	if v, ok := raw["lock_records"]; ok {
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		r.LockRecords, _ = strconv.Atoi(string(t))
+	}
+	if v, ok := raw["data_export"]; ok {
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		n, _ := strconv.Atoi(string(t))
+		r.DataExport = DataExportRight(n)
+	}
+
+	var forms map[string]jsonText
+	if v, ok := raw["forms"]; ok && string(v) != "[]" {
+		if err := json.Unmarshal(v, &forms); err != nil {
+			return err
+		}
+		r.Forms = make(map[string]FormRight, len(forms))
+		for form, t := range forms {
+			n, _ := strconv.Atoi(string(t))
+			r.Forms[form] = FormRight(n)
+		}
+	}
+	forms = nil
+	if v, ok := raw["forms_export"]; ok && string(v) != "[]" {
+		if err := json.Unmarshal(v, &forms); err != nil {
+			return err
+		}
+		r.FormsExport = make(map[string]DataExportRight, len(forms))
+		for form, t := range forms {
+			n, _ := strconv.Atoi(string(t))
+			r.FormsExport[form] = DataExportRight(n)
+		}
+	}
+	return nil
+}
+
+// encode adds the rights to a user or role in REDCap's import shape.
+// Instrument maps are left out when nil, so an import keeps the existing
+// instrument rights.
+func (r *Rights) encode(m map[string]any) {
+	for name, p := range r.flags() {
+		m[name] = 0
+		if *p {
+			m[name] = 1
+		}
+	}
+	m["lock_records"] = r.LockRecords
+	// Sent even when none, so an import can take the right away
+	m["data_export"] = r.DataExport
+	if r.Forms != nil {
+		m["forms"] = r.Forms
+	}
+	if r.FormsExport != nil {
+		m["forms_export"] = r.FormsExport
+	}
+}
+
+// Set sets one right by its API name, with a value as written in REDCap's
+// CSV user export: "1" or "0" for flags, a number for lock_records and
+// data_export, and "form:1,form2:0" for forms and forms_export.
+func (r *Rights) Set(name, value string) error {
+	value = strings.TrimSpace(value)
+	if p, ok := r.flags()[name]; ok {
+		b, err := parseFlag(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*p = b
+		return nil
+	}
+
+	switch name {
+	case "lock_records":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 2 {
+			return fmt.Errorf("%s: invalid value %q, want 0-2", name, value)
+		}
+		r.LockRecords = n
+	case "data_export":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < int(DataExportNone) || n > int(DataExportRemoveIdentifiers) {
+			return fmt.Errorf("%s: invalid value %q, want 0-3", name, value)
+		}
+		r.DataExport = DataExportRight(n)
+	case "forms", "forms_export":
+		rights := make(map[string]int)
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			form, v, ok := strings.Cut(pair, ":")
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if !ok || err != nil {
+				return fmt.Errorf("%s: invalid entry %q, want form:right", name, pair)
+			}
+			rights[strings.TrimSpace(form)] = n
+		}
+		if name == "forms" {
+			r.Forms = make(map[string]FormRight, len(rights))
+			for form, n := range rights {
+				r.Forms[form] = FormRight(n)
+			}
+		} else {
+			r.FormsExport = make(map[string]DataExportRight, len(rights))
+			for form, n := range rights {
+				r.FormsExport[form] = DataExportRight(n)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown right %q", name)
+	}
+	return nil
+}
+
+func parseFlag(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "1", "true", "yes", "y":
+		return true, nil
+	case "0", "false", "no", "n", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid flag %q", v)
+}
+
+// UnmarshalJSON decodes a user from REDCap's user export.
+func (u *User) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var info struct {
+		Username        jsonText `json:"username"`
+		Email           jsonText `json:"email"`
+		FirstName       jsonText `json:"firstname"`
+		LastName        jsonText `json:"lastname"`
+		RoleID          jsonText `json:"role_id"`
+		RoleLabel       jsonText `json:"role_label"`
+		DataAccessGroup jsonText `json:"data_access_group"`
+		Expiration      jsonText `json:"expiration"`
+		LastLogin       jsonText `json:"last_login"`
+		APIProject      jsonText `json:"api_project"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return err
+	}
+
+	*u = User{
+		Username:        string(info.Username),
+		Email:           string(info.Email),
+		FirstName:       string(info.FirstName),
+		LastName:        string(info.LastName),
+		RoleLabel:       string(info.RoleLabel),
+		DataAccessGroup: string(info.DataAccessGroup),
+		Expiration:      string(info.Expiration),
+		LastLogin:       string(info.LastLogin),
+		APIProject:      info.APIProject == "1" || info.APIProject == "true",
+	}
+	u.RoleID, _ = strconv.Atoi(string(info.RoleID))
+	return u.Rights.decode(raw)
+}
+
+// MarshalJSON encodes the user in REDCap's user import shape. Role, last
+// login and APIProject are not importable and are left out.
+func (u User) MarshalJSON() ([]byte, error) {
+	m := map[string]any{
+		"username":          u.Username,
+		"email":             u.Email,
+		"firstname":         u.FirstName,
+		"lastname":          u.LastName,
+		"expiration":        u.Expiration,
+		"data_access_group": u.DataAccessGroup,
+	}
+	u.Rights.encode(m)
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes a role from REDCap's user role export.
+func (r *UserRole) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var info struct {
+		UniqueRoleName jsonText `json:"unique_role_name"`
+		RoleLabel      jsonText `json:"role_label"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return err
+	}
+
+	*r = UserRole{
+		UniqueRoleName: string(info.UniqueRoleName),
+		RoleLabel:      string(info.RoleLabel),
+	}
+	return r.Rights.decode(raw)
+}
+
+// MarshalJSON encodes the role in REDCap's user role import shape.
+func (r UserRole) MarshalJSON() ([]byte, error) {
+	m := map[string]any{
+		"unique_role_name": r.UniqueRoleName,
+		"role_label":       r.RoleLabel,
+	}
+	r.Rights.encode(m)
+	return json.Marshal(m)
 }
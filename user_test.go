@@ -0,0 +1,115 @@
+package redcap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestUserUnmarshal(t *testing.T) {
+	// Versions differ in sending rights as numbers or strings
+	data := `{"username":"ann","role_id":"4","api_project":1,"design":"1","api_export":1,
+		"lock_records":"2","data_export":3,"forms":{"demo":"1","visit":3},"forms_export":[]}`
+	var u User
+	if err := json.Unmarshal([]byte(data), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "ann" || u.RoleID != 4 || !u.APIProject {
+		t.Errorf("user = %+v", u)
+	}
+	if !u.Design || !u.APIExport || u.APIImport {
+		t.Errorf("flags: design %v, api_export %v, api_import %v", u.Design, u.APIExport, u.APIImport)
+	}
+	if u.LockRecords != 2 || u.DataExport != DataExportRemoveIdentifiers {
+		t.Errorf("lock_records %d, data_export %v", u.LockRecords, u.DataExport)
+	}
+	if u.Forms["demo"] != FormViewEdit || u.Forms["visit"] != FormEditSurveyResponses {
+		t.Errorf("forms = %v", u.Forms)
+	}
+	if u.FormsExport != nil {
+		t.Errorf("forms_export = %v, want nil for []", u.FormsExport)
+	}
+}
+
+func TestUserMarshal(t *testing.T) {
+	u := User{Username: "ann", APIProject: true, Rights: Rights{Design: true}}
+	data, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	// An import must be able to take the export right away
+	if v, ok := m["data_export"]; !ok || v != float64(0) {
+		t.Errorf("data_export = %v, %v; want 0", v, ok)
+	}
+	if m["design"] != float64(1) || m["api_import"] != float64(0) {
+		t.Errorf("design %v, api_import %v", m["design"], m["api_import"])
+	}
+	for _, name := range []string{"api_project", "last_login", "role_id", "forms", "forms_export"} {
+		if _, ok := m[name]; ok {
+			t.Errorf("%s sent on import", name)
+		}
+	}
+}
+
+func TestRightsSet(t *testing.T) {
+	tests := []struct {
+		name, value string
+		wantErr     bool
+	}{
+		{"design", "1", false},
+		{"design", "maybe", true},
+		{"lock_records", "2", false},
+		{"lock_records", "3", true},
+		{"lock_records", "-1", true},
+		{"data_export", "3", false},
+		{"data_export", "4", true},
+		{"forms", "demo:1, visit:2", false},
+		{"forms", "demo", true},
+		{"superuser", "1", true},
+	}
+	for _, tt := range tests {
+		var r Rights
+		if err := r.Set(tt.name, tt.value); (err != nil) != tt.wantErr {
+			t.Errorf("Set(%s, %q) error = %v, want error %v", tt.name, tt.value, err, tt.wantErr)
+		}
+	}
+
+	var r Rights
+	r.Set("forms_export", "demo:2,visit:0")
+	r.Set("lock_records", "1")
+	if r.FormsExport["demo"] != DataExportDeidentified || r.FormsExport["visit"] != DataExportNone || r.LockRecords != 1 {
+		t.Errorf("rights = %+v", r)
+	}
+}
+
+func TestUserImportsSendAction(t *testing.T) {
+	var got []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.FormValue("content")+":"+r.FormValue("action"))
+		w.Write([]byte("1"))
+	})
+	ctx := context.Background()
+	if _, err := c.ImportUsers(ctx, []User{{Username: "ann"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ImportUserRoles(ctx, []UserRole{{RoleLabel: "Coordinator"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ImportUserRoleMapping(ctx, []UserRoleMapping{{Username: "ann"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"user:import", "userRole:import", "userRoleMapping:import"}
+	if len(got) != len(want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d = %s, want %s", i+1, got[i], want[i])
+		}
+	}
+}
@@ -23,25 +23,104 @@ func (c *Client) ExportUsers(ctx context.Context) ([]User, error) {
 	return users, nil
 }
 
-// DAG represents a Data Access Group.
-type DAG struct {
-	UniqueGroupName string `json:"unique_group_name"`
-	GroupName       string `json:"group_name"`
+// ImportUsers adds users or updates their rights and returns the number
+// of users imported. Every right is sent, so start from an exported User
+// to change some rights and keep the others.
+func (c *Client) ImportUsers(ctx context.Context, users []User) (int, error) {
+	data, err := json.Marshal(users)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling users: %w", err)
+	}
+	return c.importJSON(ctx, "user", data, map[string]string{"action": "import"})
+}
+
+// DeleteUsers removes users from the project and returns the number
+// deleted.
+func (c *Client) DeleteUsers(ctx context.Context, usernames []string) (int, error) {
+	return c.deleteList(ctx, "user", "users", usernames)
+}
+
+// ExportUserRoles returns the project's user roles.
+func (c *Client) ExportUserRoles(ctx context.Context) ([]UserRole, error) {
+	body, err := c.Request(ctx, "userRole", map[string]string{
+		"format": "json",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []UserRole
+	if err := json.Unmarshal(body, &roles); err != nil {
+		return nil, fmt.Errorf("unmarshaling user roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// ImportUserRoles creates roles without a unique name and updates the
+// others, returning the number imported.
+func (c *Client) ImportUserRoles(ctx context.Context, roles []UserRole) (int, error) {
+	data, err := json.Marshal(roles)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling user roles: %w", err)
+	}
+	return c.importJSON(ctx, "userRole", data, map[string]string{"action": "import"})
+}
+
+// DeleteUserRoles deletes roles by unique role name and returns the
+// number deleted. Users in a deleted role keep no rights.
+func (c *Client) DeleteUserRoles(ctx context.Context, uniqueRoleNames []string) (int, error) {
+	return c.deleteList(ctx, "userRole", "roles", uniqueRoleNames)
 }
 
-// ExportDAGs returns the list of Data Access Groups.
-func (c *Client) ExportDAGs(ctx context.Context) ([]DAG, error) {
-	body, err := c.Request(ctx, "dag", map[string]string{
+// ExportUserRoleMapping returns which role each user is in. Users without
+// a role have an empty UniqueRoleName.
+func (c *Client) ExportUserRoleMapping(ctx context.Context) ([]UserRoleMapping, error) {
+	body, err := c.Request(ctx, "userRoleMapping", map[string]string{
 		"format": "json",
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	var dags []DAG
-	if err := json.Unmarshal(body, &dags); err != nil {
-		return nil, fmt.Errorf("unmarshaling DAGs: %w", err)
+	var mappings []UserRoleMapping
+	if err := json.Unmarshal(body, &mappings); err != nil {
+		return nil, fmt.Errorf("unmarshaling user role mapping: %w", err)
 	}
 
-	return dags, nil
+	return mappings, nil
+}
+
+// ImportUserRoleMapping assigns users to roles and returns the number of
+// users assigned. An empty UniqueRoleName removes a user from their role.
+func (c *Client) ImportUserRoleMapping(ctx context.Context, mappings []UserRoleMapping) (int, error) {
+	data, err := json.Marshal(mappings)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling user role mapping: %w", err)
+	}
+	return c.importJSON(ctx, "userRoleMapping", data, map[string]string{"action": "import"})
+}
+
+// deleteList sends a delete action with names as the array parameter
+// param[0], param[1], ... and returns the count REDCap reports.
+func (c *Client) deleteList(ctx context.Context, content, param string, names []string) (int, error) {
+	if len(names) == 0 {
+		return 0, nil
+	}
+	params := map[string]string{
+		"action": "delete",
+	}
+	for i, name := range names {
+		params[fmt.Sprintf("%s[%d]", param, i)] = name
+	}
+
+	body, err := c.Request(ctx, content, params)
+	if err != nil {
+		return 0, err
+	}
+	res, err := parseImportResult(body)
+	if err != nil {
+		return 0, err
+	}
+	return res.Count, nil
 }
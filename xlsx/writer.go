@@ -0,0 +1,386 @@
+// Package xlsx writes REDCap records as Excel workbooks with cell types
+// taken from the data dictionary.
+//
+// Records go on one sheet per instrument, or on a single "Records" sheet.
+// Each sheet starts with two frozen header rows, the column names and
+// the field labels. Integer, number, date and datetime values are written
+// as typed cells; raw choice codes are numbers and choice labels are text,
+// so the workbook shows whichever the export asked for. A "Codebook" sheet
+// lists every field with its label, type, validation and choices.
+package xlsx
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjodo/go-cap"
+	"github.com/xuri/excelize/v2"
+)
+
+// CodebookSheet is the name of the sheet describing the fields.
+const CodebookSheet = "Codebook"
+
+// RecordsSheet is the name of the sheet used by Options.Combined.
+const RecordsSheet = "Records"
+
+// headerRows is the number of frozen rows above the data.
+const headerRows = 2
+
+// Options configures a Writer.
+type Options struct {
+	// Combined writes every column to one sheet, one row per export row,
+	// instead of one sheet per instrument.
+	Combined bool
+}
+
+// Writer writes batches of flat records to a workbook. The workbook is
+// built in memory and written out by Close.
+type Writer struct {
+	out  io.Writer
+	dict *redcap.Dictionary
+	opts Options
+
+	f      *excelize.File
+	sheets []*sheet
+	styles map[redcap.ColumnType]int
+}
+
+type sheet struct {
+	name    string
+	form    string // "" for the combined sheet
+	columns []string
+	data    []string // columns that mark a row as having instrument data
+	next    int      // next row number
+}
+
+// Record export columns that identify a row, in export order.
+var keyColumns = []string{
+	"redcap_event_name",
+	"redcap_repeat_instrument",
+	"redcap_repeat_instance",
+	"redcap_data_access_group",
+	"redcap_survey_identifier",
+}
+
+// NewWriter returns a Writer for records of the dictionary's project. The
+// sheets are laid out from the first batch written; call Close to write
+// the workbook.
+func NewWriter(w io.Writer, dict *redcap.Dictionary, opts Options) *Writer {
+	return &Writer{out: w, dict: dict, opts: opts}
+}
+
+// Write appends one batch of flat export rows.
+func (w *Writer) Write(rows []map[string]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if w.f == nil {
+		// Every row of a REDCap export has the same columns
+		present := make(map[string]bool, len(rows[0]))
+		for k := range rows[0] {
+			present[k] = true
+		}
+		if err := w.start(present); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range rows {
+		repeatForm := redcap.ValueText(r["redcap_repeat_instrument"])
+		for _, s := range w.sheets {
+			if s.form != "" {
+				if repeatForm != "" && repeatForm != s.form {
+					continue
+				}
+				if repeatForm == "" && !w.dict.HasData(r, s.data) {
+					continue
+				}
+			}
+			values := make([]any, len(s.columns))
+			for i, col := range s.columns {
+				values[i] = w.cell(col, redcap.ValueText(r[col]))
+			}
+			if err := w.f.SetSheetRow(s.name, cellName(1, s.next), &values); err != nil {
+				return fmt.Errorf("writing sheet %s: %w", s.name, err)
+			}
+			s.next++
+		}
+	}
+	return nil
+}
+
+// Close adds the codebook and writes the workbook. A writer that was
+// never given rows writes empty sheets with every dictionary column.
+func (w *Writer) Close() error {
+	if w.f == nil {
+		present := map[string]bool{w.dict.RecordIDField: true}
+		for _, form := range w.dict.Forms() {
+			for _, col := range w.dict.FormColumns(form) {
+				present[col] = true
+			}
+		}
+		if err := w.start(present); err != nil {
+			return err
+		}
+	}
+	defer w.f.Close()
+
+	if err := w.codebook(); err != nil {
+		return err
+	}
+	if err := w.f.Write(w.out); err != nil {
+		return fmt.Errorf("writing workbook: %w", err)
+	}
+	return nil
+}
+
+// start creates the workbook and a sheet for each instrument with columns
+// in the export, or the combined sheet.
+func (w *Writer) start(present map[string]bool) error {
+	w.f = excelize.NewFile()
+	if err := w.newStyles(); err != nil {
+		return err
+	}
+
+	var keys []string
+	if present[w.dict.RecordIDField] {
+		keys = append(keys, w.dict.RecordIDField)
+	}
+	for _, col := range keyColumns {
+		if present[col] {
+			keys = append(keys, col)
+		}
+	}
+
+	if w.opts.Combined {
+		s := &sheet{name: RecordsSheet, columns: keys}
+		for _, form := range w.dict.Forms() {
+			s.columns = append(s.columns, formColumns(w.dict, form, present)...)
+		}
+		w.sheets = append(w.sheets, s)
+	} else {
+		used := make(map[string]bool)
+		for _, form := range w.dict.Forms() {
+			cols := formColumns(w.dict, form, present)
+			if len(cols) == 0 {
+				continue
+			}
+			w.sheets = append(w.sheets, &sheet{
+				name:    sheetName(form, used),
+				form:    form,
+				columns: append(append([]string{}, keys...), cols...),
+				data:    cols,
+			})
+		}
+	}
+
+	for i, s := range w.sheets {
+		if err := w.newSheet(i, s.name); err != nil {
+			return err
+		}
+		if err := w.header(s); err != nil {
+			return err
+		}
+		s.next = headerRows + 1
+	}
+	return nil
+}
+
+// newSheet adds a sheet, renaming excelize's default first sheet.
+func (w *Writer) newSheet(i int, name string) error {
+	var err error
+	if i == 0 {
+		err = w.f.SetSheetName(w.f.GetSheetName(0), name)
+	} else {
+		_, err = w.f.NewSheet(name)
+	}
+	if err != nil {
+		return fmt.Errorf("adding sheet %s: %w", name, err)
+	}
+	return nil
+}
+
+// header writes the name and label rows, freezes them and sets the
+// number format of each typed column.
+func (w *Writer) header(s *sheet) error {
+	names := make([]any, len(s.columns))
+	labels := make([]any, len(s.columns))
+	for i, col := range s.columns {
+		names[i] = col
+		labels[i] = w.dict.ColumnLabel(col)
+	}
+	if err := w.f.SetSheetRow(s.name, "A1", &names); err != nil {
+		return fmt.Errorf("writing sheet %s: %w", s.name, err)
+	}
+	if err := w.f.SetSheetRow(s.name, "A2", &labels); err != nil {
+		return fmt.Errorf("writing sheet %s: %w", s.name, err)
+	}
+
+	for i, col := range s.columns {
+		if style, ok := w.styles[w.dict.ColumnType(col)]; ok {
+			name, _ := excelize.ColumnNumberToName(i + 1)
+			if err := w.f.SetColStyle(s.name, name, style); err != nil {
+				return fmt.Errorf("styling sheet %s: %w", s.name, err)
+			}
+		}
+	}
+	if err := w.f.SetRowStyle(s.name, 1, headerRows, w.styles[headerStyle]); err != nil {
+		return fmt.Errorf("styling sheet %s: %w", s.name, err)
+	}
+	return w.freeze(s.name, headerRows)
+}
+
+func (w *Writer) freeze(name string, rows int) error {
+	err := w.f.SetPanes(name, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      rows,
+		TopLeftCell: cellName(1, rows+1),
+		ActivePane:  "bottomLeft",
+	})
+	if err != nil {
+		return fmt.Errorf("freezing sheet %s: %w", name, err)
+	}
+	return nil
+}
+
+// headerStyle keys the bold header style in Writer.styles; it is not a
+// column type.
+const headerStyle redcap.ColumnType = -1
+
+// Excel number formats of typed columns.
+var numberFormats = map[redcap.ColumnType]string{
+	redcap.ColumnDate:     "yyyy-mm-dd",
+	redcap.ColumnDatetime: "yyyy-mm-dd hh:mm:ss",
+}
+
+func (w *Writer) newStyles() error {
+	w.styles = make(map[redcap.ColumnType]int)
+	for t, format := range numberFormats {
+		id, err := w.f.NewStyle(&excelize.Style{CustomNumFmt: &format})
+		if err != nil {
+			return fmt.Errorf("adding cell style: %w", err)
+		}
+		w.styles[t] = id
+	}
+	id, err := w.f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return fmt.Errorf("adding cell style: %w", err)
+	}
+	w.styles[headerStyle] = id
+	return nil
+}
+
+// cell converts an exported value to a typed cell value. Values that do
+// not parse as their column's type, such as choice labels, stay text.
+func (w *Writer) cell(col, v string) any {
+	if v == "" {
+		return nil
+	}
+	switch w.dict.ColumnType(col) {
+	case redcap.ColumnInteger, redcap.ColumnBoolean, redcap.ColumnCategory:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case redcap.ColumnNumber:
+		if n, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64); err == nil {
+			return n
+		}
+	case redcap.ColumnDate:
+		if t, err := time.Parse("2006-01-02", v); err == nil {
+			return t
+		}
+	case redcap.ColumnDatetime:
+		if t, ok := redcap.ParseDatetime(v); ok {
+			return t
+		}
+	}
+	return v
+}
+
+// codebook adds a sheet describing every field of the dictionary.
+func (w *Writer) codebook() error {
+	if _, err := w.f.NewSheet(CodebookSheet); err != nil {
+		return fmt.Errorf("adding sheet %s: %w", CodebookSheet, err)
+	}
+	header := []any{"Variable", "Form", "Field type", "Label", "Choices", "Validation", "Min", "Max", "Required", "Identifier", "Branching logic", "Note"}
+	if err := w.f.SetSheetRow(CodebookSheet, "A1", &header); err != nil {
+		return fmt.Errorf("writing sheet %s: %w", CodebookSheet, err)
+	}
+	for i := range w.dict.Fields {
+		f := &w.dict.Fields[i]
+		choices := make([]string, len(f.Choices))
+		for j, c := range f.Choices {
+			choices[j] = c.Code + ", " + c.Label
+		}
+		if f.Field_type == "calc" {
+			choices = []string{f.Calculations}
+		}
+		row := []any{
+			f.Field_name,
+			f.Form_name,
+			f.Field_type,
+			strings.TrimSpace(f.Field_label),
+			strings.Join(choices, " | "),
+			f.ValidationType(),
+			f.Text_validation_min,
+			f.Text_validation_max,
+			yes(f.Required_field),
+			yes(f.Identifier == "y"),
+			f.Branching_logic,
+			f.Field_note,
+		}
+		if err := w.f.SetSheetRow(CodebookSheet, cellName(1, i+2), &row); err != nil {
+			return fmt.Errorf("writing sheet %s: %w", CodebookSheet, err)
+		}
+	}
+	if err := w.f.SetRowStyle(CodebookSheet, 1, 1, w.styles[headerStyle]); err != nil {
+		return fmt.Errorf("styling sheet %s: %w", CodebookSheet, err)
+	}
+	return w.freeze(CodebookSheet, 1)
+}
+
+// formColumns returns the exported columns of an instrument other than the
+// record ID, with the survey timestamp first when present.
+func formColumns(dict *redcap.Dictionary, form string, present map[string]bool) []string {
+	var cols []string
+	if present[form+"_timestamp"] {
+		cols = append(cols, form+"_timestamp")
+	}
+	for _, col := range dict.FormColumns(form) {
+		if col != dict.RecordIDField && present[col] {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// sheetName makes an instrument name a unique sheet name. Excel limits
+// names to 31 characters; instrument names never hold the characters it
+// forbids.
+func sheetName(form string, used map[string]bool) string {
+	name := form
+	if len(name) > 31 {
+		name = name[:31]
+	}
+	for n := 2; used[strings.ToLower(name)] || strings.EqualFold(name, CodebookSheet); n++ {
+		suffix := "_" + strconv.Itoa(n)
+		name = form[:min(len(form), 31-len(suffix))] + suffix
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+func cellName(col, row int) string {
+	name, _ := excelize.CoordinatesToCellName(col, row)
+	return name
+}
+
+func yes(b bool) string {
+	if b {
+		return "y"
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package xlsx
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/cjodo/go-cap"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestWriterInstrumentSheets(t *testing.T) {
+	dict := redcap.NewDictionary([]redcap.Field{
+		{Field_name: "record_id", Form_name: "demo", Field_type: "text", Field_label: "Record ID"},
+		{Field_name: "age", Form_name: "demo", Field_type: "text", Field_label: "Age", Text_validation_type_or_show_slider_number: "integer", Identifier: "y"},
+		{Field_name: "weight", Form_name: "visit", Field_type: "text", Field_label: "Weight", Text_validation_type_or_show_slider_number: "number"},
+		{Field_name: "arm", Form_name: "visit", Field_type: "radio", Field_label: "Arm", Choices: []redcap.FieldChoice{{ID: 1, Code: "1", Label: "Drug"}, {ID: 2, Code: "2", Label: "Placebo"}}},
+	})
+	row := func(id, instrument, instance, age, weight, arm string) map[string]any {
+		return map[string]any{
+			"record_id": id, "redcap_repeat_instrument": instrument, "redcap_repeat_instance": instance,
+			"age": age, "demo_complete": "2", "weight": weight, "arm": arm, "visit_complete": "0",
+		}
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, dict, Options{})
+	err := w.Write([]map[string]any{
+		row("1", "", "", "41", "", ""),
+		row("1", "visit", "1", "", "70.5", "1"),
+		row("1", "visit", "2", "", "71", "Placebo"),
+		row("2", "", "", "", "", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, want := f.GetSheetList(), []string{"demo", "visit", CodebookSheet}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sheets = %v, want %v", got, want)
+	}
+
+	rows := func(sheet string) [][]string {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	// Each instrument sheet has the key columns, the name and label header
+	// rows and only the rows with its data
+	wantDemo := [][]string{
+		{"record_id", "redcap_repeat_instrument", "redcap_repeat_instance", "age", "demo_complete"},
+		{"Record ID", "", "", "Age"},
+		{"1", "", "", "41", "2"},
+	}
+	if got := rows("demo"); !reflect.DeepEqual(got, wantDemo) {
+		t.Errorf("demo sheet = %q, want %q", got, wantDemo)
+	}
+	wantVisit := [][]string{
+		{"record_id", "redcap_repeat_instrument", "redcap_repeat_instance", "weight", "arm", "visit_complete"},
+		{"Record ID", "", "", "Weight", "Arm"},
+		{"1", "visit", "1", "70.5", "1", "0"},
+		{"1", "visit", "2", "71", "Placebo", "0"},
+	}
+	if got := rows("visit"); !reflect.DeepEqual(got, wantVisit) {
+		t.Errorf("visit sheet = %q, want %q", got, wantVisit)
+	}
+
+	// Numbers and raw choice codes are numeric cells; labels stay text
+	for cell, text := range map[string]bool{"D3": false, "E3": false, "E4": true} {
+		if got, _ := f.GetCellType("visit", cell); (got == excelize.CellTypeSharedString) != text {
+			t.Errorf("visit %s type = %v, want text %v", cell, got, text)
+		}
+	}
+
+	codebook := rows(CodebookSheet)
+	if len(codebook) != 5 || codebook[0][0] != "Variable" {
+		t.Fatalf("codebook = %q", codebook)
+	}
+	if got, want := codebook[2], []string{"age", "demo", "text", "Age", "", "integer", "", "", "", "y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("codebook age = %q, want %q", got, want)
+	}
+	if got := codebook[4][4]; got != "1, Drug | 2, Placebo" {
+		t.Errorf("codebook arm choices = %q", got)
+	}
+}